@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"github.com/kayprogrammer/socialnet-v6/database"
+)
+
+// Recomputes the reaction, comment, reply and repost counters of every post and comment.
+// The counters are kept by triggers, so this is only needed when they drift (e.g after restoring data)
+func main() {
+	cfg := config.GetConfig()
+	db := database.ConnectDb(cfg)
+	sqlDb, _ := db.DB()
+	defer sqlDb.Close()
+
+	log.Println("Reconciling engagement counters")
+	if err := database.ReconcileCounters(db); err != nil {
+		log.Fatal("Failed to reconcile counters: ", err)
+	}
+	log.Println("Engagement counters reconciled successfully")
+}
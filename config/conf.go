@@ -5,32 +5,60 @@ import (
 )
 
 type Config struct {
-	ProjectName               string `mapstructure:"PROJECT_NAME"`
-	Debug                     bool   `mapstructure:"DEBUG"`
-	EmailOtpExpireSeconds     int64  `mapstructure:"EMAIL_OTP_EXPIRE_SECONDS"`
-	AccessTokenExpireMinutes  int    `mapstructure:"ACCESS_TOKEN_EXPIRE_MINUTES"`
-	RefreshTokenExpireMinutes int    `mapstructure:"REFRESH_TOKEN_EXPIRE_MINUTES"`
-	Port                      string `mapstructure:"PORT"`
-	SecretKey                 string `mapstructure:"SECRET_KEY"`
-	FirstSuperuserEmail       string `mapstructure:"FIRST_SUPERUSER_EMAIL"`
-	FirstSuperUserPassword    string `mapstructure:"FIRST_SUPERUSER_PASSWORD"`
-	FirstClientEmail          string `mapstructure:"FIRST_CLIENT_EMAIL"`
-	FirstClientPassword       string `mapstructure:"FIRST_CLIENT_PASSWORD"`
-	PostgresUser              string `mapstructure:"POSTGRES_USER"`
-	PostgresPassword          string `mapstructure:"POSTGRES_PASSWORD"`
-	PostgresServer            string `mapstructure:"POSTGRES_SERVER"`
-	PostgresPort              string `mapstructure:"POSTGRES_PORT"`
-	PostgresDB                string `mapstructure:"POSTGRES_DB"`
-	TestPostgresDB            string `mapstructure:"TEST_POSTGRES_DB"`
-	MailSenderEmail           string `mapstructure:"MAIL_SENDER_EMAIL"`
-	MailSenderPassword        string `mapstructure:"MAIL_SENDER_PASSWORD"`
-	MailSenderHost            string `mapstructure:"MAIL_SENDER_HOST"`
-	MailSenderPort            int    `mapstructure:"MAIL_SENDER_PORT"`
-	CORSAllowedOrigins        string `mapstructure:"CORS_ALLOWED_ORIGINS"`
-	CloudinaryCloudName       string `mapstructure:"CLOUDINARY_CLOUD_NAME"`
-	CloudinaryAPIKey          string `mapstructure:"CLOUDINARY_API_KEY"`
-	CloudinaryAPISecret       string `mapstructure:"CLOUDINARY_API_SECRET"`
-	SocketSecret              string `mapstructure:"SOCKET_SECRET"`
+	ProjectName               string  `mapstructure:"PROJECT_NAME"`
+	Debug                     bool    `mapstructure:"DEBUG"`
+	EmailOtpExpireSeconds     int64   `mapstructure:"EMAIL_OTP_EXPIRE_SECONDS"`
+	AccessTokenExpireMinutes  int     `mapstructure:"ACCESS_TOKEN_EXPIRE_MINUTES"`
+	RefreshTokenExpireMinutes int     `mapstructure:"REFRESH_TOKEN_EXPIRE_MINUTES"`
+	Port                      string  `mapstructure:"PORT"`
+	SecretKey                 string  `mapstructure:"SECRET_KEY"`
+	FirstSuperuserEmail       string  `mapstructure:"FIRST_SUPERUSER_EMAIL"`
+	FirstSuperUserPassword    string  `mapstructure:"FIRST_SUPERUSER_PASSWORD"`
+	FirstClientEmail          string  `mapstructure:"FIRST_CLIENT_EMAIL"`
+	FirstClientPassword       string  `mapstructure:"FIRST_CLIENT_PASSWORD"`
+	PostgresUser              string  `mapstructure:"POSTGRES_USER"`
+	PostgresPassword          string  `mapstructure:"POSTGRES_PASSWORD"`
+	PostgresServer            string  `mapstructure:"POSTGRES_SERVER"`
+	PostgresPort              string  `mapstructure:"POSTGRES_PORT"`
+	PostgresDB                string  `mapstructure:"POSTGRES_DB"`
+	TestPostgresDB            string  `mapstructure:"TEST_POSTGRES_DB"`
+	MailSenderEmail           string  `mapstructure:"MAIL_SENDER_EMAIL"`
+	MailSenderPassword        string  `mapstructure:"MAIL_SENDER_PASSWORD"`
+	MailSenderHost            string  `mapstructure:"MAIL_SENDER_HOST"`
+	MailSenderPort            int     `mapstructure:"MAIL_SENDER_PORT"`
+	CORSAllowedOrigins        string  `mapstructure:"CORS_ALLOWED_ORIGINS"`
+	CloudinaryCloudName       string  `mapstructure:"CLOUDINARY_CLOUD_NAME"`
+	CloudinaryAPIKey          string  `mapstructure:"CLOUDINARY_API_KEY"`
+	CloudinaryAPISecret       string  `mapstructure:"CLOUDINARY_API_SECRET"`
+	SocketBroker              string  `mapstructure:"SOCKET_BROKER"`
+	TimelineRecencyWeight     float64 `mapstructure:"TIMELINE_RECENCY_WEIGHT"`
+	TimelineReactionsWeight   float64 `mapstructure:"TIMELINE_REACTIONS_WEIGHT"`
+	TimelineCommentsWeight    float64 `mapstructure:"TIMELINE_COMMENTS_WEIGHT"`
+	RateLimitStore            string  `mapstructure:"RATE_LIMIT_STORE"`
+	ProxyHeader               string  `mapstructure:"PROXY_HEADER"`    // Header the reverse proxy puts the client IP in (e.g X-Real-IP). Empty when not behind one
+	TrustedProxies            string  `mapstructure:"TRUSTED_PROXIES"` // Comma separated IPs or CIDR ranges of the proxies the header is taken from
+	OtpMaxAttempts            int     `mapstructure:"OTP_MAX_ATTEMPTS"`
+	LoginMaxAttempts          int     `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginLockoutSeconds       int     `mapstructure:"LOGIN_LOCKOUT_SECONDS"`
+	StorageBackend            string  `mapstructure:"STORAGE_BACKEND"`
+	StorageUrlExpireMinutes   int     `mapstructure:"STORAGE_URL_EXPIRE_MINUTES"`
+	LocalStorageDir           string  `mapstructure:"LOCAL_STORAGE_DIR"`
+	LocalStorageBaseUrl       string  `mapstructure:"LOCAL_STORAGE_BASE_URL"`
+	S3Endpoint                string  `mapstructure:"S3_ENDPOINT"`
+	S3Region                  string  `mapstructure:"S3_REGION"`
+	S3Bucket                  string  `mapstructure:"S3_BUCKET"`
+	S3AccessKey               string  `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey               string  `mapstructure:"S3_SECRET_KEY"`
+	S3PathStyle               bool    `mapstructure:"S3_PATH_STYLE"`
+	PendingFileExpireMinutes  int     `mapstructure:"PENDING_FILE_EXPIRE_MINUTES"`
+	MaxImageSizeMB            int64   `mapstructure:"MAX_IMAGE_SIZE_MB"`
+	MaxVideoSizeMB            int64   `mapstructure:"MAX_VIDEO_SIZE_MB"`
+	MaxAudioSizeMB            int64   `mapstructure:"MAX_AUDIO_SIZE_MB"`
+	MaxDocumentSizeMB         int64   `mapstructure:"MAX_DOCUMENT_SIZE_MB"`
+	MaxPostMedia              int     `mapstructure:"MAX_POST_MEDIA"`
+	MaxCommentDepth           int     `mapstructure:"MAX_COMMENT_DEPTH"`
+	TrendingWindowHours       int     `mapstructure:"TRENDING_WINDOW_HOURS"`
+	AccountDeletionGraceDays  int     `mapstructure:"ACCOUNT_DELETION_GRACE_DAYS"`
 }
 
 func GetConfig(testOpts ...bool) (config Config) {
@@ -39,6 +67,33 @@ func GetConfig(testOpts ...bool) (config Config) {
 	viper.SetConfigType("env")
 
 	viper.AutomaticEnv()
+
+	// Defaults for optional settings
+	viper.SetDefault("SOCKET_BROKER", "memory")
+	viper.SetDefault("TIMELINE_RECENCY_WEIGHT", 1.0)
+	viper.SetDefault("TIMELINE_REACTIONS_WEIGHT", 2.0)
+	viper.SetDefault("TIMELINE_COMMENTS_WEIGHT", 3.0)
+	viper.SetDefault("RATE_LIMIT_STORE", "memory")
+	viper.SetDefault("PROXY_HEADER", "")
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("OTP_MAX_ATTEMPTS", 5)
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS", 5)
+	viper.SetDefault("LOGIN_LOCKOUT_SECONDS", 60)
+	viper.SetDefault("STORAGE_BACKEND", "cloudinary")
+	viper.SetDefault("STORAGE_URL_EXPIRE_MINUTES", 60)
+	viper.SetDefault("LOCAL_STORAGE_DIR", "media")
+	viper.SetDefault("LOCAL_STORAGE_BASE_URL", "http://localhost:8000/api/v6/media")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("PENDING_FILE_EXPIRE_MINUTES", 120)
+	viper.SetDefault("MAX_IMAGE_SIZE_MB", 10)
+	viper.SetDefault("MAX_VIDEO_SIZE_MB", 100)
+	viper.SetDefault("MAX_AUDIO_SIZE_MB", 25)
+	viper.SetDefault("MAX_DOCUMENT_SIZE_MB", 25)
+	viper.SetDefault("MAX_POST_MEDIA", 10)
+	viper.SetDefault("MAX_COMMENT_DEPTH", 5)
+	viper.SetDefault("TRENDING_WINDOW_HOURS", 24)
+	viper.SetDefault("ACCOUNT_DELETION_GRACE_DAYS", 30)
+
 	var err error
 	if err = viper.ReadInConfig(); err != nil {
 		panic(err)
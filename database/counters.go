@@ -0,0 +1,83 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Engagement counters of posts and comments are kept by triggers, so they stay right whichever way
+// rows come and go (cascades included) and change in the same transaction as them
+var counterTriggers = []string{
+	`CREATE OR REPLACE FUNCTION count_reactions() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			UPDATE posts SET reactions_count = reactions_count + 1 WHERE id = NEW.post_id;
+			UPDATE comments SET reactions_count = reactions_count + 1 WHERE id = NEW.comment_id;
+			RETURN NEW;
+		END IF;
+		UPDATE posts SET reactions_count = reactions_count - 1 WHERE id = OLD.post_id;
+		UPDATE comments SET reactions_count = reactions_count - 1 WHERE id = OLD.comment_id;
+		RETURN OLD;
+	END $$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS count_reactions ON reactions`,
+	`CREATE TRIGGER count_reactions AFTER INSERT OR DELETE ON reactions FOR EACH ROW EXECUTE FUNCTION count_reactions()`,
+
+	// Top comments count on their post, and replies on the comment they answer
+	`CREATE OR REPLACE FUNCTION count_comments() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			IF NEW.parent_id IS NULL THEN
+				UPDATE posts SET comments_count = comments_count + 1 WHERE id = NEW.post_id;
+			ELSE
+				UPDATE comments SET replies_count = replies_count + 1 WHERE id = NEW.parent_id;
+			END IF;
+			RETURN NEW;
+		END IF;
+		IF OLD.parent_id IS NULL THEN
+			UPDATE posts SET comments_count = comments_count - 1 WHERE id = OLD.post_id;
+		ELSE
+			UPDATE comments SET replies_count = replies_count - 1 WHERE id = OLD.parent_id;
+		END IF;
+		RETURN OLD;
+	END $$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS count_comments ON comments`,
+	`CREATE TRIGGER count_comments AFTER INSERT OR DELETE ON comments FOR EACH ROW EXECUTE FUNCTION count_comments()`,
+
+	// Reposts and quotes count on the post they share
+	`CREATE OR REPLACE FUNCTION count_reposts() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			UPDATE posts SET reposts_count = reposts_count + 1 WHERE id = NEW.original_post_id;
+			RETURN NEW;
+		END IF;
+		UPDATE posts SET reposts_count = reposts_count - 1 WHERE id = OLD.original_post_id;
+		RETURN OLD;
+	END $$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS count_reposts ON posts`,
+	`CREATE TRIGGER count_reposts AFTER INSERT OR DELETE ON posts FOR EACH ROW EXECUTE FUNCTION count_reposts()`,
+}
+
+func CreateCounterTriggers(db *gorm.DB) {
+	for _, statement := range counterTriggers {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Println("Error creating counter triggers: ", err)
+			return
+		}
+	}
+}
+
+// Recomputes every engagement counter from the rows they count
+func ReconcileCounters(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE posts SET
+			reactions_count = (SELECT COUNT(*) FROM reactions WHERE reactions.post_id = posts.id),
+			comments_count = (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id AND comments.parent_id IS NULL),
+			reposts_count = (SELECT COUNT(*) FROM posts reposts WHERE reposts.original_post_id = posts.id)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE comments SET
+			reactions_count = (SELECT COUNT(*) FROM reactions WHERE reactions.comment_id = comments.id),
+			replies_count = (SELECT COUNT(*) FROM comments replies WHERE replies.parent_id = comments.id)`).Error
+	})
+}
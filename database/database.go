@@ -17,6 +17,7 @@ func Models() []interface{} {
 		// general
 		&models.File{},
 		&models.SiteDetail{},
+		&models.RateLimitCounter{},
 
 		// accounts
 		&models.Country{},
@@ -24,29 +25,80 @@ func Models() []interface{} {
 		&models.City{},
 		&models.User{},
 		&models.Otp{},
+		&models.Session{},
+		&models.RecoveryCode{},
+		&models.SocketConnection{},
 
 		// feed
 		&models.Post{},
+		&models.PostMedia{},
 		&models.Comment{},
-		&models.Reply{},
 		&models.Reaction{},
+		&models.Collection{},
+		&models.Bookmark{},
+
+		// chat
+		&models.Chat{},
+		&models.Message{},
+		&models.MessageReceipt{},
+
+		// mentions & hashtags (in posts, comments and messages)
+		&models.Mention{},
+		&models.Hashtag{},
 
 		// profiles
 		&models.Friend{},
+		&models.Block{},
+		&models.Mute{},
 		&models.Notification{},
 
-		// chat
-		&models.Chat{},
-		&models.Message{},
+		// moderation
+		&models.Report{},
+		&models.AuditLog{},
 	}
 }
 
 func MakeMigrations(db *gorm.DB) {
+	// Engagement counters are new to existing posts, so they have to be counted once added
+	countersMissing := db.Migrator().HasTable("posts") && !db.Migrator().HasColumn("posts", "reactions_count")
+
 	models := Models()
 	for _, model := range models {
         db.AutoMigrate(model)
     }
 	db.Exec("CREATE UNIQUE INDEX unique_requester_requestee ON friends(LEAST(requester_id, requestee_id), GREATEST(requester_id, requestee_id))")
+	if err := CreateIndexes(db); err != nil {
+		log.Println("Error creating indexes: ", err)
+	}
+
+	// Reposts of a post used to hold the foreign key of original_post_id too. OriginalPostObj owns it now
+	if db.Migrator().HasConstraint("posts", "fk_posts_reposts") {
+		db.Migrator().DropConstraint("posts", "fk_posts_reposts")
+	}
+
+	// Posts used to hold a single image themselves. Move those into their media
+	if db.Migrator().HasColumn("posts", "image_id") {
+		db.Exec("INSERT INTO post_media (id, created_at, updated_at, post_id, file_id, position) SELECT uuid_generate_v4(), created_at, updated_at, id, image_id, 0 FROM posts WHERE image_id IS NOT NULL")
+		db.Migrator().DropColumn("posts", "image_id")
+	}
+
+	// Replies used to have their own table. Move them into the comment tree, along with their reactions and notifications
+	if db.Migrator().HasTable("replies") {
+		db.Exec("UPDATE comments SET path = id || '/' WHERE path = ''")
+		db.Exec("INSERT INTO comments (id, created_at, updated_at, author_id, text, slug, post_id, parent_id, path, depth) SELECT r.id, r.created_at, r.updated_at, r.author_id, r.text, r.slug, c.post_id, c.id, c.path || r.id || '/', 1 FROM replies r JOIN comments c ON c.id = r.comment_id")
+		db.Exec("UPDATE reactions SET comment_id = reply_id WHERE reply_id IS NOT NULL")
+		db.Exec("UPDATE notifications SET comment_id = reply_id WHERE reply_id IS NOT NULL")
+		db.Migrator().DropColumn("reactions", "reply_id")
+		db.Migrator().DropColumn("notifications", "reply_id")
+		db.Migrator().DropTable("replies")
+	}
+
+	CreateCounterTriggers(db)
+	if countersMissing {
+		if err := ReconcileCounters(db); err != nil {
+			log.Println("Error counting engagement: ", err)
+		}
+	}
 }
 
 func CreateTables(db *gorm.DB) {
@@ -54,6 +106,24 @@ func CreateTables(db *gorm.DB) {
 	for _, model := range models {
         db.Migrator().CreateTable(model)
     }
+	if err := CreateIndexes(db); err != nil {
+		log.Println("Error creating indexes: ", err)
+	}
+	CreateCounterTriggers(db)
+}
+
+// Partial unique indexes, which model tags can't declare over a field shared through FeedAbstract
+func CreateIndexes(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&models.Post{}, "unique_author_plain_repost") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Plain reposts could be made twice before the index. Keep the first of each
+		if err := tx.Exec("DELETE FROM posts p USING posts o WHERE NOT p.is_quote AND NOT o.is_quote AND p.author_id = o.author_id AND p.original_post_id = o.original_post_id AND (p.created_at, p.id) > (o.created_at, o.id)").Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE UNIQUE INDEX unique_author_plain_repost ON posts(author_id, original_post_id) WHERE NOT is_quote").Error
+	})
 }
 
 func DropTables(db *gorm.DB) {
@@ -64,9 +134,9 @@ func DropTables(db *gorm.DB) {
     }
 }
 
-func ConnectDb(cfg config.Config, logs...bool) *gorm.DB {
+func GetDsn(cfg config.Config) string {
 	dsnTemplate := "host=%s user=%s password=%s dbname=%s port=%s TimeZone=%s"
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		dsnTemplate,
 		cfg.PostgresServer,
 		cfg.PostgresUser,
@@ -75,6 +145,10 @@ func ConnectDb(cfg config.Config, logs...bool) *gorm.DB {
 		cfg.PostgresPort,
 		"UTC",
 	)
+}
+
+func ConnectDb(cfg config.Config, logs...bool) *gorm.DB {
+	dsn := GetDsn(cfg)
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		SkipDefaultTransaction: true,
 		PrepareStmt:            true,
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"gorm.io/gorm"
+)
+
+// Number of events a subscriber can fall behind by before new ones are dropped for it
+const subscriptionBufferSize = 64
+
+// Broker delivers events published on a topic (e.g "chat_<id>") to every subscriber of that topic.
+type Broker interface {
+	Publish(topic string, data []byte) error
+	Subscribe(topic string) *Subscription
+	Unsubscribe(sub *Subscription)
+}
+
+// Subscription receives the events of a topic on C until it is unsubscribed, after which C is closed.
+type Subscription struct {
+	Topic string
+	C     chan []byte
+}
+
+// NewBroker returns the broker set in the config: "postgres" fans events out across every
+// API replica sharing the database, while "memory" (the default) only reaches this process.
+func NewBroker(cfg config.Config, db *gorm.DB) Broker {
+	if cfg.SocketBroker == "postgres" {
+		broker, err := NewPostgresBroker(cfg, db)
+		if err != nil {
+			log.Fatal("Failed to start the postgres event broker: ", err)
+		}
+		return broker
+	}
+	return NewMemoryBroker()
+}
+
+// ----------------------------------
+// IN-PROCESS BROKER
+// --------------------------------
+type MemoryBroker struct {
+	mutex       sync.RWMutex
+	subscribers map[string]map[*Subscription]bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: make(map[string]map[*Subscription]bool)}
+}
+
+func (broker *MemoryBroker) Publish(topic string, data []byte) error {
+	broker.mutex.RLock()
+	defer broker.mutex.RUnlock()
+	for sub := range broker.subscribers[topic] {
+		select {
+		case sub.C <- data:
+		default:
+			// Never let a slow subscriber hold up the publisher
+			log.Println("Dropping event for slow subscriber of", topic)
+		}
+	}
+	return nil
+}
+
+func (broker *MemoryBroker) Subscribe(topic string) *Subscription {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	sub := &Subscription{Topic: topic, C: make(chan []byte, subscriptionBufferSize)}
+	if broker.subscribers[topic] == nil {
+		broker.subscribers[topic] = make(map[*Subscription]bool)
+	}
+	broker.subscribers[topic][sub] = true
+	return sub
+}
+
+func (broker *MemoryBroker) Unsubscribe(sub *Subscription) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	if _, ok := broker.subscribers[sub.Topic][sub]; !ok {
+		return
+	}
+	delete(broker.subscribers[sub.Topic], sub)
+	if len(broker.subscribers[sub.Topic]) == 0 {
+		delete(broker.subscribers, sub.Topic)
+	}
+	close(sub.C)
+}
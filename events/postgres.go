@@ -0,0 +1,102 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"github.com/kayprogrammer/socialnet-v6/database"
+	"gorm.io/gorm"
+)
+
+// Postgres channel every replica publishes to and listens on
+const postgresChannel = "socialnet_events"
+
+// Postgres rejects NOTIFY payloads of 8000 bytes or more
+const maxPostgresPayload = 7999
+
+type postgresEnvelope struct {
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// PostgresBroker publishes events with NOTIFY and hands whatever it gets from LISTEN
+// to local subscribers, so an event published on one replica reaches sockets on all of them.
+type PostgresBroker struct {
+	db    *gorm.DB
+	dsn   string
+	local *MemoryBroker
+}
+
+func NewPostgresBroker(cfg config.Config, db *gorm.DB) (*PostgresBroker, error) {
+	broker := &PostgresBroker{db: db, dsn: database.GetDsn(cfg), local: NewMemoryBroker()}
+	conn, err := broker.listen()
+	if err != nil {
+		return nil, err
+	}
+	go broker.run(conn)
+	return broker, nil
+}
+
+// Event data must be valid JSON
+func (broker *PostgresBroker) Publish(topic string, data []byte) error {
+	payload, err := json.Marshal(postgresEnvelope{Topic: topic, Data: data})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPostgresPayload {
+		return fmt.Errorf("event on %s is too large to publish (%d bytes)", topic, len(payload))
+	}
+	return broker.db.Exec("SELECT pg_notify(?, ?)", postgresChannel, string(payload)).Error
+}
+
+func (broker *PostgresBroker) Subscribe(topic string) *Subscription {
+	return broker.local.Subscribe(topic)
+}
+
+func (broker *PostgresBroker) Unsubscribe(sub *Subscription) {
+	broker.local.Unsubscribe(sub)
+}
+
+func (broker *PostgresBroker) listen() (*pgx.Conn, error) {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, broker.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Exec(ctx, "LISTEN "+postgresChannel); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Forwards notifications to local subscribers, reconnecting whenever the listening connection drops
+func (broker *PostgresBroker) run(conn *pgx.Conn) {
+	ctx := context.Background()
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			log.Println("Event listener error: ", err)
+			conn.Close(ctx)
+			for {
+				time.Sleep(time.Second)
+				if conn, err = broker.listen(); err == nil {
+					break
+				}
+				log.Println("Event listener reconnection error: ", err)
+			}
+			continue
+		}
+		envelope := postgresEnvelope{}
+		if err := json.Unmarshal([]byte(notification.Payload), &envelope); err != nil {
+			log.Println("Invalid event payload: ", err)
+			continue
+		}
+		broker.local.Publish(envelope.Topic, envelope.Data)
+	}
+}
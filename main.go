@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/gofiber/contrib/swagger"
 	"github.com/gofiber/contrib/websocket"
@@ -10,7 +11,9 @@ import (
 	"github.com/kayprogrammer/socialnet-v6/config"
 	"github.com/kayprogrammer/socialnet-v6/database"
 	"github.com/kayprogrammer/socialnet-v6/initials"
+	"github.com/kayprogrammer/socialnet-v6/managers"
 	"github.com/kayprogrammer/socialnet-v6/routes"
+	"github.com/kayprogrammer/socialnet-v6/storage"
 
 	_ "github.com/kayprogrammer/socialnet-v6/docs"
 )
@@ -32,7 +35,18 @@ func main() {
 	sqlDb, _ := db.DB()
 	initials.CreateInitialData(cfg, db)
 
-	app := fiber.New()
+	// Clear out uploads that were never completed
+	go managers.FileManager{}.SweepPending(db, time.Duration(cfg.PendingFileExpireMinutes)*time.Minute)
+
+	// Keep this instance's sockets counted, and drop those of instances that are gone
+	go managers.PresenceManager{}.Heartbeat(db)
+
+	// Purge deleted accounts once their grace period is over
+	go managers.AccountManager{}.SweepDeactivated(db, time.Duration(cfg.AccountDeletionGraceDays)*24*time.Hour)
+
+	// Room for the largest upload, for when files are kept locally
+	// Client IPs come from the proxy header when behind a reverse proxy
+	app := fiber.New(routes.ProxyConfig(cfg, fiber.Config{BodyLimit: int(storage.MaxUploadSize())}))
 
 	// CORS config
 	app.Use(cors.New(cors.Config{
@@ -0,0 +1,353 @@
+package managers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ----------------------------------
+// SESSION MANAGEMENT
+// --------------------------------
+type SessionManager struct {
+}
+
+func (obj SessionManager) Create(db *gorm.DB, user models.User, deviceName string, ipAddress string, userAgent string) models.Session {
+	session := models.Session{
+		UserId:     user.ID,
+		DeviceName: deviceName,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		LastUsedAt: time.Now(),
+	}
+	db.Create(&session)
+	return session
+}
+
+func (obj SessionManager) GetByID(db *gorm.DB, id uuid.UUID) *models.Session {
+	session := models.Session{}
+	db.Where("id = ?", id).Take(&session)
+	if session.ID == nil {
+		return nil
+	}
+	return &session
+}
+
+func (obj SessionManager) GetUserSessions(db *gorm.DB, user models.User) []models.Session {
+	sessions := []models.Session{}
+	db.Where(models.Session{UserId: user.ID}).Order("last_used_at DESC").Find(&sessions)
+	for i := range sessions {
+		sessions[i] = sessions[i].Init(user.SessionId)
+	}
+	return sessions
+}
+
+func (obj SessionManager) GetUserSession(db *gorm.DB, user models.User, id uuid.UUID) (*models.Session, *int, *utils.ErrorResponse) {
+	session := models.Session{}
+	db.Where(models.Session{UserId: user.ID}).Where("id = ?", id).Take(&session)
+	if session.ID == nil {
+		status := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Session does not exist")
+		return nil, &status, &errData
+	}
+	return &session, nil, nil
+}
+
+// Swaps the session's refresh token for a new one. It only succeeds if oldToken is still the current
+// token, so that two requests racing with the same token can't both rotate it.
+func (obj SessionManager) Rotate(db *gorm.DB, session *models.Session, oldToken string, newToken string, ipAddress string, userAgent string) bool {
+	now := time.Now()
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND refresh_hash = ?", session.ID, utils.HashToken(oldToken)).
+		Updates(map[string]interface{}{
+			"refresh_hash": utils.HashToken(newToken),
+			"ip_address":   ipAddress,
+			"user_agent":   userAgent,
+			"last_used_at": now,
+		})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	session.LastUsedAt = now
+	return true
+}
+
+// Marks the session as used, at most once a minute to avoid a write on every request
+func (obj SessionManager) Touch(db *gorm.DB, session models.Session) {
+	if time.Since(session.LastUsedAt) > time.Minute {
+		db.Model(&session).UpdateColumn("last_used_at", time.Now())
+	}
+}
+
+// Deletes the session, which invalidates every access and refresh token issued for it
+func (obj SessionManager) Revoke(db *gorm.DB, session models.Session) {
+	db.Delete(&session)
+}
+
+func (obj SessionManager) RevokeAll(db *gorm.DB, user models.User) {
+	db.Where(models.Session{UserId: user.ID}).Delete(&models.Session{})
+}
+
+// ----------------------------------
+// PRESENCE MANAGEMENT
+// --------------------------------
+type PresenceManager struct {
+}
+
+// This app instance, so the sockets it holds are told apart from those of the others
+var instanceID = uuid.NewRandom()
+
+// How often an instance refreshes the heartbeat of its sockets, and how long before those of a silent one expire
+const presenceHeartbeatInterval = 30 * time.Second
+const presenceExpiry = 2 * time.Minute
+
+// Counts a new socket connection for the user and reports whether they just came online.
+// The count lives in the database so every app instance sees the same presence.
+func (obj PresenceManager) Connect(db *gorm.DB, user *models.User) bool {
+	now := time.Now()
+	db.Transaction(func(tx *gorm.DB) error {
+		tx.Exec(`INSERT INTO socket_connections (instance_id, user_id, sockets, heartbeat_at, created_at, updated_at)
+			VALUES (?, ?, 1, ?, ?, ?)
+			ON CONFLICT (instance_id, user_id) DO UPDATE SET sockets = socket_connections.sockets + 1, updated_at = EXCLUDED.updated_at`,
+			instanceID, user.ID, now, now, now)
+		return tx.Raw("UPDATE users SET online_sockets = online_sockets + 1, last_seen_at = ? WHERE id = ? RETURNING online_sockets, last_seen_at", now, user.ID).
+			Row().Scan(&user.OnlineSockets, &user.LastSeenAt)
+	})
+	return user.OnlineSockets == 1
+}
+
+// Drops a socket connection of the user and reports whether they just went offline
+func (obj PresenceManager) Disconnect(db *gorm.DB, user *models.User) bool {
+	now := time.Now()
+	db.Transaction(func(tx *gorm.DB) error {
+		connection := models.SocketConnection{}
+		tx.Model(&connection).Clauses(clause.Returning{}).Where("instance_id = ? AND user_id = ?", instanceID, user.ID).
+			UpdateColumn("sockets", gorm.Expr("sockets - 1"))
+		// Sockets that expired were taken off already
+		dropped := 0
+		if connection.ID != nil {
+			dropped = 1
+			if connection.Sockets <= 0 {
+				tx.Delete(&connection)
+			}
+		}
+		return tx.Raw("UPDATE users SET online_sockets = GREATEST(online_sockets - ?, 0), last_seen_at = ? WHERE id = ? RETURNING online_sockets, last_seen_at", dropped, now, user.ID).
+			Row().Scan(&user.OnlineSockets, &user.LastSeenAt)
+	})
+	return user.OnlineSockets == 0
+}
+
+// Takes the sockets whose heartbeat is older than maxAge off their users' online counts. Those are
+// of instances that crashed or were redeployed, and whose users would otherwise stay online forever.
+// Returns how many users it touched
+func (obj PresenceManager) DropExpired(db *gorm.DB, maxAge time.Duration) int {
+	expired := []models.SocketConnection{}
+	db.Transaction(func(tx *gorm.DB) error {
+		// Deleting them first keeps two instances from taking the same sockets off twice
+		tx.Clauses(clause.Returning{}).Where("heartbeat_at < ?", time.Now().Add(-maxAge)).Delete(&expired)
+		for _, connection := range expired {
+			tx.Exec("UPDATE users SET online_sockets = GREATEST(online_sockets - ?, 0) WHERE id = ?", connection.Sockets, connection.UserID)
+		}
+		return nil
+	})
+	return len(expired)
+}
+
+// Refreshes the heartbeat of this instance's sockets and runs DropExpired, for as long as the app is up
+func (obj PresenceManager) Heartbeat(db *gorm.DB) {
+	for range time.Tick(presenceHeartbeatInterval) {
+		db.Model(&models.SocketConnection{}).Where("instance_id = ?", instanceID).UpdateColumn("heartbeat_at", time.Now())
+		if dropped := obj.DropExpired(db, presenceExpiry); dropped > 0 {
+			log.Printf("Dropped the expired sockets of %d users", dropped)
+		}
+	}
+}
+
+// ----------------------------------
+// LOGIN LOCKOUT MANAGEMENT
+// --------------------------------
+type LockoutManager struct {
+}
+
+// Longest an account can be locked for
+const maxLockout = 24 * time.Hour
+
+// Counts a bad password for the user. Past maxAttempts each further failure locks the account
+// for twice as long as the one before it, starting from baseLockout.
+func (obj LockoutManager) RecordFailure(db *gorm.DB, user *models.User, maxAttempts int, baseLockout time.Duration) {
+	db.Raw("UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins", user.ID).
+		Row().Scan(&user.FailedLogins)
+	if user.FailedLogins < maxAttempts {
+		return
+	}
+	lockout := baseLockout
+	for i := maxAttempts; i < user.FailedLogins && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxLockout {
+		lockout = maxLockout
+	}
+	lockedUntil := time.Now().Add(lockout)
+	user.LockedUntil = &lockedUntil
+	db.Model(user).UpdateColumn("locked_until", lockedUntil)
+}
+
+func (obj LockoutManager) Reset(db *gorm.DB, user *models.User) {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return
+	}
+	user.FailedLogins, user.LockedUntil = 0, nil
+	db.Model(user).UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+}
+
+// ----------------------------------
+// TWO-FACTOR AUTH MANAGEMENT
+// --------------------------------
+type TwoFactorManager struct {
+}
+
+// Recovery codes handed out each time 2FA is turned on
+const recoveryCodesCount = 10
+
+// Starts (or restarts) enrolment with a fresh secret. 2FA stays off until a code from it is verified
+func (obj TwoFactorManager) Setup(db *gorm.DB, user *models.User) string {
+	secret := utils.GenerateTotpSecret()
+	user.TotpSecret, user.TotpEnabled, user.TotpLastStep = &secret, false, 0
+	db.Model(user).UpdateColumns(map[string]interface{}{"totp_secret": secret, "totp_enabled": false, "totp_last_step": 0})
+	return secret
+}
+
+// Checks a TOTP code of the user. Each time step is only accepted once, even across concurrent requests
+func (obj TwoFactorManager) VerifyTotp(db *gorm.DB, user *models.User, code string) bool {
+	if user.TotpSecret == nil {
+		return false
+	}
+	step, ok := utils.MatchTotpCode(*user.TotpSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	result := db.Model(user).Where("totp_last_step < ?", step).UpdateColumn("totp_last_step", step)
+	return result.RowsAffected == 1
+}
+
+// Uses up one of the user's recovery codes
+func (obj TwoFactorManager) UseRecoveryCode(db *gorm.DB, user models.User, code string) bool {
+	result := db.Where(models.RecoveryCode{UserId: user.ID, CodeHash: utils.HashRecoveryCode(code)}).Delete(&models.RecoveryCode{})
+	return result.RowsAffected == 1
+}
+
+// Accepts either a TOTP code or a recovery code
+func (obj TwoFactorManager) VerifyCode(db *gorm.DB, user *models.User, code string) bool {
+	return obj.VerifyTotp(db, user, code) || obj.UseRecoveryCode(db, *user, code)
+}
+
+// Turns 2FA on and returns a new set of recovery codes, replacing any older ones
+func (obj TwoFactorManager) Enable(db *gorm.DB, user *models.User) []string {
+	user.TotpEnabled = true
+	db.Model(user).UpdateColumn("totp_enabled", true)
+
+	db.Where(models.RecoveryCode{UserId: user.ID}).Delete(&models.RecoveryCode{})
+	codes := []string{}
+	recoveryCodes := []models.RecoveryCode{}
+	for i := 0; i < recoveryCodesCount; i++ {
+		code := utils.GenerateRecoveryCode()
+		codes = append(codes, code)
+		recoveryCodes = append(recoveryCodes, models.RecoveryCode{UserId: user.ID, CodeHash: utils.HashRecoveryCode(code)})
+	}
+	db.Omit("User").Create(&recoveryCodes)
+	return codes
+}
+
+func (obj TwoFactorManager) Disable(db *gorm.DB, user *models.User) {
+	user.TotpSecret, user.TotpEnabled, user.TotpLastStep = nil, false, 0
+	db.Model(user).UpdateColumns(map[string]interface{}{"totp_secret": nil, "totp_enabled": false, "totp_last_step": 0})
+	db.Where(models.RecoveryCode{UserId: user.ID}).Delete(&models.RecoveryCode{})
+}
+
+// ----------------------------------
+// ACCOUNT STATUS MANAGEMENT
+// --------------------------------
+type AccountManager struct {
+}
+
+// How often accounts whose grace period is over are looked for
+const accountPurgeInterval = time.Hour
+
+// Condition for the users who are neither suspended nor deactivated
+func ActiveUsersScope(db *gorm.DB) *gorm.DB {
+	return db.Where("NOT users.is_suspended AND users.deactivated_at IS NULL")
+}
+
+// Subquery of the IDs of the users who are suspended or deactivated
+func (obj AccountManager) GetInactiveIDs(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.User{}).Select("id").
+		Where("is_suspended OR deactivated_at IS NOT NULL")
+}
+
+// Deactivates the user and logs them out everywhere. Nothing of theirs is deleted till the grace period is over
+func (obj AccountManager) Deactivate(db *gorm.DB, user *models.User) {
+	now := time.Now()
+	user.DeactivatedAt = &now
+	db.Transaction(func(tx *gorm.DB) error {
+		SessionManager{}.RevokeAll(tx, *user)
+		return tx.Model(user).UpdateColumn("deactivated_at", now).Error
+	})
+}
+
+// Restores the account if the user deactivated it, reporting whether they did
+func (obj AccountManager) Restore(db *gorm.DB, user *models.User) bool {
+	if user.DeactivatedAt == nil {
+		return false
+	}
+	user.DeactivatedAt = nil
+	db.Model(user).UpdateColumn("deactivated_at", nil)
+	return true
+}
+
+// Deletes the users who deactivated their accounts longer than gracePeriod ago, with everything of theirs.
+// Rows of the join tables don't go with them by themselves, so those are cleared first. Returns how many were deleted
+func (obj AccountManager) PurgeDeactivated(db *gorm.DB, gracePeriod time.Duration) int {
+	cutoff := time.Now().Add(-gracePeriod)
+	users := []models.User{}
+	db.Where("deactivated_at < ?", cutoff).Find(&users)
+	purged := 0
+	for _, user := range users {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Skips the user if they logged in since
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("deactivated_at < ?", cutoff).Take(&models.User{}, "id = ?", user.ID).Error; err != nil {
+				return err
+			}
+			sentNotificationIDs := tx.Model(&models.Notification{}).Select("id").Where("sender_id = ?", user.ID)
+			ownedChatIDs := tx.Model(&models.Chat{}).Select("id").Where("owner_id = ?", user.ID)
+			tx.Exec("DELETE FROM notification_receivers WHERE user_id = ? OR notification_id IN (?)", user.ID, sentNotificationIDs)
+			tx.Exec("DELETE FROM notification_read_by WHERE user_id = ? OR notification_id IN (?)", user.ID, sentNotificationIDs)
+			tx.Exec("DELETE FROM chat_users WHERE user_id = ? OR chat_id IN (?)", user.ID, ownedChatIDs)
+
+			// Plain reposts of their posts have nothing left to show
+			tx.Where("original_post_id IN (?) AND NOT is_quote", tx.Model(&models.Post{}).Select("id").Where("author_id = ?", user.ID)).
+				Delete(&models.Post{})
+			return tx.Delete(&user).Error
+		})
+		if err == nil {
+			purged++
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("Error purging user: ", err)
+		}
+	}
+	return purged
+}
+
+// Runs PurgeDeactivated for as long as the app is up
+func (obj AccountManager) SweepDeactivated(db *gorm.DB, gracePeriod time.Duration) {
+	for range time.Tick(accountPurgeInterval) {
+		if purged := obj.PurgeDeactivated(db, gracePeriod); purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+	}
+}
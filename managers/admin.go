@@ -0,0 +1,119 @@
+package managers
+
+import (
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"gorm.io/gorm"
+)
+
+// ----------------------------------
+// ADMIN MANAGEMENT
+// --------------------------------
+type AdminManager struct {
+}
+
+// Edits the site details, recording the change
+func (obj AdminManager) UpdateSiteDetail(db *gorm.DB, superuser models.User, data schemas.SiteDetailUpdateSchema) models.SiteDetail {
+	siteDetail := models.SiteDetail{}
+	db.FirstOrCreate(&siteDetail, siteDetail)
+	data.SetValues(&siteDetail)
+	db.Save(&siteDetail)
+	AuditLogManager{}.Create(db, superuser, choices.AASITEDETAILSET, nil, nil, nil)
+	return siteDetail
+}
+
+// Users matching the filters. The search is on names, usernames and emails
+func (obj AdminManager) GetUsers(db *gorm.DB, filters schemas.UserFilterSchema) *gorm.DB {
+	q := db.Model(&models.User{}).Joins("AvatarObj").Joins("CityObj")
+	if filters.Search != "" {
+		search := "%" + filters.Search + "%"
+		q = q.Where("users.first_name || ' ' || users.last_name ILIKE ? OR users.username ILIKE ? OR users.email ILIKE ?", search, search, search)
+	}
+	if filters.IsEmailVerified != nil {
+		q = q.Where("users.is_email_verified = ?", *filters.IsEmailVerified)
+	}
+	if filters.IsStaff != nil {
+		q = q.Where("users.is_staff = ?", *filters.IsStaff)
+	}
+	if filters.IsSuperuser != nil {
+		q = q.Where("users.is_superuser = ?", *filters.IsSuperuser)
+	}
+	if filters.IsSuspended != nil {
+		q = q.Where("users.is_suspended = ?", *filters.IsSuspended)
+	}
+	return q
+}
+
+// User for a superuser to act on. Superusers can't act on their own account, so they can't lock themselves out
+func (obj AdminManager) GetUser(db *gorm.DB, superuser models.User, username string) (*models.User, *int, *utils.ErrorResponse) {
+	user := models.User{Username: username}
+	db.Joins("AvatarObj").Joins("CityObj").Take(&user, user)
+	if user.ID == nil {
+		statusCode := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "No user with that username")
+		return nil, &statusCode, &errData
+	}
+	if user.ID.String() == superuser.ID.String() {
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "You can't manage your own account here")
+		return nil, &statusCode, &errData
+	}
+	return &user, nil, nil
+}
+
+// Changes the flags that are set and different from the user's, recording each change
+func (obj AdminManager) UpdateUser(db *gorm.DB, superuser models.User, user *models.User, data schemas.AdminUserUpdateSchema) (*models.User, *int, *utils.ErrorResponse) {
+	if data.IsSuspended != nil && *data.IsSuspended && user.IsSuperuser {
+		statusCode := 403
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "Superusers can't be suspended")
+		return nil, &statusCode, &errData
+	}
+
+	actions := []choices.AuditActionChoice{}
+	if data.IsEmailVerified != nil && *data.IsEmailVerified != user.IsEmailVerified {
+		user.IsEmailVerified = *data.IsEmailVerified
+		action := choices.AAEMAILVERIFIED
+		if !user.IsEmailVerified {
+			action = choices.AAEMAILUNVERIFIED
+		}
+		actions = append(actions, action)
+	}
+	if data.IsStaff != nil && *data.IsStaff != user.IsStaff {
+		user.IsStaff = *data.IsStaff
+		action := choices.AASTAFFGRANTED
+		if !user.IsStaff {
+			action = choices.AASTAFFREVOKED
+		}
+		actions = append(actions, action)
+	}
+	if data.IsSuspended != nil && *data.IsSuspended != user.IsSuspended {
+		user.IsSuspended = *data.IsSuspended
+		action := choices.AAUSERSUSPENDED
+		if !user.IsSuspended {
+			action = choices.AAUSERREACTIVATED
+		}
+		actions = append(actions, action)
+	}
+	if len(actions) == 0 {
+		return user, nil, nil
+	}
+
+	db.Transaction(func(tx *gorm.DB) error {
+		for _, action := range actions {
+			if action == choices.AAUSERSUSPENDED {
+				SessionManager{}.RevokeAll(tx, *user) // Logs them out everywhere
+			}
+			AuditLogManager{}.Create(tx, superuser, action, nil, &user.ID, nil)
+		}
+		return tx.Model(user).Select("IsEmailVerified", "IsStaff", "IsSuspended").Updates(user).Error
+	})
+	return user, nil, nil
+}
+
+// Ends every session of the user, so none of their tokens work anymore
+func (obj AdminManager) Logout(db *gorm.DB, superuser models.User, user models.User) {
+	SessionManager{}.RevokeAll(db, user)
+	AuditLogManager{}.Create(db, superuser, choices.AAUSERLOGGEDOUT, nil, &user.ID, nil)
+}
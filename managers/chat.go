@@ -1,6 +1,8 @@
 package managers
 
 import (
+	"time"
+
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
@@ -21,22 +23,52 @@ func MessageSenderFileScope(db *gorm.DB) *gorm.DB {
 }
 
 func ChatPreloadMessagesScope(db *gorm.DB) *gorm.DB {
+	// Only the latest message of each chat is needed (for the chat preview)
 	return db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
-		return tx.Scopes(MessageSenderFileScope).Order("messages.created_at DESC")
+		return tx.Scopes(MessageSenderFileScope).
+			Where("messages.id = (SELECT m.id FROM messages m WHERE m.chat_id = messages.chat_id AND NOT m.is_hidden ORDER BY m.created_at DESC LIMIT 1)")
 	})
 }
 
 type ChatManager struct {
 }
 
-func (obj ChatManager) GetUserChats(db *gorm.DB, user models.User) []models.Chat {
-	chats := []models.Chat{}
-	db.Model(&models.Chat{}).
-		Where(models.Chat{OwnerID: user.ID}).
-		Or("chats.id IN (?)", db.Table("chat_users").Select("chat_id").Where("user_id = ?", user.ID)).
-		Scopes(ChatOwnerImageScope, ChatPreloadMessagesScope).
-		Find(&chats)
-	return chats
+// Condition matching the chats a user belongs to, either as the owner or as a member
+func (obj ChatManager) UserIsInChat(db *gorm.DB, user models.User) *gorm.DB {
+	return db.Where(models.Chat{OwnerID: user.ID}).
+		Or("chats.id IN (?)", db.Table("chat_users").Select("chat_id").Where("user_id = ?", user.ID))
+}
+
+func (obj ChatManager) GetUserChats(db *gorm.DB, user models.User) *gorm.DB {
+	return db.Model(&models.Chat{}).
+		Where(obj.UserIsInChat(db, user)).
+		Scopes(ChatOwnerImageScope, ChatPreloadMessagesScope)
+}
+
+func (obj ChatManager) GetUserChatIDs(db *gorm.DB, user models.User) []uuid.UUID {
+	chatIDs := []uuid.UUID{}
+	db.Model(&models.Chat{}).Where(obj.UserIsInChat(db, user)).Pluck("chats.id", &chatIDs)
+	return chatIDs
+}
+
+// Number of messages in each of the chats that others sent and the user hasn't read yet
+func (obj ChatManager) GetUnreadCounts(db *gorm.DB, user models.User, chatIDs []uuid.UUID) map[string]int64 {
+	rows := []struct {
+		ChatID uuid.UUID
+		Count  int64
+	}{}
+	readReceipts := db.Model(&models.MessageReceipt{}).Select("1").
+		Where("message_receipts.message_id = messages.id AND message_receipts.user_id = ? AND message_receipts.read_at IS NOT NULL", user.ID)
+	db.Model(&models.Message{}).Select("messages.chat_id, COUNT(*) AS count").
+		Where("messages.chat_id IN ? AND messages.sender_id <> ?", chatIDs, user.ID).
+		Where("NOT EXISTS (?)", readReceipts).
+		Group("messages.chat_id").Scan(&rows)
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.ChatID.String()] = row.Count
+	}
+	return counts
 }
 
 func (obj ChatManager) GetByID(db *gorm.DB, id uuid.UUID) models.Chat {
@@ -82,7 +114,7 @@ func (obj ChatManager) CreateGroup(db *gorm.DB, owner models.User, usersToAdd []
 	fileType := data.FileType
 	if fileType != nil {
 		var fileType string = *data.FileType
-		image := models.File{ResourceType: fileType}
+		image := models.NewFile("groups", fileType, owner.ID)
 		db.Create(&image)
 		chat.ImageID = &image.ID
 		chat.ImageObj = &image
@@ -91,11 +123,13 @@ func (obj ChatManager) CreateGroup(db *gorm.DB, owner models.User, usersToAdd []
 	return chat
 }
 
+// Pass the requesting user's ID as excludeOpts to leave them out, along with users a block stands between them and
 func (obj ChatManager) GetByUsernames(db *gorm.DB, usernames []string, excludeOpts ...uuid.UUID) []models.User {
 	users := []models.User{}
 	usersQ := db.Where("username IN ?", usernames)
 	if len(excludeOpts) > 0 {
-		usersQ = usersQ.Not("id = ?", excludeOpts[0])
+		blockedIDs := BlockManager{}.GetBlockedIDs(db, models.User{BaseModel: models.BaseModel{ID: excludeOpts[0]}})
+		usersQ = usersQ.Not("id = ?", excludeOpts[0]).Not("id IN (?)", blockedIDs)
 	}
 	usersQ.Find(&users)
 	return users
@@ -110,8 +144,9 @@ func (obj ChatManager) UsernamesToAddAndRemoveValidations(db *gorm.DB, chat *mod
 	usersToAdd := []models.User{}
 	if usernamesToAdd != nil {
 		var usernamesToAdd []string = *usernamesToAdd
+		blockedIDs := BlockManager{}.GetBlockedIDs(db, models.User{BaseModel: models.BaseModel{ID: chat.OwnerID}})
 		db.Where("username IN ?", usernamesToAdd).Not(
-			db.Where("users.id = ?", chat.OwnerID).Or("users.id IN ?", originalExistingUserIDs),
+			db.Where("users.id = ?", chat.OwnerID).Or("users.id IN ?", originalExistingUserIDs).Or("users.id IN (?)", blockedIDs),
 		).Joins("AvatarObj").Find(&usersToAdd)
 		expectedUserTotal += len(usersToAdd)
 	}
@@ -157,7 +192,7 @@ func (obj ChatManager) UpdateGroup(db *gorm.DB, chat *models.Chat, data schemas.
 	// Handle file upload
 	if data.FileType != nil {
 		// Create or Update Image Object
-		image := models.File{ResourceType: *data.FileType}.UpdateOrCreate(db, chat.ImageID)
+		image := models.NewFile("groups", *data.FileType, chat.OwnerID).UpdateOrCreate(db, chat.ImageID, "groups")
 		chat.ImageID = &image.ID
 		chat.ImageObj = &image
 	}
@@ -167,16 +202,14 @@ func (obj ChatManager) UpdateGroup(db *gorm.DB, chat *models.Chat, data schemas.
 
 func (obj ChatManager) GetSingleUserChat(db *gorm.DB, user models.User, id uuid.UUID) models.Chat {
 	chat := models.Chat{}
-	db.Model(&models.Chat{}).Where("chats.id = ?", id).Where(db.Where(models.Chat{OwnerID: user.ID}).
-		Or("chats.id IN (?)", db.Table("chat_users").Select("chat_id").Where("user_id = ?", user.ID))).
+	db.Model(&models.Chat{}).Where("chats.id = ?", id).Where(obj.UserIsInChat(db, user)).
 		Take(&chat)
 	return chat
 }
 
 func (obj ChatManager) GetSingleUserChatFullDetails(db *gorm.DB, user models.User, id uuid.UUID) models.Chat {
 	chat := models.Chat{} // Wahala wa o
-	db.Model(&models.Chat{}).Where("chats.id = ?", id).Where(db.Where(models.Chat{OwnerID: user.ID}).
-		Or("chats.id IN (?)", db.Table("chat_users").Select("chat_id").Where("user_id = ?", user.ID))).
+	db.Model(&models.Chat{}).Where("chats.id = ?", id).Where(obj.UserIsInChat(db, user)).
 		Scopes(ChatOwnerImageScope, ChatPreloadMessagesScope).
 		Preload("UserObjs").
 		Take(&chat)
@@ -217,7 +250,7 @@ type MessageManager struct {
 func (obj MessageManager) Create(db *gorm.DB, sender models.User, chat models.Chat, text *string, fileType *string) models.Message {
 	message := models.Message{SenderID: sender.ID, SenderObj: sender, ChatID: chat.ID, ChatObj: chat, Text: text}
 	if fileType != nil {
-		file := models.File{ResourceType: *fileType}
+		file := models.NewFile("messages", *fileType, sender.ID)
 		db.Create(&file)
 		message.FileID = &file.ID
 		message.FileObj = &file
@@ -226,6 +259,10 @@ func (obj MessageManager) Create(db *gorm.DB, sender models.User, chat models.Ch
 	return message
 }
 
+func (obj MessageManager) GetChatMessages(db *gorm.DB, chatID uuid.UUID) *gorm.DB {
+	return db.Model(&models.Message{}).Scopes(MessageSenderFileScope).Where(models.Message{ChatID: chatID}).Where("NOT messages.is_hidden")
+}
+
 func (obj MessageManager) GetUserMessage(db *gorm.DB, user models.User, id uuid.UUID) models.Message {
 	message := models.Message{SenderID: user.ID}
 	db.Scopes(MessageSenderScope).Take(&message, models.Message{BaseModel: models.BaseModel{ID: id}})
@@ -235,7 +272,7 @@ func (obj MessageManager) GetUserMessage(db *gorm.DB, user models.User, id uuid.
 func (obj MessageManager) Update(db *gorm.DB, message models.Message, text *string, fileType *string) models.Message {
 	if fileType != nil {
 		// Create or Update Image Object
-		file := models.File{ResourceType: *fileType}.UpdateOrCreate(db, message.FileID)
+		file := models.NewFile("messages", *fileType, message.SenderID).UpdateOrCreate(db, message.FileID, "messages")
 		message.FileID = &file.ID
 		message.FileObj = &file
 	}
@@ -255,3 +292,35 @@ func (obj MessageManager) GetByID(db *gorm.DB, id uuid.UUID) models.Message {
 func (obj MessageManager) DropData(db *gorm.DB) {
 	db.Delete(&models.Message{})
 }
+
+// ----------------------------------
+// MESSAGE RECEIPT MANAGEMENT
+// --------------------------------
+type MessageReceiptManager struct {
+}
+
+// Marks the message as delivered to (or read by) the user, together with every earlier message
+// of the chat from others, since a client only acknowledges the latest message it has shown.
+func (obj MessageReceiptManager) Acknowledge(db *gorm.DB, user models.User, message models.Message, read bool) {
+	now := time.Now()
+	column := "delivered_at"
+	var readAt *time.Time
+	if read {
+		column = "read_at"
+		readAt = &now
+	}
+	db.Exec(`INSERT INTO message_receipts (message_id, user_id, delivered_at, read_at, created_at, updated_at)
+		SELECT m.id, CAST(@user AS uuid), CAST(@now AS timestamptz), CAST(@readAt AS timestamptz), CAST(@now AS timestamptz), CAST(@now AS timestamptz) FROM messages m
+		WHERE m.chat_id = @chat AND m.sender_id <> @user AND m.created_at <= @createdAt
+		AND NOT EXISTS (SELECT 1 FROM message_receipts r WHERE r.message_id = m.id AND r.user_id = @user AND r.`+column+` IS NOT NULL)
+		ON CONFLICT (message_id, user_id) DO UPDATE SET
+		delivered_at = COALESCE(message_receipts.delivered_at, EXCLUDED.delivered_at),
+		read_at = COALESCE(message_receipts.read_at, EXCLUDED.read_at),
+		updated_at = EXCLUDED.updated_at`,
+		map[string]interface{}{"user": user.ID, "now": now, "readAt": readAt, "chat": message.ChatID, "createdAt": message.CreatedAt},
+	)
+}
+
+func (obj MessageReceiptManager) DropData(db *gorm.DB) {
+	db.Delete(&models.MessageReceipt{})
+}
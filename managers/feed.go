@@ -2,9 +2,11 @@ package managers
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gosimple/slug"
+	"github.com/kayprogrammer/socialnet-v6/config"
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
@@ -18,8 +20,36 @@ func AuthorAvatarScope(db *gorm.DB) *gorm.DB {
 	return db.Joins("AuthorObj").Joins("AuthorObj.AvatarObj")
 }
 
-func AuthorReactionScope(db *gorm.DB) *gorm.DB {
-	return db.Scopes(AuthorAvatarScope).Preload("Reactions")
+// Loads reactions grouped by type, so each type comes once with its count in Total instead of
+// every reaction. column is the reactions' key to what they're on (post_id or comment_id)
+func GroupedReactions(column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select(column + ", rtype, COUNT(*) AS total").Group(column + ", rtype")
+	}
+}
+
+func PostAuthorReactionScope(db *gorm.DB) *gorm.DB {
+	return db.Scopes(AuthorAvatarScope).Preload("Reactions", GroupedReactions("post_id"))
+}
+
+func CommentAuthorReactionScope(db *gorm.DB) *gorm.DB {
+	return db.Scopes(AuthorAvatarScope).Preload("Reactions", GroupedReactions("comment_id"))
+}
+
+func PostMediaScope(db *gorm.DB) *gorm.DB {
+	return db.Preload("MediaObjs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("MediaObjs.FileObj")
+}
+
+// Loads the post that a repost or quote shares, with what is shown of it. Only public posts can be
+// shared, so an original that stopped being public is left out
+func OriginalPostScope(db *gorm.DB) *gorm.DB {
+	return db.Preload("OriginalPostObj", "visibility = ? AND NOT is_hidden", choices.PVPUBLIC).
+		Preload("OriginalPostObj.AuthorObj.AvatarObj").Preload("OriginalPostObj.Reactions", GroupedReactions("post_id")).
+		Preload("OriginalPostObj.MediaObjs", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).Preload("OriginalPostObj.MediaObjs.FileObj")
 }
 
 // ----------------------------------
@@ -28,35 +58,193 @@ func AuthorReactionScope(db *gorm.DB) *gorm.DB {
 type PostManager struct {
 }
 
-func (obj PostManager) All(db *gorm.DB) []models.Post {
-	posts := []models.Post{}
-	db.Scopes(AuthorReactionScope).Joins("ImageObj").Preload("Comments").Find(&posts).Order("created_at DESC")
-	return posts
+// Condition for the posts the viewer can see. A nil viewer is a guest, who only sees public posts. Users also
+// see their own, the FRIENDS posts of their friends and the CUSTOM posts whose audience they're in, but
+// nothing of users a block stands between them and. Posts hidden by staff are seen by no one.
+func (obj PostManager) Visible(db *gorm.DB, viewer *models.User) *gorm.DB {
+	db = db.Session(&gorm.Session{NewDB: true})
+	if viewer == nil {
+		return db.Where("posts.visibility = ? AND NOT posts.is_hidden", choices.PVPUBLIC)
+	}
+	friendIDs := FriendManager{}.GetFriendIDs(db, *viewer)
+	audiencePostIDs := db.Table("post_audience").Select("post_id").Where("user_id = ?", viewer.ID)
+	return db.Where(
+		db.Where("posts.visibility = ?", choices.PVPUBLIC).Or("posts.author_id = ?", viewer.ID).
+			Or("posts.visibility = ? AND posts.author_id IN (?)", choices.PVFRIENDS, friendIDs).
+			Or("posts.visibility = ? AND posts.id IN (?)", choices.PVCUSTOM, audiencePostIDs),
+	).Where("NOT posts.is_hidden").Not("posts.author_id IN (?)", BlockManager{}.GetBlockedIDs(db, *viewer))
+}
+
+// IDs of the posts the viewer can see, for queries of what's on them
+func (obj PostManager) VisibleIDs(db *gorm.DB, viewer *models.User) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.Post{}).Select("posts.id").Where(obj.Visible(db, viewer))
+}
+
+// Limits queries of posts to those the viewer can see, and loads the viewer's reactions and bookmarks
+// so the posts show whether the viewer reacted to or bookmarked them. A nil viewer is a guest, who did neither
+func (obj PostManager) ForViewer(db *gorm.DB, viewer *models.User) *gorm.DB {
+	db = db.Where(obj.Visible(db, viewer))
+	if viewer == nil {
+		return db
+	}
+	return db.Preload("ViewerReactions", "user_id = ?", viewer.ID).Preload("Bookmarks", "user_id = ?", viewer.ID).
+		Preload("OriginalPostObj.ViewerReactions", "user_id = ?", viewer.ID).Preload("OriginalPostObj.Bookmarks", "user_id = ?", viewer.ID)
+}
+
+// Scope of users for those who can see the post, besides its author
+func (obj PostManager) AudienceScope(post models.Post) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch post.Visibility {
+		case choices.PVFRIENDS:
+			author := models.User{BaseModel: models.BaseModel{ID: post.AuthorID}}
+			return db.Where("users.id IN (?)", FriendManager{}.GetFriendIDs(db.Session(&gorm.Session{NewDB: true}), author))
+		case choices.PVONLYME:
+			return db.Where("FALSE")
+		case choices.PVCUSTOM:
+			return db.Where("users.id IN (?)", db.Session(&gorm.Session{NewDB: true}).Table("post_audience").Select("user_id").Where("post_id = ?", post.ID))
+		}
+		return db
+	}
+}
+
+// Posts the viewer can see, leaving out those of inactive users and of users they muted. Pass the requesting user as viewer, or nil for a guest
+func (obj PostManager) All(db *gorm.DB, viewer *models.User) *gorm.DB {
+	q := obj.ForViewer(db, viewer).Model(&models.Post{}).Scopes(PostAuthorReactionScope, PostMediaScope, OriginalPostScope).
+		Not("posts.author_id IN (?)", AccountManager{}.GetInactiveIDs(db))
+	if viewer != nil {
+		q = q.Not("posts.author_id IN (?)", BlockManager{}.GetMutedIDs(db, *viewer))
+	}
+	return q
+}
+
+// Posts with the tag in their text
+func (obj PostManager) ByHashtag(db *gorm.DB, tag string, viewer *models.User) *gorm.DB {
+	return obj.All(db, viewer).Where("posts.id IN (?)", db.Model(&models.Hashtag{}).Select("post_id").Where("tag = ?", tag))
 }
 
-func (obj PostManager) Create(db *gorm.DB, author models.User, postData schemas.PostInputSchema) models.Post {
+func (obj PostManager) Timeline(db *gorm.DB, user models.User) *gorm.DB {
+	friendIDs := FriendManager{}.GetFriendIDs(db, user)
+	return obj.All(db, &user).Where(db.Where("posts.author_id = ?", user.ID).Or("posts.author_id IN (?)", friendIDs))
+}
+
+// SQL expression ranking timeline posts. Recency is counted in hours since the epoch (so a post's
+// rank doesn't drift with time) and engagement, from the posts' counters, is dampened logarithmically.
+func (obj PostManager) TimelineRankExpression(cfg config.Config) clause.Expr {
+	return clause.Expr{
+		SQL: "? * EXTRACT(EPOCH FROM posts.created_at) / 3600" +
+			" + ? * LN(1 + posts.reactions_count)" +
+			" + ? * LN(1 + posts.comments_count)",
+		Vars: []interface{}{cfg.TimelineRecencyWeight, cfg.TimelineReactionsWeight, cfg.TimelineCommentsWeight},
+	}
+}
+
+// Error for a post that would end up with more than maxMedia media
+func (obj PostManager) ValidateMediaCount(count int, maxMedia int) (*int, *utils.ErrorResponse) {
+	if count <= maxMedia {
+		return nil, nil
+	}
+	statusCode := 422
+	errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{
+		"file_types": fmt.Sprintf("A post can't have more than %d media", maxMedia),
+	})
+	return &statusCode, &errData
+}
+
+// Adds media of the file types to the end of the post's list
+func (obj PostManager) addMedia(db *gorm.DB, post *models.Post, fileTypes []string) {
+	for _, fileType := range fileTypes {
+		file := models.NewFile("posts", fileType, post.AuthorID)
+		db.Create(&file)
+		media := models.PostMedia{PostID: post.ID, FileID: file.ID, FileObj: file, Position: len(post.MediaObjs)}
+		db.Omit(clause.Associations).Create(&media)
+		post.MediaObjs = append(post.MediaObjs, media)
+	}
+}
+
+// Users of the usernames, who are to see a post of the visibility besides its author.
+// Only CUSTOM posts have an audience, and it can't be empty.
+func (obj PostManager) GetAudience(db *gorm.DB, author models.User, visibility choices.PostVisibilityChoice, usernames *[]string) ([]models.User, *int, *utils.ErrorResponse) {
+	audience := []models.User{}
+	if visibility != choices.PVCUSTOM {
+		return audience, nil, nil
+	}
+	if usernames != nil && len(*usernames) > 0 {
+		db.Where("username IN ?", *usernames).Not("id = ?", author.ID).Find(&audience)
+	}
+	if len(audience) == 0 {
+		statusCode := 422
+		errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{
+			"audience": "Choose who can see the post",
+		})
+		return nil, &statusCode, &errData
+	}
+	return audience, nil, nil
+}
+
+// Replaces who can see the post with the audience
+func (obj PostManager) setAudience(db *gorm.DB, post *models.Post, audience []models.User) {
+	db.Model(post).Omit("AudienceObjs.*").Association("AudienceObjs").Replace(&audience)
+	post.AudienceObjs = audience
+}
+
+// Pass the audience of a CUSTOM post, as got from GetAudience
+func (obj PostManager) Create(db *gorm.DB, author models.User, postData schemas.PostInputSchema, audience ...models.User) models.Post {
 	id := uuid.Parse(uuid.New())
 	// Create slug
 	slug := slug.Make(fmt.Sprintf("%s %s %s", author.FirstName, author.LastName, id))
 	base := models.BaseModel{ID: id}
 	sub_base := models.FeedAbstract{BaseModel: base, Slug: slug, AuthorObj: author, AuthorID: author.ID, Text: postData.Text}
 
-	post := models.Post{FeedAbstract: sub_base}
-	if postData.FileType != nil {
-		file := models.File{ResourceType: *postData.FileType}
-		post.ImageObj = &file
+	visibility := postData.Visibility
+	if visibility == "" {
+		visibility = choices.PVPUBLIC
 	}
+	post := models.Post{FeedAbstract: sub_base, Visibility: visibility}
 	db.Create(&post)
+	obj.addMedia(db, &post, postData.FileTypes)
+	if len(audience) > 0 {
+		obj.setAudience(db, &post, audience)
+	}
 	return post
 }
 
-func (obj PostManager) GetBySlug(db *gorm.DB, slug string, opts ...bool) (*models.Post, *int, *utils.ErrorResponse) {
-	post := models.Post{FeedAbstract: models.FeedAbstract{Slug: slug}}
-	q := db.Scopes(AuthorReactionScope)
-	if len(opts) > 0 { // Detailed param provided.
-		q = q.Preload("Comments")
+// Shares the original post. Without text it's a plain repost, which a user can make only once per post.
+// Sharing a plain repost shares the post it reposts instead.
+func (obj PostManager) Repost(db *gorm.DB, author models.User, original models.Post, text string) (*models.Post, *int, *utils.ErrorResponse) {
+	if original.IsPlainRepost() {
+		if original.OriginalPostObj == nil {
+			statusCode := 404
+			errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Post does not exist")
+			return nil, &statusCode, &errData
+		}
+		original = *original.OriginalPostObj
+	}
+	if original.Visibility != choices.PVPUBLIC {
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "Only public posts can be reposted")
+		return nil, &statusCode, &errData
+	}
+
+	id := uuid.Parse(uuid.New())
+	// Create slug
+	slug := slug.Make(fmt.Sprintf("%s %s %s", author.FirstName, author.LastName, id))
+	base := models.BaseModel{ID: id}
+	sub_base := models.FeedAbstract{BaseModel: base, Slug: slug, AuthorObj: author, AuthorID: author.ID, Text: text}
+
+	post := models.Post{FeedAbstract: sub_base, OriginalPostID: &original.ID, IsQuote: text != ""}
+	// A plain repost already there conflicts on the unique_author_plain_repost index
+	if db.Clauses(clause.OnConflict{DoNothing: true}).Create(&post).RowsAffected == 0 {
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "You have already reposted this post")
+		return nil, &statusCode, &errData
 	}
-	q.Take(&post, post)
+	post.OriginalPostObj = &original
+	return &post, nil, nil
+}
+
+func (obj PostManager) GetBySlug(db *gorm.DB, slug string) (*models.Post, *int, *utils.ErrorResponse) {
+	post := models.Post{FeedAbstract: models.FeedAbstract{Slug: slug}}
+	db.Scopes(PostAuthorReactionScope, PostMediaScope, OriginalPostScope).Take(&post, post)
 	if post.ID == nil {
 		status_code := 404
 		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Post does not exist")
@@ -65,15 +253,72 @@ func (obj PostManager) GetBySlug(db *gorm.DB, slug string, opts ...bool) (*model
 	return &post, nil, nil
 }
 
-func (obj PostManager) Update(db *gorm.DB, post *models.Post, postData schemas.PostInputSchema) *models.Post {
-	if postData.FileType != nil {
-		// Create or Update Image Object
-		image := models.File{ResourceType: *postData.FileType}.UpdateOrCreate(db, post.ImageID)
-		post.ImageObj = &image
+// Updates the text, visibility and audience, and rearranges the media. Media that are kept are only moved,
+// never recreated, so their uploads stay as they are.
+func (obj PostManager) Update(db *gorm.DB, post *models.Post, postData schemas.PostUpdateSchema, maxMedia int) (*models.Post, *int, *utils.ErrorResponse) {
+	visibility := post.Visibility
+	if postData.Visibility != "" {
+		visibility = postData.Visibility
+	}
+	// A CUSTOM post keeps its audience unless a new one is sent
+	keepAudience := visibility == choices.PVCUSTOM && post.Visibility == choices.PVCUSTOM && postData.Audience == nil
+	audience := []models.User{}
+	if !keepAudience {
+		var errCode *int
+		var errData *utils.ErrorResponse
+		if audience, errCode, errData = obj.GetAudience(db, post.AuthorObj, visibility, postData.Audience); errData != nil {
+			return nil, errCode, errData
+		}
+	}
+
+	kept, removed := post.MediaObjs, []models.PostMedia{}
+	if postData.MediaIDs != nil {
+		current := map[string]models.PostMedia{}
+		for _, media := range post.MediaObjs {
+			current[media.ID.String()] = media
+		}
+		kept = []models.PostMedia{}
+		for _, id := range *postData.MediaIDs {
+			media, ok := current[id]
+			if !ok { // Not one of the post's media, or listed twice
+				statusCode := 422
+				errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{
+					"media_ids": fmt.Sprintf("%s isn't a media of this post", id),
+				})
+				return nil, &statusCode, &errData
+			}
+			delete(current, id)
+			kept = append(kept, media)
+		}
+		for _, media := range current {
+			removed = append(removed, media)
+		}
+	}
+	if errCode, errData := obj.ValidateMediaCount(len(kept)+len(postData.FileTypes), maxMedia); errData != nil {
+		return nil, errCode, errData
+	}
+
+	for _, media := range removed {
+		FileManager{}.Delete(db, media.FileObj, "posts") // Takes the post media with it
 	}
+	for i := range kept {
+		if kept[i].Position != i {
+			kept[i].Position = i
+			db.Model(&kept[i]).UpdateColumn("position", i)
+		}
+	}
+	post.MediaObjs = kept
+	obj.addMedia(db, post, postData.FileTypes)
+
 	post.Text = postData.Text
+	post.Visibility = visibility
 	db.Omit(clause.Associations).Save(&post)
-	return post
+	if !keepAudience {
+		obj.setAudience(db, post, audience)
+	} else {
+		db.Model(post).Association("AudienceObjs").Find(&post.AudienceObjs)
+	}
+	return post, nil, nil
 }
 
 func (obj PostManager) DropData(db *gorm.DB) {
@@ -86,11 +331,22 @@ func (obj PostManager) DropData(db *gorm.DB) {
 type CommentManager struct {
 }
 
+// Limits queries of comments to those on posts the viewer can see, leaving out those of users a block stands
+// between the viewer and or hidden by staff, and loads the viewer's reactions so the comments show how the viewer
+// reacted to them. A nil viewer is a guest, who didn't
+func (obj CommentManager) ForViewer(db *gorm.DB, viewer *models.User) *gorm.DB {
+	db = db.Where("comments.post_id IN (?)", PostManager{}.VisibleIDs(db, viewer)).Where("NOT comments.is_hidden")
+	if viewer == nil {
+		return db
+	}
+	return db.Not("comments.author_id IN (?)", BlockManager{}.GetBlockedIDs(db, *viewer)).Preload("ViewerReactions", "user_id = ?", viewer.ID)
+}
+
 func (obj CommentManager) GetBySlug(db *gorm.DB, slug string, opts ...bool) (*models.Comment, *int, *utils.ErrorResponse) {
 	comment := models.Comment{FeedAbstract: models.FeedAbstract{Slug: slug}}
 	q := db.Scopes(AuthorAvatarScope)
 	if len(opts) > 0 { // Detailed param provided.
-		q = q.Preload("Reactions").Preload("Replies").Preload("Replies.AuthorObj").Preload("Replies.AuthorObj.AvatarObj")
+		q = q.Preload("Reactions", GroupedReactions("comment_id"))
 	}
 	q.Take(&comment, comment)
 	if comment.ID == nil {
@@ -101,75 +357,92 @@ func (obj CommentManager) GetBySlug(db *gorm.DB, slug string, opts ...bool) (*mo
 	return &comment, nil, nil
 }
 
-func (obj CommentManager) GetByPostID(db *gorm.DB, postID uuid.UUID) []models.Comment {
-	comments := []models.Comment{}
-	db.Preload("Replies").Scopes(AuthorReactionScope).Where(models.Comment{PostID: postID}).Find(&comments)
-	return comments
+// Like GetBySlug, but only for comments that answer another comment
+func (obj CommentManager) GetReplyBySlug(db *gorm.DB, slug string, opts ...bool) (*models.Comment, *int, *utils.ErrorResponse) {
+	reply, errCode, errData := obj.GetBySlug(db.Where("comments.parent_id IS NOT NULL"), slug, opts...)
+	if errCode != nil {
+		errData.Message = "Reply does not exist"
+	}
+	return reply, errCode, errData
 }
 
-func (obj CommentManager) Create(db *gorm.DB, author models.User, post models.Post, text string) models.Comment {
-	id := uuid.Parse(uuid.New())
-	// Create slug
-	slug := slug.Make(fmt.Sprintf("%s %s %s", author.FirstName, author.LastName, id))
-	base := models.BaseModel{ID: id}
-	sub_base := models.FeedAbstract{BaseModel: base, Slug: slug, AuthorID: author.ID, AuthorObj: author, Text: text}
-
-	comment := models.Comment{FeedAbstract: sub_base, PostID: post.ID, PostObj: post}
-	db.Create(&comment)
-	return comment
+func (obj CommentManager) GetByPostID(db *gorm.DB, postID uuid.UUID) *gorm.DB {
+	return db.Model(&models.Comment{}).Scopes(CommentAuthorReactionScope).Where(models.Comment{PostID: postID}).Where("comments.parent_id IS NULL AND NOT comments.is_hidden")
 }
 
-func (obj CommentManager) Update(db *gorm.DB, comment models.Comment, author *models.User, text string) models.Comment {
-	comment.Text = text
-	db.Omit(clause.Associations).Save(&comment)
-	return comment
+func (obj CommentManager) GetByParentID(db *gorm.DB, parentID uuid.UUID) *gorm.DB {
+	return db.Model(&models.Comment{}).Scopes(CommentAuthorReactionScope).Where(models.Comment{ParentID: &parentID}).Where("NOT comments.is_hidden")
 }
 
-func (obj CommentManager) DropData(db *gorm.DB) {
-	db.Delete(&models.Comment{})
+// Fills in the replies below the given ones, down to maxDepth, from a single query on their paths.
+// Replies at maxDepth get no thread, so clients know to fetch the rest from them.
+func (obj CommentManager) LoadThreads(db *gorm.DB, replies []models.Comment, maxDepth int) {
+	if len(replies) == 0 {
+		return
+	}
+	paths := db.Session(&gorm.Session{NewDB: true}).Where("comments.path LIKE ?", replies[0].Path+"_%")
+	for _, reply := range replies[1:] {
+		paths = paths.Or("comments.path LIKE ?", reply.Path+"_%")
+	}
+	descendants := []models.Comment{}
+	db.Model(&models.Comment{}).Scopes(CommentAuthorReactionScope).
+		Where(paths).Where("comments.depth <= ? AND NOT comments.is_hidden", maxDepth).
+		Order("comments.created_at").Find(&descendants)
+
+	children := map[string][]models.Comment{}
+	for _, comment := range descendants {
+		children[comment.ParentID.String()] = append(children[comment.ParentID.String()], comment)
+	}
+	var attach func(comment *models.Comment)
+	attach = func(comment *models.Comment) {
+		if comment.Depth >= maxDepth {
+			return
+		}
+		thread := children[comment.ID.String()]
+		if thread == nil {
+			thread = []models.Comment{}
+		}
+		for i := range thread {
+			attach(&thread[i])
+		}
+		comment.Thread = &thread
+	}
+	for i := range replies {
+		attach(&replies[i])
+	}
 }
 
-// ----------------------------------
-// REPLY MANAGEMENT
-// --------------------------------
-type ReplyManager struct {
+func (obj CommentManager) create(db *gorm.DB, author models.User, comment models.Comment, text string) models.Comment {
+	// Create slug
+	slug := slug.Make(fmt.Sprintf("%s %s %s", author.FirstName, author.LastName, comment.ID))
+	comment.FeedAbstract = models.FeedAbstract{BaseModel: comment.BaseModel, Slug: slug, AuthorID: author.ID, AuthorObj: author, Text: text}
+	db.Omit(clause.Associations).Create(&comment)
+	return comment
 }
 
-func (obj ReplyManager) GetBySlug(db *gorm.DB, slug string, opts ...bool) (*models.Reply, *int, *utils.ErrorResponse) {
-	reply := models.Reply{FeedAbstract: models.FeedAbstract{Slug: slug}}
-	q := db
-	if len(opts) > 0 { // Detailed param provided.
-		q = q.Scopes(AuthorReactionScope)
-	}
-	q.Take(&reply, reply)
-	if reply.ID == nil {
-		status_code := 404
-		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Reply does not exist")
-		return nil, &status_code, &errData
-	}
-	return &reply, nil, nil
+func (obj CommentManager) Create(db *gorm.DB, author models.User, post models.Post, text string) models.Comment {
+	id := uuid.Parse(uuid.New())
+	comment := models.Comment{PostID: post.ID, PostObj: post, Path: id.String() + "/"}
+	comment.ID = id
+	return obj.create(db, author, comment, text)
 }
 
-func (obj ReplyManager) Create(db *gorm.DB, author models.User, comment models.Comment, text string) models.Reply {
+// Creates a comment under the parent, on the parent's post
+func (obj CommentManager) CreateReply(db *gorm.DB, author models.User, parent models.Comment, text string) models.Comment {
 	id := uuid.Parse(uuid.New())
-	// Create slug
-	slug := slug.Make(fmt.Sprintf("%s %s %s", author.FirstName, author.LastName, id))
-	base := models.BaseModel{ID: id}
-	sub_base := models.FeedAbstract{BaseModel: base, Slug: slug, AuthorID: author.ID, AuthorObj: author, Text: text}
-
-	reply := models.Reply{FeedAbstract: sub_base, CommentID: comment.ID, CommentObj: comment}
-	db.Create(&reply)
-	return reply
+	reply := models.Comment{PostID: parent.PostID, ParentID: &parent.ID, ParentObj: &parent, Path: parent.Path + id.String() + "/", Depth: parent.Depth + 1}
+	reply.ID = id
+	return obj.create(db, author, reply, text)
 }
 
-func (obj ReplyManager) Update(db *gorm.DB, reply models.Reply, author *models.User, text string) models.Reply {
-	reply.Text = text
-	db.Save(&reply)
-	return reply
+func (obj CommentManager) Update(db *gorm.DB, comment models.Comment, author *models.User, text string) models.Comment {
+	comment.Text = text
+	db.Omit(clause.Associations).Save(&comment)
+	return comment
 }
 
-func (obj ReplyManager) DropData(db *gorm.DB) {
-	db.Delete(&models.Reply{})
+func (obj CommentManager) DropData(db *gorm.DB) {
+	db.Delete(&models.Comment{})
 }
 
 // ----------------------------------
@@ -182,30 +455,34 @@ func UserAvatarReactionScope(db *gorm.DB) *gorm.DB {
 type ReactionManager struct {
 }
 
-func (obj ReactionManager) GetReactionsQueryset(db *gorm.DB, fiberCtx *fiber.Ctx, focus choices.FocusTypeChoice, slug string) ([]models.Reaction, *int, *utils.ErrorResponse) {
-	reactions := []models.Reaction{}
-	q := db.Scopes(UserAvatarReactionScope)
+// Reactions on what the viewer can see. A nil viewer is a guest
+func (obj ReactionManager) GetReactionsQueryset(db *gorm.DB, fiberCtx *fiber.Ctx, focus choices.FocusTypeChoice, slug string, viewer *models.User) (*gorm.DB, *int, *utils.ErrorResponse) {
+	q := db.Model(&models.Reaction{}).Scopes(UserAvatarReactionScope)
 	if focus == choices.FTPOST {
 		// Get Post Object and Query reactions for the post
-		post, errCode, errData := PostManager{}.GetBySlug(db, slug)
+		post, errCode, errData := PostManager{}.GetBySlug(PostManager{}.ForViewer(db, viewer), slug)
 		if errCode != nil {
 			return nil, errCode, errData
 		}
-		q = q.Where(models.Reaction{Post: post})
+		q = q.Where(models.Reaction{PostID: &post.ID})
 	} else if focus == choices.FTCOMMENT {
 		// Get Comment Object and Query reactions for the comment
-		comment, errCode, errData := CommentManager{}.GetBySlug(db, slug)
+		comment, errCode, errData := CommentManager{}.GetBySlug(CommentManager{}.ForViewer(db, viewer), slug)
 		if errCode != nil {
 			return nil, errCode, errData
 		}
-		q = q.Where(models.Reaction{Comment: comment})
+		q = q.Where(models.Reaction{CommentID: &comment.ID})
 	} else {
 		// Get Reply Object and Query reactions for the reply
-		reply, errCode, errData := ReplyManager{}.GetBySlug(db, slug)
+		reply, errCode, errData := CommentManager{}.GetReplyBySlug(CommentManager{}.ForViewer(db, viewer), slug)
 		if errCode != nil {
 			return nil, errCode, errData
 		}
-		q = q.Where(models.Reaction{Reply: reply})
+		q = q.Where(models.Reaction{CommentID: &reply.ID})
+	}
+
+	if viewer != nil { // Leave out reactions of users a block stands between the viewer and
+		q = q.Not("reactions.user_id IN (?)", BlockManager{}.GetBlockedIDs(db, *viewer))
 	}
 
 	// Filter by Reaction type if provided (e.g LIKE, LOVE)
@@ -213,37 +490,31 @@ func (obj ReactionManager) GetReactionsQueryset(db *gorm.DB, fiberCtx *fiber.Ctx
 	if len(rtype) > 0 {
 		q = q.Where(models.Reaction{Rtype: rtype})
 	}
-	q.Find(&reactions)
-	return reactions, nil, nil
+	return q, nil, nil
 }
 
-func (obj ReactionManager) Update(db *gorm.DB, reaction models.Reaction, focus choices.FocusTypeChoice, post *models.Post, comment *models.Comment, reply *models.Reply, rtype choices.ReactionChoice) models.Reaction {
+// Replies are comments, so the comment is set for both the COMMENT and REPLY focus
+func (obj ReactionManager) Update(db *gorm.DB, reaction models.Reaction, focus choices.FocusTypeChoice, post *models.Post, comment *models.Comment, rtype choices.ReactionChoice) models.Reaction {
 	reaction.Rtype = rtype
 	if focus == choices.FTPOST {
 		reaction.PostID = &post.ID
 		reaction.Post = post
-	} else if focus == choices.FTCOMMENT {
+	} else {
 		reaction.CommentID = &comment.ID
 		reaction.Comment = comment
-	} else {
-		reaction.ReplyID = &reply.ID
-		reaction.Reply = reply
 	}
 	db.Save(&reaction)
 	return reaction
 }
 
-func (obj ReactionManager) Create(db *gorm.DB, user models.User, focus choices.FocusTypeChoice, post *models.Post, comment *models.Comment, reply *models.Reply, rtype choices.ReactionChoice) models.Reaction {
+func (obj ReactionManager) Create(db *gorm.DB, user models.User, focus choices.FocusTypeChoice, post *models.Post, comment *models.Comment, rtype choices.ReactionChoice) models.Reaction {
 	reaction := models.Reaction{UserObj: user, UserID: user.ID, Rtype: rtype}
 	if focus == choices.FTPOST {
 		reaction.PostID = &post.ID
 		reaction.Post = post
-	} else if focus == choices.FTCOMMENT {
+	} else {
 		reaction.CommentID = &comment.ID
 		reaction.Comment = comment
-	} else {
-		reaction.ReplyID = &reply.ID
-		reaction.Reply = reply
 	}
 	db.Create(&reaction)
 	return reaction
@@ -253,13 +524,12 @@ func (obj ReactionManager) UpdateOrCreate(db *gorm.DB, user models.User, focus c
 	q := db.Scopes(UserAvatarReactionScope)
 	var post *models.Post
 	var comment *models.Comment
-	var reply *models.Reply
 
 	var targetedObjAuthor *models.User
 	reaction := models.Reaction{}
 	if focus == choices.FTPOST {
 		// Get Post Object and Query reactions for the post
-		postObj, errCode, errData := PostManager{}.GetBySlug(db, slug, true)
+		postObj, errCode, errData := PostManager{}.GetBySlug(PostManager{}.ForViewer(db, &user), slug)
 		if errCode != nil {
 			return nil, nil, errCode, errData
 		}
@@ -268,7 +538,7 @@ func (obj ReactionManager) UpdateOrCreate(db *gorm.DB, user models.User, focus c
 		targetedObjAuthor = &post.AuthorObj
 	} else if focus == choices.FTCOMMENT {
 		// Get Comment Object and Query reactions for the comment
-		commentObj, errCode, errData := CommentManager{}.GetBySlug(db, slug, true)
+		commentObj, errCode, errData := CommentManager{}.GetBySlug(CommentManager{}.ForViewer(db, &user), slug, true)
 		if errCode != nil {
 			return nil, nil, errCode, errData
 		}
@@ -277,21 +547,21 @@ func (obj ReactionManager) UpdateOrCreate(db *gorm.DB, user models.User, focus c
 		targetedObjAuthor = &comment.AuthorObj
 	} else {
 		// Get Reply Object and Query reactions for the reply
-		replyObj, errCode, errData := ReplyManager{}.GetBySlug(db, slug, true)
+		replyObj, errCode, errData := CommentManager{}.GetReplyBySlug(CommentManager{}.ForViewer(db, &user), slug, true)
 		if errCode != nil {
 			return nil, nil, errCode, errData
 		}
-		reply = replyObj
-		q = q.Where(models.Reaction{ReplyID: &reply.ID})
-		targetedObjAuthor = &reply.AuthorObj
+		comment = replyObj
+		q = q.Where(models.Reaction{CommentID: &comment.ID})
+		targetedObjAuthor = &comment.AuthorObj
 	}
 	q.Take(&reaction, reaction)
 	if reaction.ID == nil {
 		// Create reaction
-		reaction = obj.Create(db, user, focus, post, comment, reply, rtype)
+		reaction = obj.Create(db, user, focus, post, comment, rtype)
 	} else {
 		// Update
-		reaction = obj.Update(db, reaction, focus, post, comment, reply, rtype)
+		reaction = obj.Update(db, reaction, focus, post, comment, rtype)
 	}
 
 	return &reaction, targetedObjAuthor, nil, nil
@@ -299,7 +569,7 @@ func (obj ReactionManager) UpdateOrCreate(db *gorm.DB, user models.User, focus c
 
 func (obj ReactionManager) GetByID(db *gorm.DB, id *uuid.UUID) (*models.Reaction, *int, *utils.ErrorResponse) {
 	reaction := models.Reaction{}
-	db.Scopes(UserAvatarReactionScope).Joins("Post").Joins("Comment").Joins("Reply").Take(&reaction, *id)
+	db.Scopes(UserAvatarReactionScope).Joins("Post").Joins("Comment").Take(&reaction, *id)
 	if reaction.ID == nil {
 		statusCode := 404
 		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Reaction does not exist")
@@ -311,3 +581,176 @@ func (obj ReactionManager) GetByID(db *gorm.DB, id *uuid.UUID) (*models.Reaction
 func (obj ReactionManager) DropData(db *gorm.DB) {
 	db.Delete(&models.Reaction{})
 }
+
+// ----------------------------------
+// MENTION MANAGEMENT
+// --------------------------------
+type MentionManager struct {
+}
+
+// Points the mentions of the target's post, comment or message at the users mentioned in the text,
+// keeping the ones still there. Users that weren't mentioned in it before are returned to be notified.
+// The scopes narrow down who can be mentioned (e.g to the members of a chat)
+func (obj MentionManager) Sync(db *gorm.DB, target models.Mention, text string, author models.User, scopes ...func(*gorm.DB) *gorm.DB) []models.User {
+	users := []models.User{}
+	if usernames := utils.ExtractMentions(text); len(usernames) > 0 {
+		db.Scopes(scopes...).Where("LOWER(users.username) IN ?", usernames).Not("users.id = ?", author.ID).Find(&users)
+	}
+
+	// Drop mentions that are no longer in the text
+	userIDs := []uuid.UUID{}
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID)
+	}
+	stale := db.Where(target)
+	if len(userIDs) > 0 {
+		stale = stale.Where("user_id NOT IN ?", userIDs)
+	}
+	stale.Delete(&models.Mention{})
+
+	// Add the new ones
+	existingIDs := []uuid.UUID{}
+	db.Model(&models.Mention{}).Where(target).Pluck("user_id", &existingIDs)
+	mentioned := map[string]bool{}
+	for _, id := range existingIDs {
+		mentioned[id.String()] = true
+	}
+	newUsers := []models.User{}
+	mentions := []models.Mention{}
+	for _, user := range users {
+		if mentioned[user.ID.String()] {
+			continue
+		}
+		mention := target
+		mention.UserID = user.ID
+		mentions = append(mentions, mention)
+		newUsers = append(newUsers, user)
+	}
+	if len(mentions) > 0 {
+		db.Omit(clause.Associations).Create(&mentions)
+	}
+	return newUsers
+}
+
+// ----------------------------------
+// HASHTAG MANAGEMENT
+// --------------------------------
+type HashtagManager struct {
+}
+
+// Sets the hashtags of the target's post or comment to the ones in the text. Hashtags still in
+// the text are kept as they are, so editing a post doesn't count its tags again in trending
+func (obj HashtagManager) Sync(db *gorm.DB, target models.Hashtag, text string) {
+	tags := utils.ExtractHashtags(text)
+	stale := db.Where(target)
+	if len(tags) > 0 {
+		stale = stale.Where("tag NOT IN ?", tags)
+	}
+	stale.Delete(&models.Hashtag{})
+
+	existingTags := []string{}
+	db.Model(&models.Hashtag{}).Where(target).Pluck("tag", &existingTags)
+	existing := map[string]bool{}
+	for _, tag := range existingTags {
+		existing[tag] = true
+	}
+	hashtags := []models.Hashtag{}
+	for _, tag := range tags {
+		if !existing[tag] {
+			hashtag := target
+			hashtag.Tag = tag
+			hashtags = append(hashtags, hashtag)
+		}
+	}
+	if len(hashtags) > 0 {
+		db.Omit(clause.Associations).Create(&hashtags)
+	}
+}
+
+// Tags used the most in public posts, and comments on them, over the window leading up to now
+func (obj HashtagManager) Trending(db *gorm.DB, window time.Duration, limit int) []schemas.TrendingHashtagSchema {
+	hashtags := []schemas.TrendingHashtagSchema{}
+	publicPostIDs := PostManager{}.VisibleIDs(db, nil)
+	db.Model(&models.Hashtag{}).Select("tag, COUNT(*) AS count").
+		Where("created_at > ?", time.Now().Add(-window)).
+		Where("post_id IN (?) OR comment_id IN (?)", publicPostIDs, db.Model(&models.Comment{}).Select("id").Where("post_id IN (?)", publicPostIDs)).
+		Group("tag").Order("count DESC, tag").Limit(limit).
+		Scan(&hashtags)
+	return hashtags
+}
+
+// ----------------------------------
+// BOOKMARK MANAGEMENT
+// --------------------------------
+type BookmarkManager struct {
+}
+
+// Counts the bookmarks of each collection in the query, without loading them
+func CollectionBookmarksCountScope(db *gorm.DB) *gorm.DB {
+	return db.Select("collections.*, (SELECT COUNT(*) FROM bookmarks WHERE bookmarks.collection_id = collections.id) AS bookmarks_count")
+}
+
+func (obj BookmarkManager) GetCollections(db *gorm.DB, user models.User) []models.Collection {
+	collections := []models.Collection{}
+	db.Scopes(CollectionBookmarksCountScope).Where(models.Collection{UserID: user.ID}).Order("name").Find(&collections)
+	return collections
+}
+
+func (obj BookmarkManager) GetCollection(db *gorm.DB, user models.User, id uuid.UUID) (*models.Collection, *int, *utils.ErrorResponse) {
+	collection := models.Collection{}
+	db.Scopes(CollectionBookmarksCountScope).Where(models.Collection{UserID: user.ID}).Take(&collection, models.Collection{BaseModel: models.BaseModel{ID: id}})
+	if collection.ID == nil {
+		statusCode := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "User has no collection with that ID")
+		return nil, &statusCode, &errData
+	}
+	return &collection, nil, nil
+}
+
+func (obj BookmarkManager) CreateCollection(db *gorm.DB, user models.User, name string) (*models.Collection, *int, *utils.ErrorResponse) {
+	var count int64
+	db.Model(&models.Collection{}).Where(models.Collection{UserID: user.ID, Name: name}).Count(&count)
+	if count > 0 {
+		statusCode := 422
+		errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{
+			"name": "You already have a collection with that name",
+		})
+		return nil, &statusCode, &errData
+	}
+	collection := models.Collection{UserID: user.ID, Name: name}
+	db.Omit(clause.Associations).Create(&collection)
+	return &collection, nil, nil
+}
+
+func (obj BookmarkManager) Get(db *gorm.DB, user models.User, post models.Post) *models.Bookmark {
+	bookmark := models.Bookmark{}
+	db.Take(&bookmark, models.Bookmark{UserID: user.ID, PostID: post.ID})
+	if bookmark.ID == nil {
+		return nil
+	}
+	return &bookmark
+}
+
+// Bookmarks the post into the collection, or into none when it's nil. A post already
+// bookmarked is moved into the collection instead
+func (obj BookmarkManager) Save(db *gorm.DB, user models.User, post models.Post, collection *models.Collection) models.Bookmark {
+	bookmark := obj.Get(db, user, post)
+	if bookmark == nil {
+		bookmark = &models.Bookmark{UserID: user.ID, PostID: post.ID}
+	}
+	bookmark.CollectionID = nil
+	if collection != nil {
+		bookmark.CollectionID = &collection.ID
+	}
+	db.Omit(clause.Associations).Save(bookmark)
+	return *bookmark
+}
+
+// Posts bookmarked by the user, in the collection when one is given
+func (obj BookmarkManager) Posts(db *gorm.DB, user models.User, collection *models.Collection) *gorm.DB {
+	postIDs := db.Model(&models.Bookmark{}).Select("post_id").Where(models.Bookmark{UserID: user.ID})
+	if collection != nil {
+		postIDs = postIDs.Where(models.Bookmark{CollectionID: &collection.ID})
+	}
+	return PostManager{}.All(db, &user).Where("posts.id IN (?)", postIDs)
+}
@@ -0,0 +1,130 @@
+package managers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/storage"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+)
+
+// ----------------------------------
+// FILE MANAGEMENT
+// --------------------------------
+type FileManager struct {
+}
+
+// How often abandoned uploads are looked for
+const fileSweepInterval = 10 * time.Minute
+
+// The file, if its upload was issued to the user
+func (obj FileManager) GetUpload(db *gorm.DB, id uuid.UUID, uploader models.User) (*models.File, *int, *utils.ErrorResponse) {
+	file := models.File{}
+	db.Take(&file, "id = ? AND uploader_id = ?", id, uploader.ID)
+	if file.ID == nil {
+		statusCode := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "File does not exist")
+		return nil, &statusCode, &errData
+	}
+	return &file, nil, nil
+}
+
+// Checks what was uploaded for the file and records it. The file becomes ready if its content
+// is of the type it was created with and within the size limit of its kind.
+// Otherwise it fails and the upload is thrown away.
+func (obj FileManager) Complete(db *gorm.DB, file *models.File) (*int, *utils.ErrorResponse) {
+	if file.Status == choices.FSREADY {
+		return nil, nil
+	}
+	backend := storage.Get(file.Backend)
+	content, err := backend.Open(file.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_INVALID_REQUEST, "File has not been uploaded")
+		return &statusCode, &errData
+	}
+	if err != nil {
+		log.Println("Error opening file: ", err)
+		statusCode := 503
+		errData := utils.RequestErr(utils.ERR_NETWORK_FAILURE, "Couldn't reach the file storage")
+		return &statusCode, &errData
+	}
+	defer content.Close()
+	maxSize := storage.MaxSize(file.ResourceType)
+	metadata, err := storage.Inspect(io.LimitReader(content, maxSize+1), file.ResourceType)
+	if err != nil {
+		log.Println("Error reading file: ", err)
+		statusCode := 503
+		errData := utils.RequestErr(utils.ERR_NETWORK_FAILURE, "Couldn't reach the file storage")
+		return &statusCode, &errData
+	}
+
+	file.SetMetadata(metadata)
+	file.Status = choices.FSREADY
+	var statusCode *int
+	var errData *utils.ErrorResponse
+	failure := ""
+	if metadata.Size > maxSize {
+		failure = fmt.Sprintf("Uploaded file is larger than %d MB", maxSize/(1024*1024))
+	} else if !storage.MatchesType(metadata.MimeType, file.ResourceType) {
+		failure = "Uploaded file doesn't match its file type"
+	}
+	if failure != "" {
+		file.Status = choices.FSFAILED
+		if err := backend.Delete(file.Key); err != nil {
+			log.Println("Error deleting file: ", err)
+		}
+		code := 422
+		errResp := utils.RequestErr(utils.ERR_INVALID_ENTRY, failure)
+		statusCode, errData = &code, &errResp
+	}
+	db.Model(file).Select("Status", "Size", "Width", "Height", "Checksum", "MimeType", "Duration").Updates(file)
+	return statusCode, errData
+}
+
+// Deletes the file along with its upload
+func (obj FileManager) Delete(db *gorm.DB, file models.File, folder string) {
+	if err := storage.Get(file.Backend).Delete(file.StorageKey(folder)); err != nil {
+		log.Println("Error deleting file: ", err)
+	}
+	db.Delete(&file)
+}
+
+// Deletes files (and whatever got uploaded for them) still pending after maxAge.
+// Their upload urls have expired by then, so they can never be completed.
+func (obj FileManager) DeletePending(db *gorm.DB, maxAge time.Duration) int {
+	files := []models.File{}
+	db.Where("status = ? AND updated_at < ?", choices.FSPENDING, time.Now().Add(-maxAge)).Find(&files)
+	if len(files) == 0 {
+		return 0
+	}
+	ids := []uuid.UUID{}
+	for _, file := range files {
+		if err := storage.Get(file.Backend).Delete(file.Key); err != nil {
+			log.Println("Error deleting pending file: ", err)
+			continue // Left for the next sweep
+		}
+		ids = append(ids, file.ID)
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+	// Skips any that got completed in the meantime
+	return int(db.Where("id IN ? AND status = ?", ids, choices.FSPENDING).Delete(&models.File{}).RowsAffected)
+}
+
+// Runs DeletePending for as long as the app is up
+func (obj FileManager) SweepPending(db *gorm.DB, maxAge time.Duration) {
+	for range time.Tick(fileSweepInterval) {
+		if deleted := obj.DeletePending(db, maxAge); deleted > 0 {
+			log.Printf("Deleted %d abandoned uploads", deleted)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package managers
+
+import (
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+)
+
+// ----------------------------------
+// REPORT MANAGEMENT
+// --------------------------------
+func ReportRelatedScope(db *gorm.DB) *gorm.DB {
+	return db.Joins("ReporterObj").Joins("ReporterObj.AvatarObj").Joins("OffenderObj").Joins("OffenderObj.AvatarObj").
+		Joins("HandledByObj").Joins("PostObj").Joins("CommentObj").Joins("MessageObj")
+}
+
+type ReportManager struct {
+}
+
+// Report of what the key points to, with the offender set. The key is a slug for posts, comments and replies,
+// a message id for messages and a username for profiles. Users can only report what they can see.
+func (obj ReportManager) GetTarget(db *gorm.DB, reporter models.User, target choices.ReportTargetChoice, key string) (*models.Report, *int, *utils.ErrorResponse) {
+	report := models.Report{ReporterID: reporter.ID, Target: target}
+	switch target {
+	case choices.RTPOST:
+		post, errCode, errData := PostManager{}.GetBySlug(PostManager{}.ForViewer(db, &reporter), key)
+		if errData != nil {
+			return nil, errCode, errData
+		}
+		report.PostID, report.OffenderID = &post.ID, post.AuthorID
+	case choices.RTCOMMENT, choices.RTREPLY:
+		commentManager := CommentManager{}
+		q := commentManager.ForViewer(db, &reporter)
+		var comment *models.Comment
+		var errCode *int
+		var errData *utils.ErrorResponse
+		if target == choices.RTREPLY {
+			comment, errCode, errData = commentManager.GetReplyBySlug(q, key)
+		} else {
+			comment, errCode, errData = commentManager.GetBySlug(q.Where("comments.parent_id IS NULL"), key)
+		}
+		if errData != nil {
+			return nil, errCode, errData
+		}
+		report.CommentID, report.OffenderID = &comment.ID, comment.AuthorID
+	case choices.RTMESSAGE:
+		message := models.Message{}
+		if id := uuid.Parse(key); id != nil {
+			message = MessageManager{}.GetByID(db, id)
+		}
+		// Only members of the chat can report its messages
+		if message.ID == nil || message.IsHidden || (ChatManager{}).GetSingleUserChat(db, reporter, message.ChatID).ID == nil {
+			statusCode := 404
+			errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Message does not exist")
+			return nil, &statusCode, &errData
+		}
+		report.MessageID, report.OffenderID = &message.ID, message.SenderID
+	case choices.RTPROFILE:
+		offender := models.User{Username: key}
+		db.Take(&offender, offender)
+		if offender.ID == nil {
+			statusCode := 404
+			errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "No user with that username")
+			return nil, &statusCode, &errData
+		}
+		report.OffenderID = offender.ID
+	}
+
+	if report.OffenderID.String() == reporter.ID.String() {
+		message := "You can't report your own content"
+		if target == choices.RTPROFILE {
+			message = "You can't report yourself"
+		}
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, message)
+		return nil, &statusCode, &errData
+	}
+	return &report, nil, nil
+}
+
+// Files the report, unless the reporter already has an open one on the same target.
+// Returns the report and whether it was created
+func (obj ReportManager) Create(db *gorm.DB, report models.Report, data schemas.ReportInputSchema) (models.Report, bool) {
+	existing := models.Report{}
+	db.Where(models.Report{ReporterID: report.ReporterID, Target: report.Target, OffenderID: report.OffenderID}).
+		Where("post_id IS NOT DISTINCT FROM ? AND comment_id IS NOT DISTINCT FROM ? AND message_id IS NOT DISTINCT FROM ?", report.PostID, report.CommentID, report.MessageID).
+		Where("status IN ?", []choices.ReportStatusChoice{choices.RSPENDING, choices.RSREVIEWING}).
+		Take(&existing)
+	if existing.ID != nil {
+		return existing, false
+	}
+	report.Reason = data.Reason
+	report.Details = data.Details
+	report.Status = choices.RSPENDING
+	db.Create(&report)
+	return report, true
+}
+
+// Reports for staff, optionally filtered by status and target
+func (obj ReportManager) GetAll(db *gorm.DB, status string, target string) *gorm.DB {
+	q := db.Model(&models.Report{}).Scopes(ReportRelatedScope)
+	if status != "" {
+		q = q.Where("reports.status = ?", status)
+	}
+	if target != "" {
+		q = q.Where("reports.target = ?", target)
+	}
+	return q
+}
+
+func (obj ReportManager) GetByID(db *gorm.DB, id uuid.UUID) (*models.Report, *int, *utils.ErrorResponse) {
+	report := models.Report{}
+	db.Scopes(ReportRelatedScope).Take(&report, "reports.id = ?", id)
+	if report.ID == nil {
+		statusCode := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "Report does not exist")
+		return nil, &statusCode, &errData
+	}
+	return &report, nil, nil
+}
+
+func (obj ReportManager) closedErr() (*int, *utils.ErrorResponse) {
+	statusCode := 400
+	errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "This report has already been closed")
+	return &statusCode, &errData
+}
+
+// Takes a pending report up for review by the staff member
+func (obj ReportManager) Triage(db *gorm.DB, report *models.Report, staff models.User) (*models.Report, *int, *utils.ErrorResponse) {
+	if !report.IsOpen() {
+		errCode, errData := obj.closedErr()
+		return nil, errCode, errData
+	}
+	if report.Status == choices.RSREVIEWING {
+		statusCode := 400
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "This report is already under review")
+		return nil, &statusCode, &errData
+	}
+	report.Status = choices.RSREVIEWING
+	report.HandledByID, report.HandledByObj = &staff.ID, &staff
+	db.Model(report).Select("Status", "HandledByID").Updates(report)
+	AuditLogManager{}.Create(db, staff, choices.AAREPORTTRIAGED, report, &report.OffenderID, nil)
+	return report, nil, nil
+}
+
+// Closes the report with the staff member's action on it, recording what was done
+func (obj ReportManager) Resolve(db *gorm.DB, report *models.Report, staff models.User, data schemas.ReportActionSchema) (*models.Report, *int, *utils.ErrorResponse) {
+	if !report.IsOpen() {
+		errCode, errData := obj.closedErr()
+		return nil, errCode, errData
+	}
+	if report.OffenderID.String() == staff.ID.String() {
+		statusCode := 403
+		errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "You can't act on a report against yourself")
+		return nil, &statusCode, &errData
+	}
+	switch data.Action {
+	case choices.RAHIDE:
+		if report.Target == choices.RTPROFILE || (report.PostID == nil && report.CommentID == nil && report.MessageID == nil) {
+			message := "The reported content no longer exists"
+			if report.Target == choices.RTPROFILE {
+				message = "Profiles have no content to hide. Suspend the user instead"
+			}
+			statusCode := 422
+			errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{"action": message})
+			return nil, &statusCode, &errData
+		}
+	case choices.RASUSPEND:
+		if report.OffenderObj.IsSuperuser {
+			statusCode := 403
+			errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "Superusers can't be suspended")
+			return nil, &statusCode, &errData
+		}
+		if (report.OffenderObj.IsStaff || report.OffenderObj.IsSuperuser) && !staff.IsSuperuser {
+			statusCode := 403
+			errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, "Only superusers can suspend staff")
+			return nil, &statusCode, &errData
+		}
+	}
+
+	now := time.Now()
+	report.Status = choices.RSRESOLVED
+	if data.Action == choices.RADISMISS {
+		report.Status = choices.RSDISMISSED
+	}
+	report.Action = &data.Action
+	report.Note = data.Note
+	report.HandledByID, report.HandledByObj, report.HandledAt = &staff.ID, &staff, &now
+
+	db.Transaction(func(tx *gorm.DB) error {
+		auditLogManager := AuditLogManager{}
+		switch data.Action {
+		case choices.RADISMISS:
+			auditLogManager.Create(tx, staff, choices.AAREPORTDISMISSED, report, &report.OffenderID, data.Note)
+		case choices.RARESOLVE:
+			auditLogManager.Create(tx, staff, choices.AAREPORTRESOLVED, report, &report.OffenderID, data.Note)
+		case choices.RAHIDE:
+			switch {
+			case report.PostID != nil:
+				tx.Model(&models.Post{}).Where("id = ?", report.PostID).UpdateColumn("is_hidden", true)
+			case report.CommentID != nil:
+				tx.Model(&models.Comment{}).Where("id = ?", report.CommentID).UpdateColumn("is_hidden", true)
+			case report.MessageID != nil:
+				tx.Model(&models.Message{}).Where("id = ?", report.MessageID).UpdateColumn("is_hidden", true)
+			}
+			auditLogManager.Create(tx, staff, choices.AACONTENTHIDDEN, report, &report.OffenderID, data.Note)
+		case choices.RASUSPEND:
+			tx.Model(&models.User{}).Where("id = ?", report.OffenderID).UpdateColumn("is_suspended", true)
+			SessionManager{}.RevokeAll(tx, report.OffenderObj) // Logs them out everywhere
+			report.OffenderObj.IsSuspended = true
+			auditLogManager.Create(tx, staff, choices.AAUSERSUSPENDED, report, &report.OffenderID, data.Note)
+		}
+		return tx.Model(report).Select("Status", "Action", "Note", "HandledByID", "HandledAt").Updates(report).Error
+	})
+	return report, nil, nil
+}
+
+func (obj ReportManager) DropData(db *gorm.DB) {
+	db.Delete(&models.Report{})
+}
+
+// ----------------------------------
+// AUDIT LOG MANAGEMENT
+// --------------------------------
+type AuditLogManager struct {
+}
+
+func (obj AuditLogManager) Create(db *gorm.DB, actor models.User, action choices.AuditActionChoice, report *models.Report, targetUserID *uuid.UUID, note *string) models.AuditLog {
+	auditLog := models.AuditLog{ActorID: &actor.ID, ActorObj: &actor, Action: action, TargetUserID: targetUserID, Note: note}
+	if report != nil {
+		auditLog.ReportID = &report.ID
+	}
+	db.Create(&auditLog)
+	return auditLog
+}
+
+// Audit logs for staff, optionally filtered by action
+func (obj AuditLogManager) GetAll(db *gorm.DB, action string) *gorm.DB {
+	q := db.Model(&models.AuditLog{}).Joins("ActorObj").Joins("ActorObj.AvatarObj").Joins("TargetUserObj").Joins("TargetUserObj.AvatarObj")
+	if action != "" {
+		q = q.Where("audit_logs.action = ?", action)
+	}
+	return q
+}
+
+func (obj AuditLogManager) DropData(db *gorm.DB) {
+	db.Delete(&models.AuditLog{})
+}
@@ -3,6 +3,7 @@ package managers
 import (
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"gorm.io/gorm"
@@ -15,44 +16,27 @@ import (
 type FriendManager struct {
 }
 
+// Subquery of the IDs on the other side of every accepted friendship of the user
+func (obj FriendManager) GetFriendIDs(db *gorm.DB, user models.User) *gorm.DB {
+	return db.Model(&models.Friend{}).
+		Select("CASE WHEN requester_id = ? THEN requestee_id ELSE requester_id END", user.ID).
+		Where(models.Friend{Status: choices.FACCEPTED}).
+		Where(db.Where(models.Friend{RequesterID: user.ID}).Or(models.Friend{RequesteeID: user.ID}))
+}
+
+func (obj FriendManager) GetFriendsQueryset(db *gorm.DB, user models.User) *gorm.DB {
+	return db.Model(&models.User{}).Preload(clause.Associations).Where("users.id IN (?)", obj.GetFriendIDs(db, user))
+}
+
 func (obj FriendManager) GetFriends(db *gorm.DB, user models.User) []models.User {
-	friends := []models.Friend{}
-	db.Where(
-		models.Friend{Status: choices.FACCEPTED},
-	).Where(
-		models.Friend{RequesterID: user.ID}).Or(models.Friend{RequesteeID: user.ID}).Find(&friends)
-
-	friendIDs := []uuid.UUID{}
-	for i := range friends {
-		requesterID := friends[i].RequesterID
-		requesteeID := friends[i].RequesteeID
-		if user.ID.String() == requesterID.String() {
-			friendIDs = append(friendIDs, requesteeID)
-		} else {
-			friendIDs = append(friendIDs, requesterID)
-		}
-	}
 	users := []models.User{}
-	if len(friendIDs) > 0 {
-		db.Preload(clause.Associations).Find(&users, friendIDs)
-	}
+	obj.GetFriendsQueryset(db, user).Find(&users)
 	return users
 }
 
-func (obj FriendManager) GetFriendRequests(db *gorm.DB, user *models.User) []models.User {
-	friendObjects := []models.Friend{}
-	db.Select("requester_id").Where(models.Friend{RequesteeID: user.ID, Status: choices.FPENDING}).Find(&friendObjects)
-
-	friendIDs := []uuid.UUID{}
-	for i := range friendObjects {
-		friendIDs = append(friendIDs, friendObjects[i].RequesterID)
-	}
-
-	friends := []models.User{}
-	if len(friendIDs) > 0 {
-		db.Preload(clause.Associations).Find(&friends, friendIDs)
-	}
-	return friends
+func (obj FriendManager) GetFriendRequests(db *gorm.DB, user *models.User) *gorm.DB {
+	requesterIDs := db.Model(&models.Friend{}).Select("requester_id").Where(models.Friend{RequesteeID: user.ID, Status: choices.FPENDING})
+	return db.Model(&models.User{}).Preload(clause.Associations).Where("users.id IN (?)", requesterIDs)
 }
 
 func (obj FriendManager) GetRequesteeAndFriendObj(db *gorm.DB, user *models.User, username string, statusOpts ...choices.FriendStatusChoice) (*models.User, *models.Friend, *utils.ErrorResponse) {
@@ -76,16 +60,127 @@ func (obj FriendManager) DropData(db *gorm.DB) {
 	db.Delete(&[]models.Friend{})
 }
 
+// ----------------------------------
+// BLOCK MANAGEMENT
+// --------------------------------
+type BlockManager struct {
+}
+
+// Subquery of the IDs of the users the user blocked or was blocked by
+func (obj BlockManager) GetBlockedIDs(db *gorm.DB, user models.User) *gorm.DB {
+	db = db.Session(&gorm.Session{NewDB: true})
+	return db.Model(&models.Block{}).
+		Select("CASE WHEN blocker_id = ? THEN blocked_id ELSE blocker_id END", user.ID).
+		Where(db.Where(models.Block{BlockerID: user.ID}).Or(models.Block{BlockedID: user.ID}))
+}
+
+// Subquery of the IDs of the users the user muted
+func (obj BlockManager) GetMutedIDs(db *gorm.DB, user models.User) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.Mute{}).Select("muted_id").Where(models.Mute{MuterID: user.ID})
+}
+
+// Users the user blocked, or muted if muted is true
+func (obj BlockManager) GetQueryset(db *gorm.DB, user models.User, muted bool) *gorm.DB {
+	userIDs := db.Model(&models.Block{}).Select("blocked_id").Where(models.Block{BlockerID: user.ID})
+	if muted {
+		userIDs = obj.GetMutedIDs(db, user)
+	}
+	return db.Model(&models.User{}).Preload(clause.Associations).Where("users.id IN (?)", userIDs)
+}
+
+// Gets the user of the username to block or mute, who can't be the user
+func (obj BlockManager) GetTarget(db *gorm.DB, user models.User, username string) (*models.User, *int, *utils.ErrorResponse) {
+	target := models.User{Username: username}
+	db.Take(&target, target)
+	if target.ID == nil {
+		statusCode := 404
+		errData := utils.RequestErr(utils.ERR_NON_EXISTENT, "No user with that username")
+		return nil, &statusCode, &errData
+	}
+	if target.ID.String() == user.ID.String() {
+		statusCode := 422
+		errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{
+			"username": "You can't block or mute yourself",
+		})
+		return nil, &statusCode, &errData
+	}
+	return &target, nil, nil
+}
+
+// Error for when a block stands between the two users, told from the user's side of it
+func (obj BlockManager) Check(db *gorm.DB, user models.User, other models.User) *utils.ErrorResponse {
+	block := models.Block{}
+	db.Where(models.Block{BlockerID: user.ID, BlockedID: other.ID}).Or(models.Block{BlockerID: other.ID, BlockedID: user.ID}).Take(&block)
+	if block.ID == nil {
+		return nil
+	}
+	message := "You can't interact with this user"
+	if block.BlockerID.String() == user.ID.String() {
+		message = "You have blocked this user"
+	}
+	errData := utils.RequestErr(utils.ERR_NOT_ALLOWED, message)
+	return &errData
+}
+
+// Whether a block stands between the two users of the DM chat
+func (obj BlockManager) InDM(db *gorm.DB, chat models.Chat) bool {
+	var count int64
+	memberIDs := db.Table("chat_users").Select("user_id").Where("chat_id = ?", chat.ID)
+	db.Model(&models.Block{}).
+		Where("blocker_id = ? AND blocked_id IN (?)", chat.OwnerID, memberIDs).
+		Or("blocked_id = ? AND blocker_id IN (?)", chat.OwnerID, memberIDs).
+		Count(&count)
+	return count > 0
+}
+
+// Blocks the other user, which ends any friendship or friend request between them.
+// Returns false when the user already blocked them
+func (obj BlockManager) Block(db *gorm.DB, user models.User, other models.User) bool {
+	block := models.Block{BlockerID: user.ID, BlockedID: other.ID}
+	result := db.Where(block).FirstOrCreate(&block)
+	db.Where(models.Friend{RequesterID: user.ID, RequesteeID: other.ID}).
+		Or(models.Friend{RequesterID: other.ID, RequesteeID: user.ID}).
+		Delete(&models.Friend{})
+	return result.RowsAffected > 0
+}
+
+// Mutes the other user. Returns false when the user already muted them
+func (obj BlockManager) Mute(db *gorm.DB, user models.User, other models.User) bool {
+	mute := models.Mute{MuterID: user.ID, MutedID: other.ID}
+	return db.Where(mute).FirstOrCreate(&mute).RowsAffected > 0
+}
+
+// Unblocks the other user, or unmutes them if muted is true. Returns false when there was nothing to undo
+func (obj BlockManager) Undo(db *gorm.DB, user models.User, other models.User, muted bool) bool {
+	if muted {
+		return db.Where(models.Mute{MuterID: user.ID, MutedID: other.ID}).Delete(&models.Mute{}).RowsAffected > 0
+	}
+	return db.Where(models.Block{BlockerID: user.ID, BlockedID: other.ID}).Delete(&models.Block{}).RowsAffected > 0
+}
+
+func (obj BlockManager) DropData(db *gorm.DB) {
+	db.Delete(&[]models.Block{})
+	db.Delete(&[]models.Mute{})
+}
+
 // ----------------------------------
 // NOTIFICATION MANAGEMENT
 // --------------------------------
 type NotificationManager struct {
 }
 
-func (obj NotificationManager) GetQueryset(db *gorm.DB, userID uuid.UUID) []models.Notification {
-	notifications := []models.Notification{}
-	db.Preload(clause.Associations).Order("created_at DESC").Find(&notifications)
-	return notifications
+// How many receivers of an admin notification are added at once
+const notificationReceiversBatchSize = 1000
+
+// Notifications the user received, leaving out those on posts the user can no longer see
+func (obj NotificationManager) GetQueryset(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	visiblePostIDs := PostManager{}.VisibleIDs(db, &models.User{BaseModel: models.BaseModel{ID: userID}})
+	return db.Model(&models.Notification{}).
+		Where("notifications.id IN (?)", db.Table("notification_receivers").Select("notification_id").Where("user_id = ?", userID)).
+		Where("notifications.post_id IS NULL OR notifications.post_id IN (?)", visiblePostIDs).
+		Where("notifications.comment_id IS NULL OR notifications.comment_id IN (?)", db.Model(&models.Comment{}).Select("id").Where("post_id IN (?)", visiblePostIDs)).
+		Preload("SenderObj").Preload("SenderObj.AvatarObj").Preload("Post").Preload("Comment").Preload("MessageObj").
+		Preload("ReadBy", "users.id = ?", userID) // Only needed to know if the user read it
 }
 
 func (obj NotificationManager) MarkAsRead(db *gorm.DB, user *models.User) {
@@ -106,9 +201,38 @@ func (obj NotificationManager) ReadOne(db *gorm.DB, user *models.User, notificat
 	return nil
 }
 
-func (obj NotificationManager) Create(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, receivers []models.User, post *models.Post, comment *models.Comment, reply *models.Reply, text *string) models.Notification {
+// Leaves out the receivers who blocked, were blocked by or muted the sender
+func (obj NotificationManager) reachable(db *gorm.DB, sender *models.User, receivers []models.User) []models.User {
+	if sender == nil || len(receivers) == 0 {
+		return receivers
+	}
+	receiverIDs := []uuid.UUID{}
+	for _, receiver := range receivers {
+		receiverIDs = append(receiverIDs, receiver.ID)
+	}
+	reachableIDs := []uuid.UUID{}
+	db.Model(&models.User{}).Where("users.id IN ?", receiverIDs).
+		Not("users.id IN (?)", BlockManager{}.GetBlockedIDs(db, *sender)).
+		Not("users.id IN (?)", db.Model(&models.Mute{}).Select("muter_id").Where(models.Mute{MutedID: sender.ID})).
+		Pluck("users.id", &reachableIDs)
+	reachable := map[string]bool{}
+	for _, id := range reachableIDs {
+		reachable[id.String()] = true
+	}
+	filtered := []models.User{}
+	for _, receiver := range receivers {
+		if reachable[receiver.ID.String()] {
+			filtered = append(filtered, receiver)
+		}
+	}
+	return filtered
+}
+
+// The notification isn't created (so has no ID) when none of the receivers can be reached by the sender
+func (obj NotificationManager) Create(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, receivers []models.User, post *models.Post, comment *models.Comment, text *string) models.Notification {
+	receivers = obj.reachable(db, sender, receivers)
 	// Create Notification
-	notification := models.Notification{Ntype: ntype, Text: text, SenderObj: sender, Post: post, Comment: comment, Reply: reply, Receivers: receivers}
+	notification := models.Notification{Ntype: ntype, Text: text, SenderObj: sender, Post: post, Comment: comment, Receivers: receivers}
 	if sender != nil {
 		notification.SenderID = &sender.ID
 	}
@@ -116,30 +240,59 @@ func (obj NotificationManager) Create(db *gorm.DB, sender *models.User, ntype ch
 		notification.PostID = &post.ID
 	} else if comment != nil {
 		notification.CommentID = &comment.ID
-	} else if reply != nil {
-		notification.ReplyID = &reply.ID
 	}
-	db.Omit("Receivers.*").Create(&notification)
+	if len(receivers) > 0 || sender == nil {
+		db.Omit("Receivers.*").Create(&notification)
+	}
 	return notification
 }
 
-func (obj NotificationManager) GetOrCreate(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, receivers []models.User, post *models.Post, comment *models.Comment, reply *models.Reply) (models.Notification, bool) {
-	created := false
-	notification := models.Notification{Ntype: ntype, Post: post, Comment: comment, Reply: reply}
+// Notifies the users of being mentioned in the post, comment or message. As with Create,
+// it isn't created when none of them can be reached by the sender
+func (obj NotificationManager) CreateMention(db *gorm.DB, sender *models.User, receivers []models.User, post *models.Post, comment *models.Comment, message *models.Message) models.Notification {
+	receivers = obj.reachable(db, sender, receivers)
+	notification := models.Notification{Ntype: choices.NMENTION, SenderID: &sender.ID, SenderObj: sender, Post: post, Comment: comment, MessageObj: message, Receivers: receivers}
+	if post != nil {
+		notification.PostID = &post.ID
+	} else if comment != nil {
+		notification.CommentID = &comment.ID
+	} else if message != nil {
+		notification.MessageID = &message.ID
+	}
+	if len(receivers) > 0 {
+		db.Omit("Receivers.*").Create(&notification)
+	}
+	return notification
+}
+
+// Conditions matching the sender's notification of the type about the post or comment
+func (obj NotificationManager) lookup(sender *models.User, ntype choices.NotificationChoice, post *models.Post, comment *models.Comment) models.Notification {
+	notification := models.Notification{Ntype: ntype, Post: post, Comment: comment}
 	if sender != nil {
 		notification.SenderID = &sender.ID
 	}
-	db.Joins("SenderObj").Joins("SenderObj.AvatarObj").Joins("Post").Joins("Comment").Joins("Reply").Take(&notification, notification)
+	if post != nil {
+		notification.PostID = &post.ID
+	} else if comment != nil {
+		notification.CommentID = &comment.ID
+	}
+	return notification
+}
+
+func (obj NotificationManager) GetOrCreate(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, receivers []models.User, post *models.Post, comment *models.Comment) (models.Notification, bool) {
+	created := false
+	notification := obj.lookup(sender, ntype, post, comment)
+	db.Joins("SenderObj").Joins("SenderObj.AvatarObj").Joins("Post").Joins("Comment").Take(&notification, notification)
 	if notification.ID == nil {
-		created = true
 		// Create notification
-		notification = obj.Create(db, sender, ntype, receivers, post, comment, reply, nil)
+		notification = obj.Create(db, sender, ntype, receivers, post, comment, nil)
+		created = notification.ID != nil
 	}
 	return notification, created
 }
 
-func (obj NotificationManager) Get(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, post *models.Post, comment *models.Comment, reply *models.Reply) *models.Notification {
-	notification := models.Notification{SenderID: &sender.ID, Ntype: ntype, Post: post, Comment: comment, Reply: reply}
+func (obj NotificationManager) Get(db *gorm.DB, sender *models.User, ntype choices.NotificationChoice, post *models.Post, comment *models.Comment) *models.Notification {
+	notification := obj.lookup(sender, ntype, post, comment)
 	db.Take(&notification, notification)
 	if notification.ID == nil {
 		return nil
@@ -147,22 +300,81 @@ func (obj NotificationManager) Get(db *gorm.DB, sender *models.User, ntype choic
 	return &notification
 }
 
-func (obj NotificationManager) IsAmongReceivers(db *gorm.DB, notificationID uuid.UUID, receiverID uuid.UUID) bool {
-	notification := models.Notification{}
-	db.Preload("Receivers").Take(&notification, notificationID)
-	if notification.ID == nil {
-		return false
+// Users an admin notification is for. Those of a list are matched by username
+func (obj NotificationManager) GetAdminAudience(db *gorm.DB, data schemas.AdminNotificationSchema) (*gorm.DB, *int, *utils.ErrorResponse) {
+	// Suspended and deactivated users aren't notified
+	q := db.Model(&models.User{}).Scopes(ActiveUsersScope)
+	invalidErr := func(field string, message string) (*gorm.DB, *int, *utils.ErrorResponse) {
+		statusCode := 422
+		errData := utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", map[string]string{field: message})
+		return nil, &statusCode, &errData
+	}
+	switch data.Audience {
+	case choices.NACITY:
+		city := models.City{}
+		db.Take(&city, "id = ?", data.CityID)
+		if city.ID == nil {
+			return invalidErr("city_id", "No city with that ID")
+		}
+		q = q.Where("users.city_id = ?", city.ID)
+	case choices.NACOUNTRY:
+		country := models.Country{}
+		db.Take(&country, "id = ?", data.CountryID)
+		if country.ID == nil {
+			return invalidErr("country_id", "No country with that ID")
+		}
+		q = q.Where("users.city_id IN (?)", db.Model(&models.City{}).Select("id").Where("country_id = ?", country.ID))
+	case choices.NAUSERS:
+		q = q.Where("users.username IN ?", data.Usernames)
+		var count int64
+		q.Session(&gorm.Session{}).Count(&count)
+		if count == 0 {
+			return invalidErr("usernames", "No users with these usernames")
+		}
 	}
+	return q, nil, nil
+}
 
-	// Check if user in notification receivers
-	found := false
-	for _, item := range notification.Receivers {
-		if item.ID.String() == receiverID.String() {
-			found = true
-			break
+// Creates an admin notification for the users, adding them as receivers a batch at a time so a
+// broadcast to everyone doesn't end up as one giant insert. Returns it with how many receive it.
+// It's all one transaction, so a failed batch leaves no notification behind
+func (obj NotificationManager) CreateAdmin(db *gorm.DB, text string, receivers *gorm.DB) (*models.Notification, int64, error) {
+	notification := models.Notification{Ntype: choices.NADMIN, Text: &text}
+	var receiversCount int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
 		}
+		users := []models.User{}
+		return tx.Model(&models.User{}).Select("users.id").Where("users.id IN (?)", receivers.Select("users.id")).
+			FindInBatches(&users, notificationReceiversBatchSize, func(batchTx *gorm.DB, batch int) error {
+				rows := []map[string]interface{}{}
+				for _, user := range users {
+					rows = append(rows, map[string]interface{}{"notification_id": notification.ID, "user_id": user.ID})
+				}
+				receiversCount += int64(len(rows))
+				return tx.Table("notification_receivers").Create(&rows).Error
+			}).Error
+	})
+	if err != nil {
+		return nil, 0, err
 	}
-	return found
+	return &notification, receiversCount, nil
+}
+
+func (obj NotificationManager) GetReceiverIDs(db *gorm.DB, notificationID uuid.UUID) []uuid.UUID {
+	receiverIDs := []uuid.UUID{}
+	db.Table("notification_receivers").Where("notification_id = ?", notificationID).Pluck("user_id", &receiverIDs)
+	return receiverIDs
+}
+
+// Receivers of the notification with a socket open
+func (obj NotificationManager) GetOnlineReceiverIDs(db *gorm.DB, notificationID uuid.UUID) []uuid.UUID {
+	receiverIDs := []uuid.UUID{}
+	db.Model(&models.User{}).Where("online_sockets > 0").
+		Where("id IN (?)", db.Table("notification_receivers").Select("user_id").Where("notification_id = ?", notificationID)).
+		Pluck("id", &receiverIDs)
+	return receiverIDs
 }
 
 func (obj NotificationManager) DropData(db *gorm.DB) {
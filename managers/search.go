@@ -0,0 +1,91 @@
+package managers
+
+import (
+	"fmt"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ----------------------------------
+// SEARCH MANAGEMENT
+// --------------------------------
+type SearchManager struct {
+}
+
+// Text each table's results are highlighted in (its search_vector is built from the same columns)
+var searchHighlightColumns = map[string]string{
+	"posts":    "posts.text",
+	"comments": "comments.text",
+	"users":    "users.first_name || ' ' || users.last_name || ' ' || coalesce(users.bio, '')",
+	"messages": "coalesce(messages.text, '')",
+}
+
+// Parses the search terms the way the table's search_vector was built.
+// User names are indexed without stemming, so users are matched with both configurations.
+func (obj SearchManager) tsQuery(table string, q string) clause.Expr {
+	if table == "users" {
+		return clause.Expr{SQL: "(websearch_to_tsquery('simple', ?) || websearch_to_tsquery('english', ?))", Vars: []interface{}{q, q}}
+	}
+	return clause.Expr{SQL: "websearch_to_tsquery('english', ?)", Vars: []interface{}{q}}
+}
+
+func (obj SearchManager) matches(db *gorm.DB, table string, q string) *gorm.DB {
+	return db.Where(fmt.Sprintf("%s.search_vector @@ ?", table), obj.tsQuery(table, q))
+}
+
+// Relevance of each matching row of the table
+func (obj SearchManager) Rank(table string, q string) clause.Expr {
+	return clause.Expr{SQL: fmt.Sprintf("ts_rank(%s.search_vector, ?)", table), Vars: []interface{}{obj.tsQuery(table, q)}}
+}
+
+func (obj SearchManager) Posts(db *gorm.DB, q string, viewer *models.User) *gorm.DB {
+	return obj.matches(PostManager{}.All(db, viewer), "posts", q)
+}
+
+func (obj SearchManager) Comments(db *gorm.DB, q string, viewer *models.User) *gorm.DB {
+	return obj.matches(CommentManager{}.ForViewer(db, viewer).Model(&models.Comment{}).Scopes(CommentAuthorReactionScope), "comments", q)
+}
+
+// Users a block stands between the viewer and are left out. Pass nil as viewer for a guest
+func (obj SearchManager) Users(db *gorm.DB, q string, viewer *models.User) *gorm.DB {
+	users := db.Model(&models.User{}).Joins("AvatarObj").Joins("CityObj").Scopes(ActiveUsersScope)
+	if viewer != nil {
+		users = users.Not("users.id IN (?)", BlockManager{}.GetBlockedIDs(db, *viewer))
+	}
+	return obj.matches(users, "users", q)
+}
+
+// Only messages of the chats the user owns or is a member of are searched
+func (obj SearchManager) Messages(db *gorm.DB, user models.User, q string) *gorm.DB {
+	chatIDs := db.Model(&models.Chat{}).Select("chats.id").Where(ChatManager{}.UserIsInChat(db, user))
+	return obj.matches(db.Model(&models.Message{}).Scopes(MessageSenderFileScope).Where("messages.chat_id IN (?) AND NOT messages.is_hidden", chatIDs), "messages", q)
+}
+
+// Returns the matching fragments of the given rows keyed by row id, with the matched terms in <b></b>.
+// The text is HTML-escaped first so the highlight tags are the only markup in it.
+func (obj SearchManager) Highlights(db *gorm.DB, table string, q string, ids []uuid.UUID) map[string]string {
+	highlights := map[string]string{}
+	if len(ids) == 0 {
+		return highlights
+	}
+	config := "english"
+	if table == "users" {
+		config = "simple"
+	}
+	text := fmt.Sprintf("replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')", searchHighlightColumns[table])
+	rows := []struct {
+		ID        uuid.UUID
+		Highlight string
+	}{}
+	db.Table(table).
+		Select(fmt.Sprintf("%s.id AS id, ts_headline('%s', %s, ?, 'StartSel=<b>, StopSel=</b>, MaxFragments=2') AS highlight", table, config, text), obj.tsQuery(table, q)).
+		Where(fmt.Sprintf("%s.id IN ?", table), ids).
+		Scan(&rows)
+	for _, row := range rows {
+		highlights[row.ID.String()] = row.Highlight
+	}
+	return highlights
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/gosimple/slug"
@@ -59,8 +60,6 @@ type User struct {
 	AvatarId              *uuid.UUID     `json:"-" gorm:"null"`
 	AvatarObj             *File          `json:"-" gorm:"foreignKey:AvatarId;constraint:OnDelete:SET NULL;null;"`
 	Avatar                *string        `gorm:"-" json:"avatar" example:"https://img.com"`
-	Access                *string        `gorm:"type:varchar(1000);null;" json:"-"`
-	Refresh               *string        `gorm:"type:varchar(1000);null;" json:"-"`
 	Bio                   *string        `gorm:"type:varchar(1000);null;" json:"bio" example:"Software Engineer | Go Fiber Developer"`
 	Dob                   *time.Time     `gorm:"null;" json:"dob"`
 	CityId                *uuid.UUID     `json:"-" gorm:"null"`
@@ -68,6 +67,43 @@ type User struct {
 	City                  *string        `gorm:"-" json:"city" example:"Lekki"`
 	NotificationsReceived []Notification `json:"-" gorm:"many2many:notification_receivers;"`
 	NotificationsRead     []Notification `json:"-" gorm:"many2many:notification_read_by;"`
+	SessionId             uuid.UUID      `json:"-" gorm:"-"` // Session the current request was authenticated with
+	SearchVector          string         `json:"-" gorm:"type:tsvector GENERATED ALWAYS AS (setweight(to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || coalesce(username, '')), 'A') || setweight(to_tsvector('english', coalesce(bio, '')), 'B')) STORED;index:,type:gin;->:false;<-:false"`
+	Highlight             *string        `json:"highlight,omitempty" gorm:"-" example:"Software <b>Engineer</b>"` // Set in search results
+	OnlineSockets         int            `json:"-" gorm:"not null;default:0"`
+	LastSeenAt            *time.Time     `json:"-" gorm:"null"`
+	FailedLogins          int            `json:"-" gorm:"not null;default:0"`
+	LockedUntil           *time.Time     `json:"-" gorm:"null"`
+	TotpSecret            *string        `json:"-" gorm:"type:varchar(64);null"`
+	TotpEnabled           bool           `json:"-" gorm:"default:false"`
+	TotpLastStep          int64          `json:"-" gorm:"not null;default:0"`     // Latest time step used, so no code works twice
+	IsSuspended           bool           `json:"-" gorm:"not null;default:false"` // Set by staff. Suspended users can't log in
+	DeactivatedAt         *time.Time     `json:"-" gorm:"null;index"`             // Set when the user deletes their account. It's purged once the grace period is over
+}
+
+// Shown in place of the content of inactive users
+const UnavailableText = "This content is unavailable"
+
+func (user User) IsOnline() bool {
+	return user.OnlineSockets > 0
+}
+
+// Whether the user is neither suspended nor deactivated. Inactive users are left out of lists, and their content shows as unavailable
+func (user User) IsActive() bool {
+	return !user.IsSuspended && user.DeactivatedAt == nil
+}
+
+// Whether the user deactivated their account longer than gracePeriod ago, so it can't be restored anymore
+func (user User) IsPurgeDue(gracePeriod time.Duration) bool {
+	return user.DeactivatedAt != nil && time.Since(*user.DeactivatedAt) > gracePeriod
+}
+
+// Seconds left of a lockout from repeated bad passwords (0 if the account isn't locked)
+func (user User) LockoutSecondsLeft() int {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	return int(math.Ceil(math.Max(time.Until(*user.LockedUntil).Seconds(), 0)))
 }
 
 func (user User) Init() User {
@@ -92,8 +128,7 @@ func (user User) GetCityName() *string {
 func (user User) GetAvatarUrl() *string {
 	avatar := user.AvatarObj
 	if avatar != nil {
-		url := utils.GenerateFileUrl(avatar.ID.String(), "avatars", avatar.ResourceType)
-		return &url
+		return avatar.Url("avatars")
 	}
 	return nil
 }
@@ -128,14 +163,16 @@ func (user *User) GenerateUsername(tx *gorm.DB) string {
 
 type Otp struct {
 	BaseModel
-	UserId uuid.UUID `json:"user_id" gorm:"unique"`
-	User   User      `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
-	Code   uint32    `json:"code"`
+	UserId   uuid.UUID `json:"user_id" gorm:"unique"`
+	User     User      `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	Code     uint32    `json:"code"`
+	Attempts int       `json:"-" gorm:"not null;default:0"` // Checks made against the current code
 }
 
 func (otp *Otp) BeforeSave(tx *gorm.DB) (err error) {
 	code := uint32(utils.GetRandomInt(6))
 	otp.Code = code
+	otp.Attempts = 0
 	return
 }
 
@@ -146,3 +183,39 @@ func (obj Otp) CheckExpiration() bool {
 	emailExpirySecondsTimeout := cfg.EmailOtpExpireSeconds
 	return diff > emailExpirySecondsTimeout
 }
+
+// One-time code that stands in for a TOTP code when the authenticator isn't at hand
+type RecoveryCode struct {
+	BaseModel
+	UserId   uuid.UUID `gorm:"not null;index"`
+	User     User      `gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	CodeHash string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+}
+
+type Session struct {
+	BaseModel
+	UserId      uuid.UUID `json:"-" gorm:"not null;index"`
+	User        User      `json:"-" gorm:"foreignKey:UserId;constraint:OnDelete:CASCADE"`
+	DeviceName  string    `json:"device_name" gorm:"type: varchar(255);not null" example:"John's iPhone"`
+	IPAddress   string    `json:"ip_address" gorm:"type: varchar(100);not null" example:"102.89.23.10"`
+	UserAgent   string    `json:"user_agent" gorm:"type: varchar(1000);not null" example:"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"`
+	RefreshHash string    `json:"-" gorm:"type: varchar(64);not null"` // Hash of the only refresh token currently valid for this session
+	LastUsedAt  time.Time `json:"last_used_at" gorm:"not null"`
+	IsCurrent   bool      `json:"is_current" gorm:"-"`
+}
+
+// Sockets a user has open on an app instance. An instance keeps the heartbeat of its rows fresh,
+// so those of one that crashed or was redeployed expire and come off their users' online counts.
+type SocketConnection struct {
+	BaseModel
+	InstanceID  uuid.UUID `gorm:"not null;uniqueIndex:idx_socket_connection_instance_user"`
+	UserID      uuid.UUID `gorm:"not null;uniqueIndex:idx_socket_connection_instance_user"`
+	UserObj     User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false"`
+	Sockets     int       `gorm:"not null;default:0"`
+	HeartbeatAt time.Time `gorm:"not null;index"`
+}
+
+func (session Session) Init(currentSessionId uuid.UUID) Session {
+	session.IsCurrent = uuid.Equal(session.ID, currentSessionId)
+	return session
+}
@@ -1,8 +1,12 @@
 package models
 
 import (
+	"log"
 	"time"
 
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/storage"
+	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"gorm.io/gorm"
 )
@@ -15,15 +19,86 @@ type BaseModel struct {
 
 type File struct {
 	BaseModel
-	ResourceType string `json:"resource_type" gorm:"not null"`
+	ResourceType string                   `json:"resource_type" gorm:"not null"`
+	Backend      string                   `json:"-" gorm:"type:varchar(20);not null;default:cloudinary"`
+	Key          string                   `json:"-" gorm:"type:varchar(500);not null;default:''"`
+	Status       choices.FileStatusChoice `json:"status" gorm:"type:varchar(20);not null;default:READY" example:"READY"`
+	Size         int64                    `json:"size" gorm:"not null;default:0" example:"204800"`
+	Width        *int                     `json:"width" gorm:"null" example:"1080"`
+	Height       *int                     `json:"height" gorm:"null" example:"720"`
+	Checksum     string                   `json:"checksum" gorm:"type:varchar(64);not null;default:''" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	MimeType     string                   `json:"mime_type" gorm:"type:varchar(100);not null;default:''" example:"image/jpeg"`
+	MediaKind    choices.MediaKindChoice  `json:"media_kind" gorm:"type:varchar(20);not null;default:IMAGE" example:"IMAGE"`
+	Duration     *float64                 `json:"duration" gorm:"null" example:"12.5"` // Seconds, for audio and video
+	UploaderID   *uuid.UUID               `json:"-" gorm:"null;index"` // Who the upload was issued to. Only they can complete it
 }
 
-func (f File) UpdateOrCreate (db *gorm.DB, id *uuid.UUID) File {
+// File to be uploaded into the folder (e.g "posts") of the configured storage backend.
+// It stays pending till the upload is confirmed by the uploader.
+func NewFile(folder string, contentType string, uploaderID uuid.UUID) File {
+	return File{
+		ResourceType: contentType,
+		UploaderID:   &uploaderID,
+		Backend:      storage.Default().Name(),
+		Key:          storage.NewKey(folder, contentType),
+		Status:       choices.FSPENDING,
+		MediaKind:    utils.MediaTypes[contentType].Kind,
+	}
+}
+
+func (f File) StorageKey(folder string) string {
+	if f.Key == "" { // Files from before keys were recorded are named after their ids
+		return storage.Key(folder, f.ID.String(), f.ResourceType)
+	}
+	return f.Key
+}
+
+// Download url of the file. Files that haven't been uploaded have none
+func (f File) Url(folder string) *string {
+	if f.Status != choices.FSREADY {
+		return nil
+	}
+	url := storage.Get(f.Backend).PresignDownload(f.StorageKey(folder), f.ResourceType)
+	return &url
+}
+
+// Upload request for a file, with the id to confirm the upload with once it's sent
+type FileUploadData struct {
+	FileID  uuid.UUID `json:"file_id" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	MaxSize int64     `json:"max_size" example:"10485760"` // Bytes
+	storage.UploadData
+}
+
+func (f File) UploadData(folder string) *FileUploadData {
+	uploadData := storage.Get(f.Backend).PresignUpload(f.StorageKey(folder), f.ResourceType)
+	return &FileUploadData{FileID: f.ID, MaxSize: storage.MaxSize(f.ResourceType), UploadData: uploadData}
+}
+
+// Records what was found in storage for the file
+func (f *File) SetMetadata(metadata storage.Metadata) {
+	f.Size = metadata.Size
+	f.Width = metadata.Width
+	f.Height = metadata.Height
+	f.Checksum = metadata.Checksum
+	f.MimeType = metadata.MimeType
+	f.Duration = metadata.Duration
+}
+
+// Creates the file, or replaces the one with the id. The replaced upload is deleted from its storage backend
+func (f File) UpdateOrCreate (db *gorm.DB, id *uuid.UUID, folder string) File {
 	if id == nil {
 		db.Create(&f)
 	} else {
-		db.Model(File{BaseModel: BaseModel{ID: *id}}).Updates(&f)
+		old := File{}
+		db.Take(&old, "id = ?", *id)
+		// Metadata of the replaced upload goes too
+		db.Model(File{BaseModel: BaseModel{ID: *id}}).Select("ResourceType", "Backend", "Key", "Status", "Size", "Width", "Height", "Checksum", "MimeType", "MediaKind", "Duration", "UploaderID").Updates(&f)
 		f.ID = *id
+		if old.ID != nil && old.StorageKey(folder) != f.Key {
+			if err := storage.Get(old.Backend).Delete(old.StorageKey(folder)); err != nil {
+				log.Println("Error deleting replaced file: ", err)
+			}
+		}
 	}
 	return f
 }
@@ -1,16 +1,18 @@
 package models
 
 import (
+	"time"
+
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
-	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"gorm.io/gorm"
 )
 
 type LatestMessageSchema struct {
-	Sender UserDataSchema `json:"sender"`
-	Text   *string        `json:"text"`
-	File   *string        `json:"file"`
+	Sender    UserDataSchema           `json:"sender"`
+	Text      *string                  `json:"text"`
+	File      *string                  `json:"file"`
+	MediaKind *choices.MediaKindChoice `json:"media_kind,omitempty" example:"AUDIO"`
 }
 
 type Chat struct {
@@ -28,8 +30,9 @@ type Chat struct {
 	Messages    []Message              `json:"-"`
 
 	LatestMessage *LatestMessageSchema `gorm:"-" json:"latest_message"`
+	UnreadCount   *int64               `gorm:"-" json:"unread_count,omitempty"` // Set when listing the user's chats
 	Users		[]UserDataSchema		`gorm:"-" json:"users,omitempty" swaggerIgnore:"true"` // omitempty later to show for groups
-	FileUploadData *utils.SignatureFormat `gorm:"-" json:"file_upload_data,omitempty"`
+	FileUploadData *FileUploadData `gorm:"-" json:"file_upload_data,omitempty"`
 }
 
 func (c *Chat) BeforeDelete (tx *gorm.DB) (err error) {
@@ -49,14 +52,15 @@ func (c Chat) Init() Chat {
 	if len(latestMessages) > 0 {
 		latestMessage := latestMessages[0]
 		file := latestMessage.FileObj
-		var fileUrl *string
-		if file != nil {
-			url := utils.GenerateFileUrl(file.ID.String(), "messages", file.ResourceType)
-			fileUrl = &url
-		}
 		lm := LatestMessageSchema{
 			Text: latestMessage.Text,
-			File: fileUrl,
+		}
+		if !latestMessage.SenderObj.IsActive() {
+			text := UnavailableText
+			lm.Text, file = &text, nil
+		}
+		if file != nil {
+			lm.File, lm.MediaKind = file.Url("messages"), &file.MediaKind
 		}
 		lm.Sender = lm.Sender.Init(latestMessage.SenderObj)
 		c.LatestMessage = &lm
@@ -70,6 +74,9 @@ func (c Chat) InitG() Chat {
 	// Set Users Details for groups.
 	users := []UserDataSchema{}
 	for _, user := range c.UserObjs {
+		if !user.IsActive() {
+			continue
+		}
 		userData := UserDataSchema{}.Init(user)
 		users = append(users, userData)
 	}
@@ -81,8 +88,7 @@ func (c Chat) InitG() Chat {
 func (c Chat) GetImageUrl() *string {
 	image := c.ImageObj
 	if image != nil {
-		url := utils.GenerateFileUrl(image.ID.String(), "groups", image.ResourceType)
-		return &url
+		return image.Url("groups")
 	}
 	return nil
 }
@@ -92,8 +98,7 @@ func (c Chat) InitC(fileType *string) Chat {
 	// When chat is created
 	file := c.ImageObj
 	if fileType != nil && file != nil { // Generate data when file is being uploaded
-		fuData := utils.GenerateFileSignature(file.ID.String(), "groups")
-		c.FileUploadData = &fuData
+		c.FileUploadData = file.UploadData("groups")
 	}
 	return c
 }
@@ -109,7 +114,12 @@ type Message struct {
 	FileID    *uuid.UUID     `json:"-"`
 	FileObj   *File          `gorm:"foreignKey:FileID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
 	File      *string        `gorm:"-" json:"file" example:"https://img.url"`
-	FileUploadData *utils.SignatureFormat `gorm:"-" json:"file_upload_data,omitempty"`
+	MediaKind *choices.MediaKindChoice `gorm:"-" json:"media_kind,omitempty" example:"AUDIO"`
+	Duration  *float64       `gorm:"-" json:"duration,omitempty" example:"12.5"` // Seconds, for audio and video
+	FileUploadData *FileUploadData `gorm:"-" json:"file_upload_data,omitempty"`
+	SearchVector   string                 `json:"-" gorm:"type:tsvector GENERATED ALWAYS AS (to_tsvector('english', coalesce(text, ''))) STORED;index:,type:gin;->:false;<-:false"`
+	Highlight      *string                `json:"highlight,omitempty" gorm:"-" example:"Jesus is <b>King</b>"` // Set in search results
+	IsHidden       bool                   `json:"-" gorm:"not null;default:false"` // Hidden by staff after a report
 }
 
 func (m *Message) AfterCreate(tx *gorm.DB) (err error) {
@@ -121,12 +131,16 @@ func (m *Message) AfterCreate(tx *gorm.DB) (err error) {
 func (m Message) Init() Message {
 	// Set Author Details.
 	m.Sender = m.Sender.Init(m.SenderObj)
+	if !m.SenderObj.IsActive() {
+		text := UnavailableText
+		m.Text, m.FileObj = &text, nil
+	}
 
 	// Set FileUrl
 	file := m.FileObj
 	if file != nil {
-		url := utils.GenerateFileUrl(file.ID.String(), "messages", file.ResourceType)
-		m.File = &url
+		m.File = file.Url("messages")
+		m.MediaKind, m.Duration = &file.MediaKind, file.Duration
 	}
 	return m
 }
@@ -136,8 +150,30 @@ func (m Message) InitC(fileType *string) Message {
 	// When message is created
 	file := m.FileObj
 	if fileType != nil && file != nil { // Generate data when file is being uploaded
-		fuData := utils.GenerateFileSignature(file.ID.String(), "messages")
-		m.FileUploadData = &fuData
+		m.FileUploadData = file.UploadData("messages")
 	}
 	return m
-}
\ No newline at end of file
+}
+type MessageReceipt struct {
+	BaseModel
+	MessageID   uuid.UUID  `json:"message_id" gorm:"uniqueIndex:idx_message_receipt_user"`
+	MessageObj  Message    `json:"-" gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;<-:false"`
+	UserID      uuid.UUID  `json:"-" gorm:"uniqueIndex:idx_message_receipt_user"`
+	UserObj     User       `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	ReadAt      *time.Time `json:"read_at"`
+}
+
+// Presence of a chat member
+type ChatUserSchema struct {
+	UserDataSchema
+	IsOnline   bool       `json:"is_online"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+func (user ChatUserSchema) Init(userObj User) ChatUserSchema {
+	user.UserDataSchema = user.UserDataSchema.Init(userObj)
+	user.IsOnline = userObj.IsOnline()
+	user.LastSeenAt = userObj.LastSeenAt
+	return user
+}
@@ -11,6 +11,8 @@ const (
 	RANGRY ReactionChoice = "ANGRY"
 )
 
+var ReactionChoices = []ReactionChoice{RLIKE, RLOVE, RHAHA, RWOW, RSAD, RANGRY}
+
 type NotificationChoice string
 
 const (
@@ -18,6 +20,8 @@ const (
 	NCOMMENT  NotificationChoice = "COMMENT"
 	NREPLY    NotificationChoice = "REPLY"
 	NADMIN    NotificationChoice = "ADMIN"
+	NMENTION  NotificationChoice = "MENTION"
+	NREPOST   NotificationChoice = "REPOST"
 )
 
 type FriendStatusChoice string
@@ -34,10 +38,105 @@ const (
 	CGROUP ChatTypeChoice = "GROUP"
 )
 
+type PostVisibilityChoice string
+
+const (
+	PVPUBLIC  PostVisibilityChoice = "PUBLIC"
+	PVFRIENDS PostVisibilityChoice = "FRIENDS"
+	PVONLYME  PostVisibilityChoice = "ONLY_ME"
+	PVCUSTOM  PostVisibilityChoice = "CUSTOM"
+)
+
 type FocusTypeChoice string
 
 const (
 	FTPOST FocusTypeChoice = "POST"
 	FTCOMMENT FocusTypeChoice = "COMMENT"
 	FTREPLY FocusTypeChoice = "REPLY"
-)
\ No newline at end of file
+)
+type FileStatusChoice string
+
+const (
+	FSPENDING FileStatusChoice = "PENDING"
+	FSREADY   FileStatusChoice = "READY"
+	FSFAILED  FileStatusChoice = "FAILED"
+)
+
+type MediaKindChoice string
+
+const (
+	MKIMAGE    MediaKindChoice = "IMAGE"
+	MKVIDEO    MediaKindChoice = "VIDEO"
+	MKAUDIO    MediaKindChoice = "AUDIO"
+	MKDOCUMENT MediaKindChoice = "DOCUMENT"
+)
+
+type ReportTargetChoice string
+
+const (
+	RTPOST    ReportTargetChoice = "POST"
+	RTCOMMENT ReportTargetChoice = "COMMENT"
+	RTREPLY   ReportTargetChoice = "REPLY"
+	RTMESSAGE ReportTargetChoice = "MESSAGE"
+	RTPROFILE ReportTargetChoice = "PROFILE"
+)
+
+type ReportReasonChoice string
+
+const (
+	RRSPAM           ReportReasonChoice = "SPAM"
+	RRHARASSMENT     ReportReasonChoice = "HARASSMENT"
+	RRHATESPEECH     ReportReasonChoice = "HATE_SPEECH"
+	RRVIOLENCE       ReportReasonChoice = "VIOLENCE"
+	RRNUDITY         ReportReasonChoice = "NUDITY"
+	RRMISINFORMATION ReportReasonChoice = "MISINFORMATION"
+	RRIMPERSONATION  ReportReasonChoice = "IMPERSONATION"
+	RROTHER          ReportReasonChoice = "OTHER"
+)
+
+type ReportStatusChoice string
+
+const (
+	RSPENDING   ReportStatusChoice = "PENDING"
+	RSREVIEWING ReportStatusChoice = "REVIEWING"
+	RSRESOLVED  ReportStatusChoice = "RESOLVED"
+	RSDISMISSED ReportStatusChoice = "DISMISSED"
+)
+
+// What staff do about a report when closing it
+type ReportActionChoice string
+
+const (
+	RADISMISS ReportActionChoice = "DISMISS"
+	RARESOLVE ReportActionChoice = "RESOLVE" // Upheld, with nothing done to the content or account
+	RAHIDE    ReportActionChoice = "HIDE_CONTENT"
+	RASUSPEND ReportActionChoice = "SUSPEND_USER"
+)
+
+type AuditActionChoice string
+
+const (
+	AAREPORTTRIAGED    AuditActionChoice = "REPORT_TRIAGED"
+	AAREPORTDISMISSED  AuditActionChoice = "REPORT_DISMISSED"
+	AAREPORTRESOLVED   AuditActionChoice = "REPORT_RESOLVED"
+	AACONTENTHIDDEN    AuditActionChoice = "CONTENT_HIDDEN"
+	AAUSERSUSPENDED    AuditActionChoice = "USER_SUSPENDED"
+	AAUSERREACTIVATED  AuditActionChoice = "USER_REACTIVATED"
+	AAUSERLOGGEDOUT    AuditActionChoice = "USER_LOGGED_OUT"
+	AAEMAILVERIFIED    AuditActionChoice = "EMAIL_VERIFIED"
+	AAEMAILUNVERIFIED  AuditActionChoice = "EMAIL_UNVERIFIED"
+	AASTAFFGRANTED     AuditActionChoice = "STAFF_GRANTED"
+	AASTAFFREVOKED     AuditActionChoice = "STAFF_REVOKED"
+	AASITEDETAILSET    AuditActionChoice = "SITE_DETAIL_UPDATED"
+	AANOTIFICATIONSENT AuditActionChoice = "NOTIFICATION_SENT"
+)
+
+// Who an admin notification goes to
+type NotificationAudienceChoice string
+
+const (
+	NAALL     NotificationAudienceChoice = "ALL"
+	NACITY    NotificationAudienceChoice = "CITY"
+	NACOUNTRY NotificationAudienceChoice = "COUNTRY"
+	NAUSERS   NotificationAudienceChoice = "USERS" // An explicit list of usernames
+)
@@ -2,7 +2,6 @@ package models
 
 import (
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
-	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"gorm.io/gorm"
 )
@@ -14,80 +13,162 @@ type FeedAbstract struct {
 	Author    UserDataSchema `gorm:"-" json:"author"`
 	Text      string         `json:"text"`
 	Slug      string         `gorm:"unique;not null;" json:"slug"`
-	Reactions []Reaction     `json:"-"`
-	ReactionsCount int        `json:"reactions_count" gorm:"-"`
+	Reactions []Reaction     `json:"-"` // Loaded grouped, one per reaction type with its count in Total
+	ViewerReactions []Reaction `json:"-"` // The requesting user's, when there is one
+	ReactionsCount int        `json:"reactions_count" gorm:"not null;default:0;<-:false"` // Kept by a trigger on reactions
+	ReactionsBreakdown map[choices.ReactionChoice]int `json:"reactions_breakdown" gorm:"-" example:"LIKE:10,LOVE:2"`
+	MyReaction     *choices.ReactionChoice `json:"my_reaction" gorm:"-" example:"LIKE"` // Null for guests and users who haven't reacted
+	SearchVector   string     `json:"-" gorm:"type:tsvector GENERATED ALWAYS AS (to_tsvector('english', coalesce(text, ''))) STORED;index:,type:gin;->:false;<-:false"`
+	Highlight      *string    `json:"highlight,omitempty" gorm:"-" example:"Jesus is <b>King</b>"` // Set in search results
+	IsHidden       bool       `json:"-" gorm:"not null;default:false"` // Hidden by staff after a report
 }
 
+// Sets the reaction counts by type from the grouped reactions, and the viewer's reaction if they reacted
+func (f FeedAbstract) initReactions() FeedAbstract {
+	f.ReactionsBreakdown = map[choices.ReactionChoice]int{}
+	for _, rtype := range choices.ReactionChoices {
+		f.ReactionsBreakdown[rtype] = 0
+	}
+	for _, reaction := range f.Reactions {
+		f.ReactionsBreakdown[reaction.Rtype] += reaction.Total
+	}
+	f.MyReaction = nil
+	if len(f.ViewerReactions) > 0 {
+		f.MyReaction = &f.ViewerReactions[0].Rtype
+	}
+	return f
+}
+
+// A post can share another one. A plain repost has no text of its own, while a quote adds
+// some. Plain reposts go with the post they share, but quotes stay on without it.
 type Post struct {
 	FeedAbstract
-	ImageID        *uuid.UUID             `gorm:"null" json:"-"`
-	ImageObj       *File                  `gorm:"foreignKey:ImageID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
-	Image          *string                `gorm:"-" json:"image"`
-	Comments       []Comment              `json:"-"`
-	CommentsCount  int                    `json:"comments_count" gorm:"-"`
-	FileUploadData *utils.SignatureFormat `gorm:"-" json:"file_upload_data,omitempty"`
+	MediaObjs       []PostMedia       `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE" json:"-"`
+	Media           []PostMediaSchema `gorm:"-" json:"media"`
+	Comments        []Comment         `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	CommentsCount   int               `json:"comments_count" gorm:"not null;default:0;<-:false"` // Top comments only. Kept by a trigger on comments
+	OriginalPostID  *uuid.UUID        `gorm:"null;index" json:"-"`
+	OriginalPostObj *Post             `gorm:"foreignKey:OriginalPostID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	OriginalPost    *Post             `gorm:"-" json:"original_post"` // Null for a quote whose original was deleted. Not set within an original post
+	IsQuote         bool              `gorm:"not null;default:false" json:"is_quote"`
+	RepostsCount    int               `gorm:"not null;default:0;<-:false" json:"reposts_count"` // Kept by a trigger on posts
+	Bookmarks       []Bookmark        `gorm:"constraint:OnDelete:CASCADE" json:"-"` // Only the requesting user's, when there is one
+	IsBookmarked    bool              `gorm:"-" json:"is_bookmarked"`
+	Visibility      choices.PostVisibilityChoice `gorm:"type:varchar(20);not null;default:PUBLIC;index" json:"visibility" example:"PUBLIC"`
+	AudienceObjs    []User            `gorm:"many2many:post_audience;constraint:OnDelete:CASCADE" json:"-"` // Who can see a CUSTOM post, besides its author
+	Audience        []UserDataSchema  `gorm:"-" json:"audience,omitempty"` // Only shown to the author, in create and update responses
 }
 
 func (p Post) Init() Post {
 	p.ID = nil // Omit ID
 	p.Author = p.Author.Init(p.AuthorObj)
-	p.Image = p.GetImageUrl()
-	p.CommentsCount = len(p.Comments)
-	p.ReactionsCount = len(p.Reactions)
+	if !p.AuthorObj.IsActive() {
+		p.Text, p.MediaObjs = UnavailableText, nil
+	}
+	p.Media = []PostMediaSchema{}
+	for _, media := range p.MediaObjs {
+		p.Media = append(p.Media, PostMediaSchema{}.Init(media))
+	}
+	p.FeedAbstract = p.FeedAbstract.initReactions()
+	p.IsBookmarked = len(p.Bookmarks) > 0
+	if p.OriginalPostObj != nil {
+		original := p.OriginalPostObj.Init()
+		p.OriginalPost = &original
+	}
 	return p
 }
 
-func (p Post) InitC(fileType *string) Post {
-	// Updating response for when post is created
+// Whether the post only shares another, without text of its own
+func (p Post) IsPlainRepost() bool {
+	return p.OriginalPostID != nil && !p.IsQuote
+}
+
+func (p *Post) BeforeDelete(tx *gorm.DB) (err error) {
+	// Plain reposts of the post have nothing left to show
+	if p.ID != nil {
+		tx.Where("original_post_id = ? AND NOT is_quote", p.ID).Delete(&Post{})
+	}
+	return
+}
+
+func (p Post) InitC() Post {
+	// Updating response for when post is created or updated
 	p = p.Init()
-	image := p.ImageObj
-	if fileType != nil && image != nil { // Generate data when file is being uploaded
-		fuData := utils.GenerateFileSignature(image.ID.String(), "posts")
-		p.FileUploadData = &fuData
+	for i, media := range p.MediaObjs {
+		if media.FileObj.Status == choices.FSPENDING { // Generate data for files still to be uploaded
+			p.Media[i].FileUploadData = media.FileObj.UploadData("posts")
+		}
+	}
+	if p.Visibility == choices.PVCUSTOM {
+		p.Audience = []UserDataSchema{}
+		for _, user := range p.AudienceObjs {
+			p.Audience = append(p.Audience, UserDataSchema{}.Init(user))
+		}
 	}
 	return p
 }
 
-func (p Post) GetImageUrl() *string {
-	image := p.ImageObj
-	if image != nil {
-		url := utils.GenerateFileUrl(image.ID.String(), "posts", image.ResourceType)
-		return &url
-	}
-	return nil
+// An attachment of a post. A post's media are ordered by position
+type PostMedia struct {
+	BaseModel
+	PostID   uuid.UUID `gorm:"not null;index"`
+	PostObj  Post      `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
+	FileID   uuid.UUID `gorm:"not null"`
+	FileObj  File      `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE;<-:false"`
+	Position int       `gorm:"not null;default:0"`
 }
 
+type PostMediaSchema struct {
+	ID             uuid.UUID               `json:"id" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	Url            *string                 `json:"url" example:"https://img.url"`
+	MediaKind      choices.MediaKindChoice `json:"media_kind" example:"IMAGE"`
+	Duration       *float64                `json:"duration,omitempty" example:"12.5"` // Seconds, for audio and video
+	FileUploadData *FileUploadData         `json:"file_upload_data,omitempty"`
+}
+
+func (schema PostMediaSchema) Init(media PostMedia) PostMediaSchema {
+	schema.ID = media.ID
+	schema.Url = media.FileObj.Url("posts")
+	schema.MediaKind = media.FileObj.MediaKind
+	schema.Duration = media.FileObj.Duration
+	return schema
+}
+
+// Comments form a tree. A reply is a comment with a parent, and its path holds the ids of
+// its ancestors and its own, from the top comment down, so a thread is fetched by a prefix match.
 type Comment struct {
 	FeedAbstract
-	PostID  uuid.UUID `json:"-" gorm:"not null"`
-	PostObj Post      `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
-	Replies []Reply   `json:"-"`
-	RepliesCount int   `json:"replies_count" gorm:"-" example:"50"`
+	PostID       uuid.UUID  `json:"-" gorm:"not null"`
+	PostObj      Post       `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
+	ParentID     *uuid.UUID `json:"-" gorm:"null;index"`
+	ParentObj    *Comment   `json:"-" gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;<-:false"`
+	Path         string     `json:"-" gorm:"not null;default:'';index"`
+	Depth        int        `json:"-" gorm:"not null;default:0"` // 0 for comments on a post, 1 for their replies and so on
+	Replies      []Comment  `json:"-" gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE"`
+	RepliesCount int        `json:"replies_count" gorm:"not null;default:0;<-:false" example:"50"` // Kept by a trigger on comments
+	Thread       *[]Comment `json:"replies,omitempty" gorm:"-"` // Set in comment trees. Left out where the tree stops
 }
 
 func (c Comment) Init() Comment {
 	c.ID = nil // Omit ID
 	c.Author = c.Author.Init(c.AuthorObj)
-	c.RepliesCount = len(c.Replies)
-	c.ReactionsCount = len(c.Reactions)
+	if !c.AuthorObj.IsActive() {
+		c.Text = UnavailableText
+	}
+	c.FeedAbstract = c.FeedAbstract.initReactions()
+	if c.Thread != nil {
+		thread := make([]Comment, len(*c.Thread))
+		for i, reply := range *c.Thread {
+			thread[i] = reply.Init()
+		}
+		c.Thread = &thread
+	}
 	return c
 }
 
-type Reply struct {
-	FeedAbstract
-	CommentID  uuid.UUID `json:"-" gorm:"not null"`
-	CommentObj Comment   `json:"-" gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;<-:false"`
-}
-
-func (r Reply) Init() Reply {
-	r.ID = nil // Omit ID
-	r.Author = r.Author.Init(r.AuthorObj)
-	r.ReactionsCount = len(r.Reactions)
-	return r
-}
 type Reaction struct {
 	BaseModel
-	UserID    uuid.UUID              `json:"-" gorm:"not null;index:,unique,composite:user_id_post_id;index:,unique,composite:user_id_comment_id;index:,unique,composite:user_id_reply_id"`
+	UserID    uuid.UUID              `json:"-" gorm:"not null;index:,unique,composite:user_id_post_id;index:,unique,composite:user_id_comment_id"`
 	UserObj   User                   `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false"`
 	User      UserDataSchema         `gorm:"-" json:"user"`
 	Rtype     choices.ReactionChoice `gorm:"varchar(50)" json:"rtype" example:"LIKE"`
@@ -95,8 +176,7 @@ type Reaction struct {
 	Post      *Post                   `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
 	CommentID *uuid.UUID              `json:"-" gorm:"null;index:,unique,composite:user_id_comment_id"`
 	Comment   *Comment                `json:"-" gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;<-:false"`
-	ReplyID   *uuid.UUID              `json:"-" gorm:"null;index:,unique,composite:user_id_reply_id"`
-	Reply     *Reply                  `json:"-" gorm:"foreignKey:ReplyID;constraint:OnDelete:CASCADE;<-:false"`
+	Total     int                    `json:"-" gorm:"->;-:migration"` // Set when reactions are loaded grouped by type
 }
 
 func (r *Reaction) Init() {
@@ -112,3 +192,47 @@ func (r *Reaction) AfterCreate(tx *gorm.DB) (err error) {
 	r.Init()
 	return
 }
+
+// A user mentioned with @username in a post, comment or message
+type Mention struct {
+	BaseModel
+	UserID    uuid.UUID  `gorm:"not null;index"`
+	UserObj   User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false"`
+	PostID    *uuid.UUID `gorm:"null;index"`
+	Post      *Post      `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
+	CommentID *uuid.UUID `gorm:"null;index"`
+	Comment   *Comment   `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;<-:false"`
+	MessageID *uuid.UUID `gorm:"null;index"`
+	Message   *Message   `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;<-:false"`
+}
+
+// A #tag used in a post or comment. Tags are stored lowercased and without the #
+type Hashtag struct {
+	BaseModel
+	Tag       string     `gorm:"type:varchar(100);not null;index"`
+	PostID    *uuid.UUID `gorm:"null;index"`
+	Post      *Post      `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
+	CommentID *uuid.UUID `gorm:"null;index"`
+	Comment   *Comment   `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;<-:false"`
+}
+
+// A named group of a user's bookmarks
+type Collection struct {
+	BaseModel
+	UserID         uuid.UUID  `gorm:"not null;index:,unique,composite:user_id_name" json:"-"`
+	UserObj        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false" json:"-"`
+	Name           string     `gorm:"type:varchar(100);not null;index:,unique,composite:user_id_name" json:"name" example:"Recipes"`
+	Bookmarks      []Bookmark `gorm:"constraint:OnDelete:SET NULL" json:"-"`
+	BookmarksCount int        `gorm:"->;-:migration" json:"bookmarks_count" example:"10"`
+}
+
+// A post saved by a user for later. A user bookmarks a post once, in one of their collections or in none
+type Bookmark struct {
+	BaseModel
+	UserID        uuid.UUID   `gorm:"not null;index:,unique,composite:user_id_post_id"`
+	UserObj       User        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;<-:false"`
+	PostID        uuid.UUID   `gorm:"not null;index:,unique,composite:user_id_post_id"`
+	PostObj       Post        `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;<-:false"`
+	CollectionID  *uuid.UUID  `gorm:"null;index"`
+	CollectionObj *Collection `gorm:"foreignKey:CollectionID;constraint:OnDelete:SET NULL;<-:false"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type SiteDetail struct {
 	BaseModel
 	Name    string `json:"name" gorm:"default:SocialNet;type:varchar(50);not null"`
@@ -12,3 +14,12 @@ type SiteDetail struct {
 	Ig      string `json:"ig" gorm:"default:https://instagram.com;not null" example:"https://instagram.com"`
 }
 
+
+// Hits on a rate limited key within one fixed window
+type RateLimitCounter struct {
+	BaseModel
+	Key         string    `gorm:"type:varchar(1000);not null;uniqueIndex:idx_rate_limit_key_window"`
+	WindowStart time.Time `gorm:"not null;uniqueIndex:idx_rate_limit_key_window"`
+	Hits        int       `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/pborman/uuid"
+)
+
+// A user's report of a post, comment, reply, message or profile, for staff to look into
+type Report struct {
+	BaseModel
+	ReporterID   uuid.UUID                   `gorm:"not null;index" json:"-"`
+	ReporterObj  User                        `gorm:"foreignKey:ReporterID;constraint:OnDelete:CASCADE;<-:false" json:"-"`
+	Reporter     UserDataSchema              `gorm:"-" json:"reporter"`
+	Target       choices.ReportTargetChoice  `gorm:"type:varchar(20);not null" json:"target" example:"POST"`
+	Reason       choices.ReportReasonChoice  `gorm:"type:varchar(20);not null" json:"reason" example:"SPAM"`
+	Details      *string                     `gorm:"type:varchar(1000);null" json:"details" example:"Keeps posting the same link"`
+	OffenderID   uuid.UUID                   `gorm:"not null;index" json:"-"` // Who wrote the content, or whose profile it is
+	OffenderObj  User                        `gorm:"foreignKey:OffenderID;constraint:OnDelete:CASCADE;<-:false" json:"-"`
+	Offender     UserDataSchema              `gorm:"-" json:"offender"`
+	PostID       *uuid.UUID                  `gorm:"null" json:"-"`
+	PostObj      *Post                       `gorm:"foreignKey:PostID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	CommentID    *uuid.UUID                  `gorm:"null" json:"-"` // For comments and replies
+	CommentObj   *Comment                    `gorm:"foreignKey:CommentID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	MessageID    *uuid.UUID                  `gorm:"null" json:"-"`
+	MessageObj   *Message                    `gorm:"foreignKey:MessageID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	Status       choices.ReportStatusChoice  `gorm:"type:varchar(20);not null;default:PENDING;index" json:"status" example:"PENDING"`
+	Action       *choices.ReportActionChoice `gorm:"type:varchar(20);null" json:"action" example:"HIDE_CONTENT"` // What was done when it was closed
+	HandledByID  *uuid.UUID                  `gorm:"null" json:"-"`
+	HandledByObj *User                       `gorm:"foreignKey:HandledByID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	HandledBy    *UserDataSchema             `gorm:"-" json:"handled_by"`
+	HandledAt    *time.Time                  `gorm:"null" json:"handled_at"`
+	Note         *string                     `gorm:"type:varchar(1000);null" json:"note" example:"Spam link removed"`
+
+	// Other schema display
+	TargetKey *string `gorm:"-" json:"target_key" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"` // Slug, message id or username. Null if the content is gone
+	Content   *string `gorm:"-" json:"content" example:"Buy followers at spam.link"`                       // Text of the reported content
+}
+
+// Whether staff are yet to close the report
+func (r Report) IsOpen() bool {
+	return r.Status == choices.RSPENDING || r.Status == choices.RSREVIEWING
+}
+
+func (r Report) Init() Report {
+	r.Reporter = r.Reporter.Init(r.ReporterObj)
+	r.Offender = r.Offender.Init(r.OffenderObj)
+	if r.HandledByObj != nil {
+		handledBy := UserDataSchema{}.Init(*r.HandledByObj)
+		r.HandledBy = &handledBy
+	}
+
+	switch {
+	case r.PostObj != nil:
+		r.TargetKey, r.Content = &r.PostObj.Slug, &r.PostObj.Text
+	case r.CommentObj != nil:
+		r.TargetKey, r.Content = &r.CommentObj.Slug, &r.CommentObj.Text
+	case r.MessageObj != nil:
+		messageID := r.MessageObj.ID.String()
+		r.TargetKey, r.Content = &messageID, r.MessageObj.Text
+	case r.Target == choices.RTPROFILE:
+		r.TargetKey, r.Content = &r.OffenderObj.Username, r.OffenderObj.Bio
+	}
+	return r
+}
+
+// Record of something staff did, kept for audit
+type AuditLog struct {
+	BaseModel
+	ActorID       *uuid.UUID                `gorm:"null;index" json:"-"`
+	ActorObj      *User                     `gorm:"foreignKey:ActorID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	Actor         *UserDataSchema           `gorm:"-" json:"actor"`
+	Action        choices.AuditActionChoice `gorm:"type:varchar(50);not null;index" json:"action" example:"CONTENT_HIDDEN"`
+	ReportID      *uuid.UUID                `gorm:"null" json:"report_id" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	ReportObj     *Report                   `gorm:"foreignKey:ReportID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	TargetUserID  *uuid.UUID                `gorm:"null;index" json:"-"`
+	TargetUserObj *User                     `gorm:"foreignKey:TargetUserID;constraint:OnDelete:SET NULL;<-:false" json:"-"`
+	TargetUser    *UserDataSchema           `gorm:"-" json:"target_user"`
+	Note          *string                   `gorm:"type:varchar(1000);null" json:"note" example:"Spam link removed"`
+}
+
+func (a AuditLog) Init() AuditLog {
+	if a.ActorObj != nil {
+		actor := UserDataSchema{}.Init(*a.ActorObj)
+		a.Actor = &actor
+	}
+	if a.TargetUserObj != nil {
+		targetUser := UserDataSchema{}.Init(*a.TargetUserObj)
+		a.TargetUser = &targetUser
+	}
+	return a
+}
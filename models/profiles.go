@@ -15,6 +15,24 @@ type Friend struct {
 	Status      choices.FriendStatusChoice `gorm:"varchar(50)"`
 }
 
+// A block cuts the two users off from each other, whichever of them blocked
+type Block struct {
+	BaseModel
+	BlockerID uuid.UUID `gorm:"not null;index:,unique,composite:blocker_id_blocked_id"`
+	Blocker   User      `gorm:"foreignKey:BlockerID;constraint:OnDelete:CASCADE"`
+	BlockedID uuid.UUID `gorm:"not null;index:,unique,composite:blocker_id_blocked_id;check:blocker_id <> blocked_id"`
+	Blocked   User      `gorm:"foreignKey:BlockedID;constraint:OnDelete:CASCADE"`
+}
+
+// A mute only keeps the muted user's posts and notifications from the muter, without the muted user knowing
+type Mute struct {
+	BaseModel
+	MuterID uuid.UUID `gorm:"not null;index:,unique,composite:muter_id_muted_id"`
+	Muter   User      `gorm:"foreignKey:MuterID;constraint:OnDelete:CASCADE"`
+	MutedID uuid.UUID `gorm:"not null;index:,unique,composite:muter_id_muted_id;check:muter_id <> muted_id"`
+	Muted   User      `gorm:"foreignKey:MutedID;constraint:OnDelete:CASCADE"`
+}
+
 type Notification struct {
 	BaseModel
 	SenderID  *uuid.UUID                 `gorm:"null" json:"-"`
@@ -27,16 +45,17 @@ type Notification struct {
 	Post      *Post                      `json:"-" gorm:"foreignKey:PostID;constraint:OnDelete:SET NULL;<-:false"`
 	CommentID *uuid.UUID                 `json:"-" gorm:"null"`
 	Comment   *Comment                   `json:"-" gorm:"foreignKey:CommentID;constraint:OnDelete:SET NULL;<-:false"`
-	ReplyID   *uuid.UUID                 `json:"-" gorm:"null"`
-	Reply     *Reply                     `json:"-" gorm:"foreignKey:ReplyID;constraint:OnDelete:SET NULL;<-:false"`
+	MessageID *uuid.UUID                 `json:"-" gorm:"null"`
+	MessageObj *Message                  `json:"-" gorm:"foreignKey:MessageID;constraint:OnDelete:SET NULL;<-:false"`
 	ReadBy    []User                     `json:"-" gorm:"many2many:notification_read_by;<-:false"`
 
 	// Other schema display
-	PostSlug    *string `gorm:"-" json:"post_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
-	CommentSlug *string `gorm:"-" json:"comment_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
-	ReplySlug   *string `gorm:"-" json:"reply_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
-	Message     string  `gorm:"-" json:"message" example:"John Doe reacted to your post"`
-	IsRead      bool    `gorm:"-" json:"is_read" example:"true"`
+	PostSlug    *string    `gorm:"-" json:"post_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	CommentSlug *string    `gorm:"-" json:"comment_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	ReplySlug   *string    `gorm:"-" json:"reply_slug" example:"john-doe-d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	ChatID      *uuid.UUID `gorm:"-" json:"chat_id" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"` // For mentions in messages
+	Message     string     `gorm:"-" json:"message" example:"John Doe reacted to your post"`
+	IsRead      bool       `gorm:"-" json:"is_read" example:"true"`
 }
 
 func (n *Notification) BeforeDelete (tx *gorm.DB) (err error) {
@@ -79,13 +98,14 @@ func (n Notification) Init(currentUserID uuid.UUID) Notification {
 func (n Notification) SetTargetSlug() Notification {
 	post := n.Post
 	comment := n.Comment
-	reply := n.Reply
 	if post != nil {
 		n.PostSlug = &post.Slug
+	} else if comment != nil && comment.ParentID != nil {
+		n.ReplySlug = &comment.Slug
 	} else if comment != nil {
 		n.CommentSlug = &comment.Slug
-	} else if reply != nil {
-		n.ReplySlug = &reply.Slug
+	} else if n.MessageObj != nil {
+		n.ChatID = &n.MessageObj.ChatID
 	}
 	return n
 
@@ -105,6 +125,20 @@ func (n Notification) GetMessage() string {
 		message = sender + " commented on your post"
 	} else if ntype == "REPLY" {
 		message = sender + " replied your comment"
+	} else if ntype == "REPOST" {
+		message = sender + " reposted your post"
+		if n.Post != nil && n.Post.IsQuote {
+			message = sender + " quoted your post"
+		}
+	} else if ntype == "MENTION" {
+		message = sender + " mentioned you in a post"
+		if n.CommentSlug != nil {
+			message = sender + " mentioned you in a comment"
+		} else if n.ReplySlug != nil {
+			message = sender + " mentioned you in a reply"
+		} else if n.ChatID != nil {
+			message = sender + " mentioned you in a chat"
+		}
 	}
 	return message
 }
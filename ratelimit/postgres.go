@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"log"
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps a counter row per key and fixed window, so the limits hold across replicas.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	store := &PostgresStore{db: db}
+	go store.sweep()
+	return store
+}
+
+func (store *PostgresStore) Hit(key string, window time.Duration) (float64, error) {
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	counter := models.RateLimitCounter{}
+	err := store.db.Raw(`INSERT INTO rate_limit_counters (key, window_start, hits, expires_at, created_at, updated_at)
+		VALUES (?, ?, 1, ?, ?, ?)
+		ON CONFLICT (key, window_start) DO UPDATE SET hits = rate_limit_counters.hits + 1, updated_at = EXCLUDED.updated_at
+		RETURNING hits`, key, windowStart, windowStart.Add(2*window), now, now).Scan(&counter).Error
+	if err != nil {
+		return 0, err
+	}
+	previous := models.RateLimitCounter{}
+	err = store.db.Where(models.RateLimitCounter{Key: key, WindowStart: windowStart.Add(-window)}).Limit(1).Find(&previous).Error
+	if err != nil {
+		return 0, err
+	}
+	return slidingCount(previous.Hits, counter.Hits, windowStart, window, now), nil
+}
+
+func (store *PostgresStore) sweep() {
+	for range time.Tick(sweepInterval) {
+		if err := store.db.Where("expires_at < ?", time.Now()).Delete(&models.RateLimitCounter{}).Error; err != nil {
+			log.Println("Error clearing expired rate limit counters: ", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"gorm.io/gorm"
+)
+
+// How often expired counters are cleared out
+const sweepInterval = time.Minute
+
+// Store counts the hits on a key (e.g "login:ip:<ip>") within a sliding window.
+type Store interface {
+	// Records a hit on the key and returns how many hits the window ending now holds
+	Hit(key string, window time.Duration) (float64, error)
+}
+
+// NewStore returns the store set in the config: "postgres" shares the counts between every
+// API replica using the database, while "memory" (the default) only counts hits on this process.
+func NewStore(cfg config.Config, db *gorm.DB) Store {
+	if cfg.RateLimitStore == "postgres" {
+		return NewPostgresStore(db)
+	}
+	return NewMemoryStore()
+}
+
+// Approximates the hits in the sliding window from those of the current fixed window
+// and the previous one, weighted by how much of it the sliding window still covers.
+func slidingCount(previous int, current int, windowStart time.Time, window time.Duration, now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(windowStart))/float64(window)
+	return float64(previous)*overlap + float64(current)
+}
+
+// ----------------------------------
+// IN-PROCESS STORE
+// --------------------------------
+type memoryCounter struct {
+	window      time.Duration
+	windowStart time.Time
+	previous    int
+	current     int
+}
+
+type MemoryStore struct {
+	mutex    sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{counters: make(map[string]*memoryCounter)}
+	go store.sweep()
+	return store
+}
+
+func (store *MemoryStore) Hit(key string, window time.Duration) (float64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	counter := store.counters[key]
+	if counter == nil {
+		counter = &memoryCounter{window: window, windowStart: windowStart}
+		store.counters[key] = counter
+	}
+	if !counter.windowStart.Equal(windowStart) {
+		// Roll over into a new window. The old one only counts if it was the one just before
+		previous := 0
+		if counter.windowStart.Equal(windowStart.Add(-window)) {
+			previous = counter.current
+		}
+		counter.windowStart, counter.previous, counter.current = windowStart, previous, 0
+	}
+	counter.current++
+	return slidingCount(counter.previous, counter.current, windowStart, window, now), nil
+}
+
+func (store *MemoryStore) sweep() {
+	for range time.Tick(sweepInterval) {
+		store.mutex.Lock()
+		now := time.Now()
+		for key, counter := range store.counters {
+			// Nothing left in the sliding window once two windows have gone by
+			if now.Sub(counter.windowStart) >= 2*counter.window {
+				delete(store.counters, key)
+			}
+		}
+		store.mutex.Unlock()
+	}
+}
@@ -0,0 +1,195 @@
+package routes
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/managers"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+)
+
+var adminManager = managers.AdminManager{}
+
+// Value of a boolean query param, or nil if it isn't sent
+func queryBool(c *fiber.Ctx, key string) *bool {
+	if c.Query(key) == "" {
+		return nil
+	}
+	value := c.QueryBool(key)
+	return &value
+}
+
+// @Summary Update site details
+// @Description This endpoint edits the details of the site/application. Only the fields sent are changed
+// @Description `For superusers only`
+// @Tags Admin
+// @Param site_detail body schemas.SiteDetailUpdateSchema true "Site detail object"
+// @Success 200 {object} schemas.SiteDetailResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Router /admin/site-detail [patch]
+// @Security BearerAuth
+func (endpoint Endpoint) UpdateSiteDetail(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	data := schemas.SiteDetailUpdateSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	response := schemas.SiteDetailResponseSchema{
+		ResponseSchema: SuccessResponse("Site Details Updated!"),
+		Data:           adminManager.UpdateSiteDetail(db, *user, data),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Retrieve Users (Admin)
+// @Description This endpoint retrieves a paginated list of users with their account details, latest first
+// @Description `For superusers only`
+// @Tags Admin
+// @Param search query string false "Search names, usernames and emails"
+// @Param is_email_verified query bool false "Filter by email verification"
+// @Param is_staff query bool false "Filter by staff"
+// @Param is_superuser query bool false "Filter by superuser"
+// @Param is_suspended query bool false "Filter by suspension"
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.AdminUsersResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Router /admin/users [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveAdminUsers(c *fiber.Ctx) error {
+	db := endpoint.DB
+	filters := schemas.UserFilterSchema{
+		Search:          c.Query("search"),
+		IsEmailVerified: queryBool(c, "is_email_verified"),
+		IsStaff:         queryBool(c, "is_staff"),
+		IsSuperuser:     queryBool(c, "is_superuser"),
+		IsSuspended:     queryBool(c, "is_suspended"),
+	}
+
+	// Paginate, Convert type and return Users
+	users := []models.User{}
+	paginatedData, err := PaginateQueryset(adminManager.GetUsers(db, filters), c, &users)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.AdminUsersResponseSchema{
+		ResponseSchema: SuccessResponse("Users fetched"),
+		Data: schemas.AdminUsersResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+		}.Init(users),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Update User (Admin)
+// @Description This endpoint verifies or unverifies a user's email, grants or revokes staff, and suspends or reactivates the account. Only the fields sent are changed
+// @Description `For superusers only. Suspending logs the user out everywhere and keeps them from logging in. Superusers can't be suspended, and can't manage their own account`
+// @Tags Admin
+// @Param username path string true "Username of user"
+// @Param user body schemas.AdminUserUpdateSchema true "User flags"
+// @Success 200 {object} schemas.AdminUserResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{username} [patch]
+// @Security BearerAuth
+func (endpoint Endpoint) UpdateAdminUser(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	data := schemas.AdminUserUpdateSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	target, errCode, errData := adminManager.GetUser(db, *user, c.Params("username"))
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	target, errCode, errData = adminManager.UpdateUser(db, *user, target, data)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	response := schemas.AdminUserResponseSchema{
+		ResponseSchema: SuccessResponse("User updated"),
+		Data:           schemas.AdminUserSchema{}.Init(*target),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Log Out User (Admin)
+// @Description This endpoint logs a user out of every session, so none of their tokens work anymore
+// @Description `For superusers only`
+// @Tags Admin
+// @Param username path string true "Username of user"
+// @Success 200 {object} schemas.ResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/users/{username}/logout [post]
+// @Security BearerAuth
+func (endpoint Endpoint) LogoutAdminUser(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	target, errCode, errData := adminManager.GetUser(db, *user, c.Params("username"))
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	adminManager.Logout(db, *user, *target)
+	return c.Status(200).JSON(SuccessResponse("User logged out"))
+}
+
+// @Summary Send Admin Notification
+// @Description This endpoint sends a notification with the text to everyone, the users in a city or country, or a list of users
+// @Description `For staff only. audience should be any of these: ALL, CITY, COUNTRY, USERS. Send city_id, country_id or usernames along for the last three. Online receivers get it on their notification sockets right away`
+// @Tags Admin
+// @Param notification body schemas.AdminNotificationSchema true "Notification object"
+// @Success 201 {object} schemas.AdminNotificationResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /admin/notifications [post]
+// @Security BearerAuth
+func (endpoint Endpoint) SendAdminNotification(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	data := schemas.AdminNotificationSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	receivers, errCode, errData := notificationManager.GetAdminAudience(db, data)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	notification, receiversCount, err := notificationManager.CreateAdmin(db, data.Text, receivers)
+	if err != nil {
+		return c.Status(500).JSON(utils.RequestErr(utils.ERR_SERVER_ERROR, "Couldn't send notification"))
+	}
+	note := fmt.Sprintf("Sent to %d users (%s)", receiversCount, data.Audience)
+	auditLogManager.Create(db, *user, choices.AANOTIFICATIONSENT, nil, nil, &note)
+
+	// Send to the receivers who are online
+	go endpoint.PublishAdminNotification(*notification)
+
+	response := schemas.AdminNotificationResponseSchema{
+		ResponseSchema: SuccessResponse("Notification sent"),
+		Data:           schemas.AdminNotificationDataSchema{Notification: notification.Init(nil), ReceiversCount: receiversCount},
+	}
+	return c.Status(201).JSON(response)
+}
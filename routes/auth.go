@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
@@ -57,6 +59,7 @@ func (ep Endpoint) Register(c *fiber.Ctx) error {
 // @Param verify_email body schemas.VerifyEmailRequestSchema true "Verify Email object"
 // @Success 200 {object} schemas.ResponseSchema
 // @Failure 422 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Router /auth/verify-email [post]
 func (ep Endpoint) VerifyEmail(c *fiber.Ctx) error {
 	db := ep.DB
@@ -78,14 +81,8 @@ func (ep Endpoint) VerifyEmail(c *fiber.Ctx) error {
 		return c.Status(200).JSON(SuccessResponse("Email already verified"))
 	}
 
-	otp := models.Otp{UserId: user.ID}
-	db.Take(&otp, otp)
-	if otp.ID == nil || otp.Code != data.Otp {
-		return c.Status(404).JSON(utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect Otp"))
-	}
-
-	if otp.CheckExpiration() {
-		return c.Status(400).JSON(utils.RequestErr(utils.ERR_EXPIRED_OTP, "Expired Otp"))
+	if errCode, errData := ValidateOtp(db, user, data.Otp); errData != nil {
+		return c.Status(*errCode).JSON(errData)
 	}
 
 	// Update User
@@ -103,6 +100,7 @@ func (ep Endpoint) VerifyEmail(c *fiber.Ctx) error {
 // @Param email body schemas.EmailRequestSchema true "Email data"
 // @Success 200 {object} schemas.ResponseSchema
 // @Failure 422 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Router /auth/resend-verification-email [post]
 func (ep Endpoint) ResendVerificationEmail(c *fiber.Ctx) error {
 	db := ep.DB
@@ -140,6 +138,7 @@ func (ep Endpoint) ResendVerificationEmail(c *fiber.Ctx) error {
 // @Success 200 {object} schemas.ResponseSchema
 // @Failure 422 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Router /auth/send-password-reset-otp [post]
 func (ep Endpoint) SendPasswordResetOtp(c *fiber.Ctx) error {
 	db := ep.DB
@@ -173,6 +172,7 @@ func (ep Endpoint) SendPasswordResetOtp(c *fiber.Ctx) error {
 // @Success 200 {object} schemas.ResponseSchema
 // @Failure 422 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Router /auth/set-new-password [post]
 func (ep Endpoint) SetNewPassword(c *fiber.Ctx) error {
 	db := ep.DB
@@ -190,20 +190,18 @@ func (ep Endpoint) SetNewPassword(c *fiber.Ctx) error {
 		return c.Status(404).JSON(utils.RequestErr(utils.ERR_INCORRECT_EMAIL, "Incorrect Email"))
 	}
 
-	otp := models.Otp{UserId: user.ID}
-	db.Take(&otp, otp)
-	if otp.ID == nil || otp.Code != data.Otp {
-		return c.Status(404).JSON(utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect Otp"))
-	}
-
-	if otp.CheckExpiration() {
-		return c.Status(400).JSON(utils.RequestErr(utils.ERR_EXPIRED_OTP, "Expired Otp"))
+	if errCode, errData := ValidateOtp(db, user, data.Otp); errData != nil {
+		return c.Status(*errCode).JSON(errData)
 	}
 
-	// Set Password
+	// Set Password. Proving access to the email also lifts any lockout
 	user.Password = utils.HashPassword(data.Password)
+	user.FailedLogins, user.LockedUntil = 0, nil
 	db.Save(&user)
 
+	// Log out every device since the old password may have been compromised
+	sessionManager.RevokeAll(db, user)
+
 	// Send Email
 	go senders.SendEmail(&user, "reset-success", nil)
 
@@ -212,11 +210,16 @@ func (ep Endpoint) SetNewPassword(c *fiber.Ctx) error {
 
 // @Summary Login a user
 // @Description This endpoint generates new access and refresh tokens for authentication
+// @Description
+// @Description `If the user has two-factor authentication on, a 200 with a challenge token is returned instead. Exchange it at /auth/login/2fa along with a code. Logging in to an account deleted within the grace period restores it`
 // @Tags Auth
 // @Param user body schemas.LoginSchema true "User login"
-// @Success 201 {object} schemas.ResponseSchema
+// @Success 201 {object} schemas.LoginResponseSchema
+// @Success 200 {object} schemas.TwoFactorChallengeResponseSchema
 // @Failure 422 {object} utils.ErrorResponse
 // @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
 // @Security GuestUserAuth
 // @Router /auth/login [post]
 func (ep Endpoint) Login(c *fiber.Ctx) error {
@@ -231,23 +234,106 @@ func (ep Endpoint) Login(c *fiber.Ctx) error {
 
 	user := models.User{Email: data.Email}
 	db.Take(&user, user)
-	if user.ID == nil || !utils.CheckPasswordHash(data.Password, user.Password) {
+	if user.ID == nil || user.IsPurgeDue(accountDeletionGracePeriod) {
+		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_CREDENTIALS, "Invalid Credentials"))
+	}
+
+	// Refuse even the right password while locked, or guessing could carry on regardless
+	if secondsLeft := user.LockoutSecondsLeft(); secondsLeft > 0 {
+		return AccountLockedResponse(c, secondsLeft)
+	}
+	if !utils.CheckPasswordHash(data.Password, user.Password) {
+		lockoutManager.RecordFailure(db, &user, cfg.LoginMaxAttempts, time.Duration(cfg.LoginLockoutSeconds)*time.Second)
 		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_CREDENTIALS, "Invalid Credentials"))
 	}
 
 	if !user.IsEmailVerified {
 		return c.Status(401).JSON(utils.RequestErr(utils.ERR_UNVERIFIED_USER, "Verify your email first"))
 	}
+	if user.IsSuspended {
+		return AccountSuspendedResponse(c)
+	}
 
-	// Create Auth Tokens
-	access := GenerateAccessToken(user.ID, user.Username)
-	user.Access = &access
-	refresh := GenerateRefreshToken()
-	user.Refresh = &refresh
-	db.Save(&user)
+	deviceName := "Unknown device"
+	if data.Device != nil {
+		deviceName = *data.Device
+	}
+	if user.TotpEnabled {
+		// The tokens are only issued once the 2FA code is in.
+		// Failures stay counted till then, so codes can't be guessed by logging in again and again
+		response := schemas.TwoFactorChallengeResponseSchema{
+			ResponseSchema: SuccessResponse("Two-factor authentication required"),
+			Data:           schemas.TwoFactorChallengeDataSchema{Challenge: GenerateTwoFactorChallengeToken(user.ID, deviceName)},
+		}
+		return c.Status(200).JSON(response)
+	}
+	lockoutManager.Reset(db, &user)
+	message := "Login successful"
+	if accountManager.Restore(db, &user) {
+		message = "Login successful. Your account has been restored"
+	}
+
+	// Create a session and its auth tokens
+	access, refresh := CreateSession(db, c, user, deviceName)
+	response := schemas.LoginResponseSchema{
+		ResponseSchema: SuccessResponse(message),
+		Data:           schemas.TokensResponseSchema{Access: access, Refresh: refresh},
+	}
+	return c.Status(201).JSON(response)
+}
+
+// @Summary Complete a 2FA login
+// @Description This endpoint exchanges the challenge token from /auth/login and a 2FA code for access and refresh tokens
+// @Description
+// @Description `The code can be one from the authenticator app or one of the recovery codes. A recovery code only works once`
+// @Tags Auth
+// @Param data body schemas.TwoFactorLoginSchema true "Challenge and code"
+// @Success 201 {object} schemas.LoginResponseSchema
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /auth/login/2fa [post]
+func (ep Endpoint) LoginTwoFactor(c *fiber.Ctx) error {
+	db := ep.DB
+
+	data := schemas.TwoFactorLoginSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	claims := DecodeTwoFactorChallengeToken(data.Challenge)
+	user := models.User{}
+	if claims != nil {
+		db.Take(&user, claims.UserId)
+	}
+	if user.ID == nil || !user.TotpEnabled || user.IsPurgeDue(accountDeletionGracePeriod) {
+		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_TOKEN, "Challenge token is invalid or expired"))
+	}
+	if user.IsSuspended {
+		return AccountSuspendedResponse(c)
+	}
+
+	if secondsLeft := user.LockoutSecondsLeft(); secondsLeft > 0 {
+		return AccountLockedResponse(c, secondsLeft)
+	}
+	if !twoFactorManager.VerifyCode(db, &user, data.Code) {
+		lockoutManager.RecordFailure(db, &user, cfg.LoginMaxAttempts, time.Duration(cfg.LoginLockoutSeconds)*time.Second)
+		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect authentication code"))
+	}
+	lockoutManager.Reset(db, &user)
+	message := "Login successful"
+	if accountManager.Restore(db, &user) {
+		message = "Login successful. Your account has been restored"
+	}
+
+	// Create a session and its auth tokens
+	access, refresh := CreateSession(db, c, user, claims.Device)
 	response := schemas.LoginResponseSchema{
-		ResponseSchema: SuccessResponse("Login successful"),
-		Data:           schemas.TokensResponseSchema{Access: *user.Access, Refresh: *user.Refresh},
+		ResponseSchema: SuccessResponse(message),
+		Data:           schemas.TokensResponseSchema{Access: access, Refresh: refresh},
 	}
 	return c.Status(201).JSON(response)
 }
@@ -272,19 +358,25 @@ func (ep Endpoint) Refresh(c *fiber.Ctx) error {
 	}
 
 	token := data.Refresh
-	user := models.User{Refresh: &token}
-	db.Take(&user, user)
-	if user.ID == nil || !DecodeRefreshToken(token) {
+	claims := DecodeRefreshToken(token)
+	if claims == nil {
+		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_TOKEN, "Refresh token is invalid or expired"))
+	}
+	session := sessionManager.GetByID(db, claims.SessionId)
+	if session == nil {
 		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_TOKEN, "Refresh token is invalid or expired"))
-
 	}
 
-	// Create and Update Auth Tokens
-	access := GenerateAccessToken(user.ID, user.Username)
-	user.Access = &access
-	refresh := GenerateRefreshToken()
-	user.Refresh = &refresh
-	db.Save(&user)
+	// Rotate the refresh token. A signed token that's no longer the current one has already been
+	// rotated, meaning it leaked or was replayed, so the whole session is revoked.
+	refresh := GenerateRefreshToken(session.ID)
+	if !sessionManager.Rotate(db, session, token, refresh, c.IP(), string(c.Request().Header.UserAgent())) {
+		sessionManager.Revoke(db, *session)
+		return c.Status(401).JSON(utils.RequestErr(utils.ERR_INVALID_TOKEN, "Refresh token has already been used. Session revoked"))
+	}
+	user := models.User{}
+	db.Take(&user, session.UserId)
+	access := GenerateAccessToken(user.ID, user.Username, session.ID)
 
 	response := schemas.LoginResponseSchema{
 		ResponseSchema: SuccessResponse("Tokens refresh successful"),
@@ -303,8 +395,161 @@ func (ep Endpoint) Refresh(c *fiber.Ctx) error {
 func (ep Endpoint) Logout(c *fiber.Ctx) error {
 	db := ep.DB
 	user := RequestUser(c)
-	user.Access = nil
-	user.Refresh = nil
-	db.Save(user)
+	sessionManager.Revoke(db, models.Session{BaseModel: models.BaseModel{ID: user.SessionId}})
 	return c.Status(200).JSON(SuccessResponse("Logout successful"))
 }
+
+// @Summary Retrieve Sessions
+// @Description This endpoint retrieves the active login sessions of a user, most recently used first
+// @Tags Auth
+// @Success 200 {object} schemas.SessionsResponseSchema
+// @Failure 401 {object} utils.ErrorResponse
+// @Router /auth/sessions [get]
+// @Security BearerAuth
+func (ep Endpoint) RetrieveSessions(c *fiber.Ctx) error {
+	db := ep.DB
+	user := RequestUser(c)
+	response := schemas.SessionsResponseSchema{
+		ResponseSchema: SuccessResponse("Sessions fetched"),
+		Data:           sessionManager.GetUserSessions(db, *user),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Revoke Session
+// @Description This endpoint revokes one of a user's login sessions, logging that device out
+// @Tags Auth
+// @Param id path string true "Session id (uuid)"
+// @Success 200 {object} schemas.ResponseSchema
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /auth/sessions/{id} [delete]
+// @Security BearerAuth
+func (ep Endpoint) RevokeSession(c *fiber.Ctx) error {
+	db := ep.DB
+	user := RequestUser(c)
+
+	// Parse the UUID parameter
+	sessionID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	session, errCode, errData := sessionManager.GetUserSession(db, *user, *sessionID)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	sessionManager.Revoke(db, *session)
+	return c.Status(200).JSON(SuccessResponse("Session revoked"))
+}
+
+// @Summary Set up 2FA
+// @Description This endpoint starts two-factor authentication enrolment with a new TOTP secret
+// @Description
+// @Description `Add the otpauth_uri (or the secret) to an authenticator app, then send a code from it to /auth/2fa/activate. 2FA stays off till then`
+// @Tags Auth
+// @Success 200 {object} schemas.TwoFactorSetupResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Router /auth/2fa/setup [post]
+// @Security BearerAuth
+func (ep Endpoint) SetupTwoFactor(c *fiber.Ctx) error {
+	db := ep.DB
+	user := RequestUser(c)
+	if user.TotpEnabled {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "Two-factor authentication is already enabled"))
+	}
+
+	secret := twoFactorManager.Setup(db, user)
+	response := schemas.TwoFactorSetupResponseSchema{
+		ResponseSchema: SuccessResponse("Two-factor authentication setup started"),
+		Data: schemas.TwoFactorSetupDataSchema{
+			Secret:     secret,
+			OtpauthUri: utils.TotpUri(cfg.ProjectName, user.Email, secret),
+		},
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Activate 2FA
+// @Description This endpoint turns two-factor authentication on once a code from the authenticator app checks out
+// @Description
+// @Description `The recovery codes in the response are shown this one time only. Each can stand in for a code once`
+// @Tags Auth
+// @Param data body schemas.TwoFactorCodeSchema true "Authenticator code"
+// @Success 200 {object} schemas.RecoveryCodesResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /auth/2fa/activate [post]
+// @Security BearerAuth
+func (ep Endpoint) ActivateTwoFactor(c *fiber.Ctx) error {
+	db := ep.DB
+	user := RequestUser(c)
+
+	data := schemas.TwoFactorCodeSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	if user.TotpEnabled {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "Two-factor authentication is already enabled"))
+	}
+	if user.TotpSecret == nil {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "Set up two-factor authentication first"))
+	}
+	if secondsLeft := user.LockoutSecondsLeft(); secondsLeft > 0 {
+		return AccountLockedResponse(c, secondsLeft)
+	}
+	if !twoFactorManager.VerifyTotp(db, user, data.Code) {
+		lockoutManager.RecordFailure(db, user, cfg.LoginMaxAttempts, time.Duration(cfg.LoginLockoutSeconds)*time.Second)
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect authentication code"))
+	}
+	lockoutManager.Reset(db, user)
+
+	response := schemas.RecoveryCodesResponseSchema{
+		ResponseSchema: SuccessResponse("Two-factor authentication enabled"),
+		Data:           schemas.RecoveryCodesDataSchema{RecoveryCodes: twoFactorManager.Enable(db, user)},
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Disable 2FA
+// @Description This endpoint turns two-factor authentication off. It takes a code from the authenticator app or a recovery code
+// @Tags Auth
+// @Param data body schemas.TwoFactorCodeSchema true "Authenticator or recovery code"
+// @Success 200 {object} schemas.ResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Failure 429 {object} utils.ErrorResponse
+// @Router /auth/2fa/disable [post]
+// @Security BearerAuth
+func (ep Endpoint) DisableTwoFactor(c *fiber.Ctx) error {
+	db := ep.DB
+	user := RequestUser(c)
+
+	data := schemas.TwoFactorCodeSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	if !user.TotpEnabled {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "Two-factor authentication isn't enabled"))
+	}
+	// A stolen token shouldn't be enough to guess the code and turn 2FA off
+	if secondsLeft := user.LockoutSecondsLeft(); secondsLeft > 0 {
+		return AccountLockedResponse(c, secondsLeft)
+	}
+	if !twoFactorManager.VerifyCode(db, user, data.Code) {
+		lockoutManager.RecordFailure(db, user, cfg.LoginMaxAttempts, time.Duration(cfg.LoginLockoutSeconds)*time.Second)
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect authentication code"))
+	}
+	lockoutManager.Reset(db, user)
+	twoFactorManager.Disable(db, user)
+	return c.Status(200).JSON(SuccessResponse("Two-factor authentication disabled"))
+}
@@ -1,12 +1,18 @@
 package routes
 
 import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/kayprogrammer/socialnet-v6/config"
+	"github.com/kayprogrammer/socialnet-v6/managers"
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	"time"
 )
@@ -14,22 +20,44 @@ import (
 var cfg = config.GetConfig()
 var SECRETKEY = []byte(cfg.SecretKey)
 
+var sessionManager = managers.SessionManager{}
+var lockoutManager = managers.LockoutManager{}
+var twoFactorManager = managers.TwoFactorManager{}
+var accountManager = managers.AccountManager{}
+
+// How long a deleted account can still be restored by logging in
+var accountDeletionGracePeriod = time.Duration(cfg.AccountDeletionGraceDays) * 24 * time.Hour
+
+// How long a user has to enter their 2FA code after the password
+const twoFactorChallengeExpiry = 5 * time.Minute
+const twoFactorChallengeSubject = "2fa_challenge"
+
 type AccessTokenPayload struct {
-	UserId uuid.UUID `json:"user_id"`
-	Username string `json:"username"`
+	UserId    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	SessionId uuid.UUID `json:"session_id"`
 	jwt.RegisteredClaims
 }
 
 type RefreshTokenPayload struct {
-	Data string `json:"data"`
+	Data      string    `json:"data"`
+	SessionId uuid.UUID `json:"session_id"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userId uuid.UUID, username string) string {
+// Proves the password was right while the login waits for the 2FA code
+type TwoFactorChallengePayload struct {
+	UserId uuid.UUID `json:"user_id"`
+	Device string    `json:"device"`
+	jwt.RegisteredClaims
+}
+
+func GenerateAccessToken(userId uuid.UUID, username string, sessionId uuid.UUID) string {
 	expirationTime := time.Now().Add(time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute)
 	payload := AccessTokenPayload{
-		UserId: userId,
-		Username: username,
+		UserId:    userId,
+		Username:  username,
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
@@ -47,10 +75,11 @@ func GenerateAccessToken(userId uuid.UUID, username string) string {
 	return tokenString
 }
 
-func GenerateRefreshToken() string {
+func GenerateRefreshToken(sessionId uuid.UUID) string {
 	expirationTime := time.Now().Add(time.Duration(cfg.RefreshTokenExpireMinutes) * time.Minute)
 	payload := RefreshTokenPayload{
-		Data: utils.GetRandomString(10),
+		Data:      utils.GetRandomString(10),
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
@@ -68,6 +97,24 @@ func GenerateRefreshToken() string {
 	return tokenString
 }
 
+func GenerateTwoFactorChallengeToken(userId uuid.UUID, device string) string {
+	payload := TwoFactorChallengePayload{
+		UserId: userId,
+		Device: device,
+		RegisteredClaims: jwt.RegisteredClaims{
+			// The subject keeps other tokens from passing as a challenge
+			Subject:   twoFactorChallengeSubject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeExpiry)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	tokenString, err := token.SignedString(SECRETKEY)
+	if err != nil {
+		log.Fatal("Error Generating 2FA challenge token: ", err)
+	}
+	return tokenString
+}
+
 func DecodeAccessToken(token string, db *gorm.DB) (*models.User, *string) {
 	claims := &AccessTokenPayload{}
 
@@ -81,16 +128,24 @@ func DecodeAccessToken(token string, db *gorm.DB) (*models.User, *string) {
 	if !tkn.Valid {
 		return nil, &tokenErr
 	}
-	user := models.User{Access: &token}
+	// The session must still be alive (not logged out or revoked) and belong to the user
+	session := sessionManager.GetByID(db, claims.SessionId)
+	if session == nil || !uuid.Equal(session.UserId, claims.UserId) {
+		return nil, &tokenErr
+	}
+	user := models.User{}
 	// Fetch User model object
-	result := db.Where(user).Joins("CityObj").Joins("CityObj.RegionObj").Joins("CityObj.CountryObj").Joins("AvatarObj").Take(&user, claims.UserId)
+	result := db.Joins("CityObj").Joins("CityObj.RegionObj").Joins("CityObj.CountryObj").Joins("AvatarObj").Take(&user, claims.UserId)
 	if result.Error != nil {
 		return nil, &tokenErr
 	}
+	user.SessionId = session.ID
+	sessionManager.Touch(db, *session)
 	return &user, nil
 }
 
-func DecodeRefreshToken(token string) bool {
+// Returns the refresh token's claims, or nil if the token isn't valid
+func DecodeRefreshToken(token string) *RefreshTokenPayload {
 	claims := &RefreshTokenPayload{}
 	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
 		return SECRETKEY, nil
@@ -101,11 +156,70 @@ func DecodeRefreshToken(token string) bool {
 		} else {
 			log.Println("JWT Error: ", err)
 		}
-		return false
+		return nil
 	}
 	if !tkn.Valid {
 		log.Println("Invalid Refresh Token")
-		return false
+		return nil
+	}
+	return claims
+}
+
+// Returns the challenge token's claims, or nil if the token isn't a valid challenge
+func DecodeTwoFactorChallengeToken(token string) *TwoFactorChallengePayload {
+	claims := &TwoFactorChallengePayload{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return SECRETKEY, nil
+	})
+	if err != nil || !tkn.Valid || claims.Subject != twoFactorChallengeSubject || claims.UserId == nil {
+		return nil
+	}
+	return claims
+}
+
+// Creates a session for the user and returns its access and refresh tokens
+func CreateSession(db *gorm.DB, c *fiber.Ctx, user models.User, deviceName string) (string, string) {
+	session := sessionManager.Create(db, user, deviceName, c.IP(), string(c.Request().Header.UserAgent()))
+	access := GenerateAccessToken(user.ID, user.Username, session.ID)
+	refresh := GenerateRefreshToken(session.ID)
+	db.Model(&session).UpdateColumn("refresh_hash", utils.HashToken(refresh))
+	return access, refresh
+}
+
+// Response for a login attempt on an account locked by repeated bad passwords or codes
+func AccountLockedResponse(c *fiber.Ctx, secondsLeft int) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(secondsLeft))
+	return c.Status(429).JSON(utils.RequestErr(utils.ERR_LOCKED_ACCOUNT, fmt.Sprintf("Too many failed logins. Try again in %d seconds", secondsLeft)))
+}
+
+func AccountSuspendedResponse(c *fiber.Ctx) error {
+	return c.Status(403).JSON(utils.RequestErr(utils.ERR_SUSPENDED_ACCOUNT, "Your account has been suspended"))
+}
+
+// Checks the otp sent to the user. Every check counts as an attempt (counted atomically so
+// parallel guesses can't slip through), and the code stops working after too many of them.
+func ValidateOtp(db *gorm.DB, user models.User, code uint32) (*int, *utils.ErrorResponse) {
+	otp := models.Otp{}
+	db.Model(&otp).Clauses(clause.Returning{}).Where(models.Otp{UserId: user.ID}).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	statusCode := 404
+	if otp.ID == nil {
+		errData := utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect Otp")
+		return &statusCode, &errData
+	}
+	if otp.Attempts > cfg.OtpMaxAttempts {
+		statusCode = 400
+		errData := utils.RequestErr(utils.ERR_LOCKED_OTP, "Too many incorrect attempts. Request a new otp")
+		return &statusCode, &errData
+	}
+	if otp.Code != code {
+		errData := utils.RequestErr(utils.ERR_INCORRECT_OTP, "Incorrect Otp")
+		return &statusCode, &errData
+	}
+	if otp.CheckExpiration() {
+		statusCode = 400
+		errData := utils.RequestErr(utils.ERR_EXPIRED_OTP, "Expired Otp")
+		return &statusCode, &errData
 	}
-	return true
+	return nil, nil
 }
@@ -7,31 +7,47 @@ import (
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
 )
 
 var (
-	chatManager    = managers.ChatManager{}
-	messageManager = managers.MessageManager{}
+	chatManager           = managers.ChatManager{}
+	messageManager        = managers.MessageManager{}
+	messageReceiptManager = managers.MessageReceiptManager{}
+	presenceManager       = managers.PresenceManager{}
 )
 
 // @Summary Retrieve User Chats
 // @Description `This endpoint retrieves a paginated list of the current user chats`
+// @Description
+// @Description `unread_count is the number of messages from others in the chat that the user hasn't read yet`
 // @Tags Chat
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.ChatsResponseSchema
 // @Router /chats [get]
 // @Security BearerAuth
 func (endpoint Endpoint) RetrieveUserChats(c *fiber.Ctx) error {
 	db := endpoint.DB
 	user := RequestUser(c)
-	chats := chatManager.GetUserChats(db, *user)
 
 	// Paginate, Convert type and return chats
-	paginatedData, paginatedChats, err := PaginateQueryset(chats, c, 200)
+	chats := []models.Chat{}
+	paginatedData, err := PaginateQueryset(chatManager.GetUserChats(db, *user), c, &chats, 200)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	chats = paginatedChats.([]models.Chat)
+
+	// Set the unread count of each chat
+	chatIDs := []uuid.UUID{}
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
+	}
+	unreadCounts := chatManager.GetUnreadCounts(db, *user, chatIDs)
+	for i := range chats {
+		unreadCount := unreadCounts[chats[i].ID.String()]
+		chats[i].UnreadCount = &unreadCount
+	}
 	response := schemas.ChatsResponseSchema{
 		ResponseSchema: SuccessResponse("Chats fetched"),
 		Data: schemas.ChatsResponseDataSchema{
@@ -51,7 +67,11 @@ func (endpoint Endpoint) RetrieveUserChats(c *fiber.Ctx) error {
 // @Description
 // @Description `If chat_id is available, then ignore username and set the correct chat_id`
 // @Description
-// @Description `The file_upload_data in the response is what is used for uploading the file to cloudinary from client`
+// @Description `Direct messages can't be sent when one of you blocked the other`
+// @Description
+// @Description `The file_upload_data in the response is what is used for uploading the file to the storage backend from client`
+// @Description
+// @Description `The file can be an image, video, audio or document. Its media_kind (and duration, for audio and video) show once the upload is completed`
 // @Tags Chat
 // @Param message body schemas.MessageCreateSchema true "Message object"
 // @Success 201 {object} schemas.MessageCreateResponseSchema
@@ -82,6 +102,9 @@ func (endpoint Endpoint) SendMessage(c *fiber.Ctx) error {
 			}
 			return c.Status(422).JSON(utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid entry", data))
 		}
+		if errData := blockManager.Check(db, *user, recipientUser); errData != nil {
+			return c.Status(403).JSON(errData)
+		}
 		chat = chatManager.GetDMChat(db, *user, recipientUser)
 		// Check if a chat already exists between both users
 		if chat.ID != nil {
@@ -97,10 +120,14 @@ func (endpoint Endpoint) SendMessage(c *fiber.Ctx) error {
 		if chat.ID == nil {
 			return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "User has no chat with that ID"))
 		}
+		if chat.Ctype == choices.CDM && blockManager.InDM(db, chat) {
+			return c.Status(403).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "You can't message this user"))
+		}
 	}
 
 	//Create Message
 	message := messageManager.Create(db, *user, chat, data.Text, data.FileType)
+	endpoint.SyncMessageMentions(user, chat, &message)
 
 	// Convert type and return Message
 	response := schemas.MessageCreateResponseSchema{
@@ -115,6 +142,7 @@ func (endpoint Endpoint) SendMessage(c *fiber.Ctx) error {
 // @Tags Chat
 // @Param chat_id path string true "Chat ID (uuid)"
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.ChatResponseSchema
 // @Router /chats/{chat_id} [get]
 // @Security BearerAuth
@@ -132,11 +160,11 @@ func (endpoint Endpoint) RetrieveMessages(c *fiber.Ctx) error {
 	}
 
 	// Paginate, Convert type and return Messages
-	paginatedData, paginatedMessages, err := PaginateQueryset(chat.Messages, c, 400)
+	messages := []models.Message{}
+	paginatedData, err := PaginateQueryset(messageManager.GetChatMessages(db, chat.ID), c, &messages, 400)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	var messages []models.Message = paginatedMessages.([]models.Message)
 	response := schemas.ChatResponseSchema{
 		ResponseSchema: SuccessResponse("Messages fetched"),
 		Data: schemas.MessagesSchema{
@@ -221,7 +249,7 @@ func (endpoint Endpoint) DeleteGroupChat(c *fiber.Ctx) error {
 // @Description
 // @Description `You must either send a text or a file or both.`
 // @Description
-// @Description `The file_upload_data in the response is what is used for uploading the file to cloudinary from client.`
+// @Description `The file_upload_data in the response is what is used for uploading the file to the storage backend from client.`
 // @Tags Chat
 // @Param message_id path string true "Message ID (uuid)"
 // @Param message body schemas.MessageUpdateSchema true "Message object"
@@ -249,6 +277,7 @@ func (endpoint Endpoint) UpdateMessage(c *fiber.Ctx) error {
 	}
 
 	message = messageManager.Update(db, message, data.Text, data.FileType)
+	endpoint.SyncMessageMentions(user, message.ChatObj, &message)
 	response := schemas.MessageCreateResponseSchema{
 		ResponseSchema: SuccessResponse("Message updated"),
 		Data:           message.InitC(data.FileType),
@@ -280,7 +309,7 @@ func (endpoint Endpoint) DeleteMessage(c *fiber.Ctx) error {
 	messagesCount := chatManager.GetMessagesCount(db, chat.ID)
 
 	// Send message deletion socket
-	SendMessageDeletionInSocket(c, chat.ID, message.ID)
+	endpoint.PublishMessageDeletion(chat.ID, message.ID)
 
 	// Delete message and chat if its the last message in the dm being deleted
 	if messagesCount == 1 && chat.Ctype == choices.CDM {
@@ -1,6 +1,9 @@
 package routes
 
 import (
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/kayprogrammer/socialnet-v6/managers"
 	"github.com/kayprogrammer/socialnet-v6/models"
@@ -13,20 +16,23 @@ var postManager = managers.PostManager{}
 
 // @Summary Retrieve Latest Posts
 // @Description This endpoint retrieves paginated responses of latest posts
+// @Description `Authentication is optional. It's only needed for my_reaction and is_bookmarked`
 // @Tags Feed
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.PostsResponseSchema
 // @Router /feed/posts [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrievePosts(c *fiber.Ctx) error {
 	db := endpoint.DB
-	posts := postManager.All(db)
+	user := RequestUser(c)
+	posts := []models.Post{}
 
 	// Paginate, Convert type and return Posts
-	paginatedData, paginatedPosts, err := PaginateQueryset(posts, c)
+	paginatedData, err := PaginateQueryset(postManager.All(db, user), c, &posts)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	posts = paginatedPosts.([]models.Post)
 	response := schemas.PostsResponseSchema{
 		ResponseSchema: SuccessResponse("Posts fetched"),
 		Data: schemas.PostsResponseDataSchema{
@@ -37,8 +43,39 @@ func (endpoint Endpoint) RetrievePosts(c *fiber.Ctx) error {
 	return c.Status(200).JSON(response)
 }
 
+// @Summary Retrieve Timeline
+// @Description This endpoint retrieves paginated responses of posts by the user and their friends, ranked by recency and engagement
+// @Tags Feed
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.PostsResponseSchema
+// @Router /feed/timeline [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveTimeline(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	posts := []models.Post{}
+
+	// Paginate, Convert type and return Posts
+	rankExpr := postManager.TimelineRankExpression(cfg)
+	paginatedData, err := PaginateRankedQueryset(postManager.Timeline(db, *user), c, &posts, rankExpr)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.PostsResponseSchema{
+		ResponseSchema: SuccessResponse("Timeline fetched"),
+		Data: schemas.PostsResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       posts,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
 // @Summary Create Post
 // @Description This endpoint creates a new post
+// @Description
+// @Description `Each of the file_types adds a media (image, video, audio or document) to the post, in that order. Upload them with the file_upload_data of each media in the response`
 // @Tags Feed
 // @Param post body schemas.PostInputSchema true "Post object"
 // @Success 201 {object} schemas.PostInputResponseSchema
@@ -54,28 +91,39 @@ func (endpoint Endpoint) CreatePost(c *fiber.Ctx) error {
 		return c.Status(*errCode).JSON(errData)
 	}
 
-	post := postManager.Create(db, *user, data)
+	if errCode, errData := postManager.ValidateMediaCount(len(data.FileTypes), cfg.MaxPostMedia); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	audience, errCode, errData := postManager.GetAudience(db, *user, data.Visibility, data.Audience)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	post := postManager.Create(db, *user, data, audience...)
+	endpoint.SyncTags(user, &post, nil)
 
 	// Convert type and return Post
 	response := schemas.PostInputResponseSchema{
 		ResponseSchema: SuccessResponse("Post created"),
-		Data:           post.InitC(data.FileType),
+		Data:           post.InitC(),
 	}
 	return c.Status(201).JSON(response)
 }
 
 // @Summary Retrieve Single Post
 // @Description This endpoint retrieves a single post
+// @Description `Authentication is optional. It's only needed for my_reaction and is_bookmarked`
 // @Tags Feed
 // @Param slug path string true "Post slug"
 // @Success 200 {object} schemas.PostResponseSchema
 // @Router /feed/posts/{slug} [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrievePost(c *fiber.Ctx) error {
 	db := endpoint.DB
+	user := RequestUser(c)
 	slug := c.Params("slug")
 
 	// Retrieve, Convert type and return Post
-	post, errCode, errData := postManager.GetBySlug(db, slug, true)
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -88,9 +136,11 @@ func (endpoint Endpoint) RetrievePost(c *fiber.Ctx) error {
 
 // @Summary Update Post
 // @Description This endpoint updates a post
+// @Description
+// @Description `Send media_ids to reorder the post's media or remove some. New media from file_types are added after them`
 // @Tags Feed
 // @Param slug path string true "Post slug"
-// @Param post body schemas.PostInputSchema true "Post object"
+// @Param post body schemas.PostUpdateSchema true "Post object"
 // @Success 200 {object} schemas.PostInputResponseSchema
 // @Router /feed/posts/{slug} [put]
 // @Security BearerAuth
@@ -99,7 +149,7 @@ func (endpoint Endpoint) UpdatePost(c *fiber.Ctx) error {
 	user := RequestUser(c)
 	slug := c.Params("slug")
 
-	data := schemas.PostInputSchema{}
+	data := schemas.PostUpdateSchema{}
 
 	// Validate request
 	if errCode, errData := ValidateRequest(c, &data); errData != nil {
@@ -107,7 +157,7 @@ func (endpoint Endpoint) UpdatePost(c *fiber.Ctx) error {
 	}
 
 	// Retrieve & Validate Post Existence
-	post, errCode, errData := postManager.GetBySlug(db, slug, true)
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -116,12 +166,19 @@ func (endpoint Endpoint) UpdatePost(c *fiber.Ctx) error {
 	if post.AuthorID.String() != user.ID.String() {
 		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INVALID_OWNER, "This Post isn't yours"))
 	}
+	if post.IsPlainRepost() {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "A plain repost can't be edited"))
+	}
 
 	// Update, Convert type and return Post
-	post = postManager.Update(db, post, data)
+	post, errCode, errData = postManager.Update(db, post, data, cfg.MaxPostMedia)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	endpoint.SyncTags(user, post, nil)
 	response := schemas.PostInputResponseSchema{
 		ResponseSchema: SuccessResponse("Post updated"),
-		Data:           post.InitC(data.FileType),
+		Data:           post.InitC(),
 	}
 	return c.Status(200).JSON(response)
 }
@@ -139,7 +196,7 @@ func (endpoint Endpoint) DeletePost(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Retrieve & Validate Post Existence
-	post, errCode, errData := postManager.GetBySlug(db, slug)
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -149,22 +206,87 @@ func (endpoint Endpoint) DeletePost(c *fiber.Ctx) error {
 		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INVALID_OWNER, "This Post isn't yours"))
 	}
 
-	// Delete and return response
+	// Remove Repost Notifications
+	if post.OriginalPostID != nil {
+		notification := notificationManager.Get(db, user, choices.NREPOST, post, nil)
+		if notification != nil {
+			// Send to websocket and delete notification
+			endpoint.PublishNotification(*notification, nil, nil, "DELETED")
+			db.Delete(notification)
+		}
+	}
+
+	// Delete and return response. Plain reposts of the post go along with it
 	db.Delete(&post)
 	return c.Status(200).JSON(SuccessResponse("Post Deleted"))
 }
 
+// @Summary Repost a Post
+// @Description This endpoint shares a post, either as a plain repost or as a quote.
+// @Description `Leave out the text for a plain repost, which can only be made once per post. Send text to quote the post`
+// @Description
+// @Description `Sharing a plain repost shares the post it reposts. Plain reposts are deleted along with their original, while quotes stay with a null original_post`
+// @Tags Feed
+// @Param slug path string true "Post slug"
+// @Param post body schemas.RepostInputSchema true "Repost object"
+// @Success 201 {object} schemas.PostResponseSchema
+// @Router /feed/posts/{slug}/repost [post]
+// @Security BearerAuth
+func (endpoint Endpoint) RepostPost(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	slug := c.Params("slug")
+
+	// Retrieve & Validate Post Existence
+	original, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	data := schemas.RepostInputSchema{}
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	// Repost
+	post, errCode, errData := postManager.Repost(db, *user, *original, strings.TrimSpace(data.Text))
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	if post.IsQuote {
+		endpoint.SyncTags(user, post, nil)
+	}
+
+	// Create & Send Notification
+	originalAuthor := post.OriginalPostObj.AuthorObj
+	if user.ID.String() != originalAuthor.ID.String() {
+		notification := notificationManager.Create(db, user, choices.NREPOST, []models.User{originalAuthor}, post, nil, nil)
+		endpoint.PublishNotification(notification, nil, nil)
+	}
+
+	// Convert type and return Post
+	response := schemas.PostResponseSchema{
+		ResponseSchema: SuccessResponse("Post reposted"),
+		Data:           post.Init(),
+	}
+	return c.Status(201).JSON(response)
+}
+
 var reactionManager = managers.ReactionManager{}
 
 // @Summary Retrieve Latest Reactions of a Post, Comment, or Reply
 // @Description This endpoint retrieves paginated responses of reactions of post, comment, reply
+// @Description `Authentication is optional. It's only needed for posts that aren't public`
 // @Tags Feed
 // @Param focus path string true "Specify the usage. Use any of the three: POST, COMMENT, REPLY"
 // @Param slug path string true "Enter the slug of the post or comment or reply"
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Param reaction_type query string false "Reaction Type. Must be any of these: LIKE, LOVE, HAHA, WOW, SAD, ANGRY"
 // @Success 200 {object} schemas.ReactionsResponseSchema
 // @Router /feed/reactions/{focus}/{slug} [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrieveReactions(c *fiber.Ctx) error {
 	db := endpoint.DB
 	focusParam := c.Params("focus")
@@ -177,17 +299,16 @@ func (endpoint Endpoint) RetrieveReactions(c *fiber.Ctx) error {
 		return c.Status(404).JSON(err)
 	}
 
-	// Paginate, Convert type and return Posts
-	reactions, errCode, errData := reactionManager.GetReactionsQueryset(db, c, focus, slug)
+	reactionsQueryset, errCode, errData := reactionManager.GetReactionsQueryset(db, c, focus, slug, RequestUser(c))
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
 	// Paginate, Convert type and return Reactions
-	paginatedData, paginatedReactions, err := PaginateQueryset(reactions, c)
+	reactions := []models.Reaction{}
+	paginatedData, err := PaginateQueryset(reactionsQueryset, c, &reactions)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	reactions = paginatedReactions.([]models.Reaction)
 	response := schemas.ReactionsResponseSchema{
 		ResponseSchema: SuccessResponse("Reactions fetched"),
 		Data: schemas.ReactionsResponseDataSchema{
@@ -246,10 +367,9 @@ func (endpoint Endpoint) CreateReaction(c *fiber.Ctx) error {
 			[]models.User{*targetedObjAuthor},
 			reaction.Post,
 			reaction.Comment,
-			reaction.Reply,
 		)
 		if created {
-			SendNotificationInSocket(c, notification, nil, nil)
+			endpoint.PublishNotification(notification, nil, nil)
 		}
 	}
 	return c.Status(201).JSON(response)
@@ -286,11 +406,11 @@ func (endpoint Endpoint) DeleteReaction(c *fiber.Ctx) error {
 	// Remove Reaction Notifications
 	notification := notificationManager.Get(
 		db, user, choices.NREACTION,
-		reaction.Post, reaction.Comment, reaction.Reply,
+		reaction.Post, reaction.Comment,
 	)
 	if notification != nil {
-		// Send to websocket and delete notification
-		SendNotificationInSocket(c, *notification, nil, nil, "DELETED")
+		// Send to websocket
+		endpoint.PublishNotification(*notification, nil, nil, "DELETED")
 	}
 
 	// Delete reaction and return response
@@ -302,30 +422,31 @@ var commentManager = managers.CommentManager{}
 
 // @Summary Retrieve Post Comments
 // @Description This endpoint retrieves comments of a particular post
+// @Description `Authentication is optional. It's only needed for my_reaction`
 // @Tags Feed
 // @Param slug path string true "Post Slug"
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.CommentsResponseSchema
 // @Router /feed/posts/{slug}/comments [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrieveComments(c *fiber.Ctx) error {
 	db := endpoint.DB
+	user := RequestUser(c)
 	slug := c.Params("slug")
 
 	// Get Post
-	post, errCode, errData := postManager.GetBySlug(db, slug)
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
 
-	// Get Comments
-	comments := commentManager.GetByPostID(db, post.ID)
-
 	// Paginate, Convert type and return comments
-	paginatedData, paginatedComments, err := PaginateQueryset(comments, c)
+	comments := []models.Comment{}
+	paginatedData, err := PaginateQueryset(commentManager.GetByPostID(commentManager.ForViewer(db, user), post.ID), c, &comments)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	comments = paginatedComments.([]models.Comment)
 	response := schemas.CommentsResponseSchema{
 		ResponseSchema: SuccessResponse("Comments fetched"),
 		Data: schemas.CommentsResponseDataSchema{
@@ -350,7 +471,7 @@ func (endpoint Endpoint) CreateComment(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Get Post
-	post, errCode, errData := postManager.GetBySlug(db, slug)
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -363,11 +484,12 @@ func (endpoint Endpoint) CreateComment(c *fiber.Ctx) error {
 
 	// Create Comment
 	comment := commentManager.Create(db, *user, *post, data.Text)
+	endpoint.SyncTags(user, nil, &comment)
 
 	// Created & Send Notification
 	if user.ID.String() != post.AuthorID.String() {
-		notification := notificationManager.Create(db, user, choices.NCOMMENT, []models.User{post.AuthorObj}, nil, &comment, nil, nil)
-		SendNotificationInSocket(c, notification, nil, nil)
+		notification := notificationManager.Create(db, user, choices.NCOMMENT, []models.User{post.AuthorObj}, nil, &comment, nil)
+		endpoint.PublishNotification(notification, nil, nil)
 	}
 
 	response := schemas.CommentResponseSchema{
@@ -378,28 +500,42 @@ func (endpoint Endpoint) CreateComment(c *fiber.Ctx) error {
 }
 
 // @Summary Retrieve Comment with replies
-// @Description This endpoint retrieves a comment with replies
+// @Description This endpoint retrieves a comment (or reply) with a tree of the replies under it.
+// @Description `Only the direct replies are paginated. Each of them carries its own replies, nested down to the given depth`
+// @Description `A reply at the bottom of the tree has no replies field even when its replies_count isn't 0. Fetch it with this endpoint to continue the thread`
+// @Description `Authentication is optional. It's only needed for my_reaction`
 // @Tags Feed
 // @Param slug path string true "Comment Slug"
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Param depth query int false "Levels of replies to include. Capped at the maximum comment depth" default(5)
 // @Success 200 {object} schemas.CommentWithRepliesResponseSchema
 // @Router /feed/comments/{slug} [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrieveCommentWithReplies(c *fiber.Ctx) error {
 	db := endpoint.DB
+	user := RequestUser(c)
 	slug := c.Params("slug")
+	depth := c.QueryInt("depth", cfg.MaxCommentDepth)
+	if depth < 1 {
+		depth = 1
+	} else if depth > cfg.MaxCommentDepth {
+		depth = cfg.MaxCommentDepth
+	}
 
 	// Get Comment
-	comment, errCode, errData := commentManager.GetBySlug(db, slug, true)
+	comment, errCode, errData := commentManager.GetBySlug(commentManager.ForViewer(db, user), slug, true)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
 
-	// Paginate, Convert type and return replies
-	paginatedData, paginatedReplies, err := PaginateQueryset(comment.Replies, c)
+	// Paginate the direct replies, then fill in the threads below them
+	replies := []models.Comment{}
+	paginatedData, err := PaginateQueryset(commentManager.GetByParentID(commentManager.ForViewer(db, user), comment.ID), c, &replies)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	replies := paginatedReplies.([]models.Reply)
+	commentManager.LoadThreads(commentManager.ForViewer(db, user), replies, comment.Depth+depth)
 	response := schemas.CommentWithRepliesResponseSchema{
 		ResponseSchema: SuccessResponse("Comment with replies fetched"),
 		Data: schemas.CommentWithRepliesSchema{
@@ -413,10 +549,9 @@ func (endpoint Endpoint) RetrieveCommentWithReplies(c *fiber.Ctx) error {
 	return c.Status(200).JSON(response)
 }
 
-var replyManager = managers.ReplyManager{}
-
 // @Summary Create Reply
-// @Description This endpoint creates a reply for a comment
+// @Description This endpoint creates a reply for a comment or for another reply.
+// @Description `Replies can only be nested down to the maximum comment depth`
 // @Tags Feed
 // @Param slug path string true "Comment Slug"
 // @Param reply body schemas.CommentInputSchema true "Reply object"
@@ -429,11 +564,15 @@ func (endpoint Endpoint) CreateReply(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Get Comment
-	comment, errCode, errData := commentManager.GetBySlug(db, slug)
+	comment, errCode, errData := commentManager.GetBySlug(commentManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
 
+	if comment.Depth >= cfg.MaxCommentDepth {
+		return c.Status(403).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "Replies can't be nested any deeper"))
+	}
+
 	data := schemas.CommentInputSchema{}
 	// Validate request
 	if errCode, errData := ValidateRequest(c, &data); errData != nil {
@@ -441,12 +580,13 @@ func (endpoint Endpoint) CreateReply(c *fiber.Ctx) error {
 	}
 
 	// Create reply
-	reply := replyManager.Create(db, *user, *comment, data.Text)
+	reply := commentManager.CreateReply(db, *user, *comment, data.Text)
+	endpoint.SyncTags(user, nil, &reply)
 
 	// Created & Send Notification
 	if user.ID.String() != comment.AuthorID.String() {
-		notification := notificationManager.Create(db, user, choices.NREPLY, []models.User{comment.AuthorObj}, nil, nil, &reply, nil)
-		SendNotificationInSocket(c, notification, nil, nil)
+		notification := notificationManager.Create(db, user, choices.NREPLY, []models.User{comment.AuthorObj}, nil, &reply, nil)
+		endpoint.PublishNotification(notification, nil, nil)
 	}
 
 	// Convert type and return reply
@@ -471,7 +611,7 @@ func (endpoint Endpoint) UpdateComment(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Get Comment
-	comment, errCode, errData := commentManager.GetBySlug(db, slug, true)
+	comment, errCode, errData := commentManager.GetBySlug(commentManager.ForViewer(db, user), slug, true)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -487,6 +627,7 @@ func (endpoint Endpoint) UpdateComment(c *fiber.Ctx) error {
 
 	// Update Comment
 	updatedComment := commentManager.Update(db, *comment, user, data.Text)
+	endpoint.SyncTags(user, nil, &updatedComment)
 
 	// Convert type and return comment
 	response := schemas.CommentResponseSchema{
@@ -509,7 +650,7 @@ func (endpoint Endpoint) DeleteComment(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Retrieve & Validate Comment Existence & Ownership
-	comment, errCode, errData := commentManager.GetBySlug(db, slug)
+	comment, errCode, errData := commentManager.GetBySlug(commentManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -517,32 +658,43 @@ func (endpoint Endpoint) DeleteComment(c *fiber.Ctx) error {
 		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INVALID_OWNER, "Not yours to delete"))
 	}
 
-	// Remove Comment Notifications
+	// Remove Comment Notifications. The comment may be a reply to another comment
+	ntype, commentSlug, replySlug := choices.NCOMMENT, &comment.Slug, (*string)(nil)
+	if comment.ParentID != nil {
+		ntype, commentSlug, replySlug = choices.NREPLY, nil, &comment.Slug
+	}
 	notification := notificationManager.Get(
-		db, user, choices.NCOMMENT,
-		nil, comment, nil,
+		db, user, ntype,
+		nil, comment,
 	)
 	if notification != nil {
-		// Send to websocket and delete notification & comment
-		SendNotificationInSocket(c, *notification, &comment.Slug, nil, "DELETED")
+		// Send to websocket and delete notification
+		endpoint.PublishNotification(*notification, commentSlug, replySlug, "DELETED")
+		db.Delete(notification)
 	}
 
+	// Delete comment along with the replies under it
+	db.Delete(comment)
+
 	// Return response
 	return c.Status(200).JSON(SuccessResponse("Comment Deleted"))
 }
 
 // @Summary Retrieve Reply
 // @Description This endpoint retrieves a reply
+// @Description `Authentication is optional. It's only needed for my_reaction`
 // @Tags Feed
 // @Param slug path string true "Reply Slug"
 // @Success 200 {object} schemas.ReplyResponseSchema
 // @Router /feed/replies/{slug} [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrieveReply(c *fiber.Ctx) error {
 	db := endpoint.DB
+	user := RequestUser(c)
 	slug := c.Params("slug")
 
 	// Get Reply
-	reply, errCode, errData := replyManager.GetBySlug(db, slug, true)
+	reply, errCode, errData := commentManager.GetReplyBySlug(commentManager.ForViewer(db, user), slug, true)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -569,7 +721,7 @@ func (endpoint Endpoint) UpdateReply(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Get Reply
-	reply, errCode, errData := replyManager.GetBySlug(db, slug, true)
+	reply, errCode, errData := commentManager.GetReplyBySlug(commentManager.ForViewer(db, user), slug, true)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -584,7 +736,8 @@ func (endpoint Endpoint) UpdateReply(c *fiber.Ctx) error {
 	}
 
 	// Update Reply
-	updatedReply := replyManager.Update(db, *reply, user, data.Text)
+	updatedReply := commentManager.Update(db, *reply, user, data.Text)
+	endpoint.SyncTags(user, nil, &updatedReply)
 
 	// Convert type and return reply
 	response := schemas.ReplyResponseSchema{
@@ -607,7 +760,7 @@ func (endpoint Endpoint) DeleteReply(c *fiber.Ctx) error {
 	user := RequestUser(c)
 
 	// Retrieve & Validate Reply Existence & Ownership
-	reply, errCode, errData := replyManager.GetBySlug(db, slug)
+	reply, errCode, errData := commentManager.GetReplyBySlug(commentManager.ForViewer(db, user), slug)
 	if errCode != nil {
 		return c.Status(*errCode).JSON(errData)
 	}
@@ -618,13 +771,261 @@ func (endpoint Endpoint) DeleteReply(c *fiber.Ctx) error {
 	// Remove Reply Notifications
 	notification := notificationManager.Get(
 		db, user, choices.NREPLY,
-		nil, nil, reply,
+		nil, reply,
 	)
 	if notification != nil {
 		// Send to websocket and delete notification
-		SendNotificationInSocket(c, *notification, nil, &reply.Slug, "DELETED")
+		endpoint.PublishNotification(*notification, nil, &reply.Slug, "DELETED")
+		db.Delete(notification)
 	}
 
+	// Delete reply along with the replies under it
+	db.Delete(reply)
+
 	// Return response
 	return c.Status(200).JSON(SuccessResponse("Reply Deleted"))
 }
+
+// @Summary Retrieve Trending Hashtags
+// @Description This endpoint retrieves the hashtags used the most in posts and comments lately.
+// @Description `Uses are counted over a sliding window that ends now`
+// @Tags Feed
+// @Param limit query int false "Number of hashtags to return (50 at most)" default(10)
+// @Success 200 {object} schemas.TrendingHashtagsResponseSchema
+// @Router /feed/hashtags/trending [get]
+func (endpoint Endpoint) RetrieveTrendingHashtags(c *fiber.Ctx) error {
+	db := endpoint.DB
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 {
+		limit = 1
+	} else if limit > 50 {
+		limit = 50
+	}
+
+	window := time.Duration(cfg.TrendingWindowHours) * time.Hour
+	response := schemas.TrendingHashtagsResponseSchema{
+		ResponseSchema: SuccessResponse("Trending hashtags fetched"),
+		Data:           hashtagManager.Trending(db, window, limit),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Retrieve Hashtag Posts
+// @Description This endpoint retrieves paginated responses of latest posts with a hashtag
+// @Description `Authentication is optional. It's only needed for my_reaction and is_bookmarked`
+// @Tags Feed
+// @Param tag path string true "Hashtag, without the #"
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.PostsResponseSchema
+// @Router /feed/hashtags/{tag} [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveHashtagPosts(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	tag := utils.NormalizeHashtag(c.Params("tag"))
+	posts := []models.Post{}
+
+	// Paginate, Convert type and return Posts
+	paginatedData, err := PaginateQueryset(postManager.ByHashtag(db, tag, user), c, &posts)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.PostsResponseSchema{
+		ResponseSchema: SuccessResponse("Posts fetched"),
+		Data: schemas.PostsResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       posts,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+var bookmarkManager = managers.BookmarkManager{}
+
+// @Summary Retrieve Bookmarks
+// @Description This endpoint retrieves paginated responses of the posts bookmarked by the user
+// @Tags Feed
+// @Param collection_id query string false "Only the posts in this collection (uuid)"
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.PostsResponseSchema
+// @Router /feed/bookmarks [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveBookmarks(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	var collection *models.Collection
+	if collectionID := c.Query("collection_id"); collectionID != "" {
+		id, err := utils.ParseUUID(collectionID)
+		if err != nil {
+			return c.Status(400).JSON(err)
+		}
+		var errCode *int
+		var errData *utils.ErrorResponse
+		collection, errCode, errData = bookmarkManager.GetCollection(db, *user, *id)
+		if errCode != nil {
+			return c.Status(*errCode).JSON(errData)
+		}
+	}
+
+	// Paginate, Convert type and return Posts
+	posts := []models.Post{}
+	paginatedData, err := PaginateQueryset(bookmarkManager.Posts(db, *user, collection), c, &posts)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.PostsResponseSchema{
+		ResponseSchema: SuccessResponse("Bookmarks fetched"),
+		Data: schemas.PostsResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       posts,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Bookmark a Post
+// @Description This endpoint bookmarks a post, into one of the user's collections or into none.
+// @Description `Bookmarking a post that is already bookmarked moves it into the collection, or out of its collection when collection_id is left out`
+// @Tags Feed
+// @Param slug path string true "Post slug"
+// @Param bookmark body schemas.BookmarkInputSchema true "Bookmark object"
+// @Success 201 {object} schemas.PostResponseSchema
+// @Router /feed/posts/{slug}/bookmark [post]
+// @Security BearerAuth
+func (endpoint Endpoint) BookmarkPost(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	slug := c.Params("slug")
+
+	// Retrieve & Validate Post Existence
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	data := schemas.BookmarkInputSchema{}
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	var collection *models.Collection
+	if data.CollectionID != nil {
+		collection, errCode, errData = bookmarkManager.GetCollection(db, *user, *data.CollectionID)
+		if errCode != nil {
+			return c.Status(*errCode).JSON(errData)
+		}
+	}
+
+	// Bookmark, Convert type and return Post
+	post.Bookmarks = []models.Bookmark{bookmarkManager.Save(db, *user, *post, collection)}
+	response := schemas.PostResponseSchema{
+		ResponseSchema: SuccessResponse("Post bookmarked"),
+		Data:           post.Init(),
+	}
+	return c.Status(201).JSON(response)
+}
+
+// @Summary Remove a Bookmark
+// @Description This endpoint removes the user's bookmark of a post, taking it out of its collection too
+// @Tags Feed
+// @Param slug path string true "Post slug"
+// @Success 200 {object} schemas.ResponseSchema
+// @Router /feed/posts/{slug}/bookmark [delete]
+// @Security BearerAuth
+func (endpoint Endpoint) DeleteBookmark(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	slug := c.Params("slug")
+
+	// Retrieve & Validate Post Existence
+	post, errCode, errData := postManager.GetBySlug(postManager.ForViewer(db, user), slug)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	bookmark := bookmarkManager.Get(db, *user, *post)
+	if bookmark == nil {
+		return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "You haven't bookmarked this post"))
+	}
+
+	// Delete and return response
+	db.Delete(bookmark)
+	return c.Status(200).JSON(SuccessResponse("Bookmark removed"))
+}
+
+// @Summary Retrieve Collections
+// @Description This endpoint retrieves the user's bookmark collections
+// @Tags Feed
+// @Success 200 {object} schemas.CollectionsResponseSchema
+// @Router /feed/bookmarks/collections [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveCollections(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	// Convert type and return Collections
+	collections := bookmarkManager.GetCollections(db, *user)
+	response := schemas.CollectionsResponseSchema{
+		ResponseSchema: SuccessResponse("Collections fetched"),
+		Data:           collections,
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Create Collection
+// @Description This endpoint creates a named collection for the user's bookmarks
+// @Tags Feed
+// @Param collection body schemas.CollectionInputSchema true "Collection object"
+// @Success 201 {object} schemas.CollectionResponseSchema
+// @Router /feed/bookmarks/collections [post]
+// @Security BearerAuth
+func (endpoint Endpoint) CreateCollection(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	data := schemas.CollectionInputSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	// Create, Convert type and return Collection
+	collection, errCode, errData := bookmarkManager.CreateCollection(db, *user, strings.TrimSpace(data.Name))
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	response := schemas.CollectionResponseSchema{
+		ResponseSchema: SuccessResponse("Collection created"),
+		Data:           *collection,
+	}
+	return c.Status(201).JSON(response)
+}
+
+// @Summary Delete Collection
+// @Description This endpoint deletes one of the user's bookmark collections.
+// @Description `The posts in it stay bookmarked, outside collections`
+// @Tags Feed
+// @Param id path string true "Collection ID (uuid)"
+// @Success 200 {object} schemas.ResponseSchema
+// @Router /feed/bookmarks/collections/{id} [delete]
+// @Security BearerAuth
+func (endpoint Endpoint) DeleteCollection(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	// Parse the UUID parameter
+	collectionID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	collection, errCode, errData := bookmarkManager.GetCollection(db, *user, *collectionID)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	// Delete and return response
+	db.Delete(collection)
+	return c.Status(200).JSON(SuccessResponse("Collection Deleted"))
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/managers"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/storage"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+)
+
+var fileManager = managers.FileManager{}
+
+// Checks the signature of a presigned local storage url and returns the key it was signed for
+func verifyMediaRequest(c *fiber.Ctx, method string, contentType string) (string, *utils.ErrorResponse) {
+	key := c.Params("*")
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !storage.Local().Verify(method, key, contentType, expires, c.Query("signature")) {
+		errData := utils.RequestErr(utils.ERR_INVALID_TOKEN, "Invalid or expired signature")
+		return "", &errData
+	}
+	return key, nil
+}
+
+// @Summary Upload a file
+// @Description `This endpoint receives files for the local storage backend. Send the file as the raw body to the url in the file_upload_data of a response, along with its headers.`
+// @Tags Media
+// @Param key path string true "Key of the file"
+// @Param expires query int true "Expiry of the url"
+// @Param signature query string true "Signature of the url"
+// @Success 200 {object} schemas.ResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 413 {object} utils.ErrorResponse
+// @Router /media/{key} [put]
+func (ep Endpoint) UploadMedia(c *fiber.Ctx) error {
+	contentType := c.Get("Content-Type")
+	key, errData := verifyMediaRequest(c, "PUT", contentType)
+	if errData != nil {
+		return c.Status(403).JSON(errData)
+	}
+	if int64(len(c.Body())) > storage.MaxSize(contentType) {
+		return c.Status(413).JSON(utils.RequestErr(utils.ERR_INVALID_ENTRY, "File is too large"))
+	}
+	if err := storage.Local().Save(key, c.Body()); err != nil {
+		return c.Status(500).JSON(utils.RequestErr(utils.ERR_SERVER_ERROR, "Couldn't save file"))
+	}
+	return c.Status(200).JSON(SuccessResponse("File uploaded successfully"))
+}
+
+// @Summary Retrieve a file
+// @Description `This endpoint serves files of the local storage backend. The urls in responses come signed already.`
+// @Tags Media
+// @Param key path string true "Key of the file"
+// @Param expires query int true "Expiry of the url"
+// @Param signature query string true "Signature of the url"
+// @Success 200
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /media/{key} [get]
+func (ep Endpoint) RetrieveMedia(c *fiber.Ctx) error {
+	key, errData := verifyMediaRequest(c, "GET", "")
+	if errData != nil {
+		return c.Status(403).JSON(errData)
+	}
+	path, err := storage.Local().Path(key)
+	if err == nil {
+		_, err = os.Stat(path)
+	}
+	if err != nil {
+		return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "File does not exist"))
+	}
+	return c.SendFile(path)
+}
+
+// @Summary Complete an upload
+// @Description This endpoint confirms that a file was uploaded with its file_upload_data
+// @Description
+// @Description `Call it with the file_id of the file_upload_data once the upload is done. The file's url is only returned after that, and uploads that are never confirmed get deleted`
+// @Description
+// @Description `The upload fails (422) if its content isn't of the file type given, or is over the max_size for that kind of file`
+// @Tags Media
+// @Param id path string true "File id (uuid)"
+// @Success 200 {object} schemas.FileResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 401 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Router /media/files/{id}/complete [post]
+// @Security BearerAuth
+func (ep Endpoint) CompleteUpload(c *fiber.Ctx) error {
+	db := ep.DB
+
+	// Parse the UUID parameter
+	fileID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	file, errCode, errData := fileManager.GetUpload(db, *fileID, *RequestUser(c))
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	errCode, errData = fileManager.Complete(db, file)
+	if errCode != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	response := schemas.FileResponseSchema{
+		ResponseSchema: SuccessResponse("Upload completed"),
+		Data:           *file,
+	}
+	return c.Status(200).JSON(response)
+}
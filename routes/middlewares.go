@@ -1,9 +1,14 @@
 package routes
 
 import (
+	"encoding/json"
+	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/config"
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"gorm.io/gorm"
@@ -36,6 +41,24 @@ func (ep Endpoint) AuthMiddleware(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// Lets only staff and superusers through. Goes after AuthMiddleware
+func (ep Endpoint) StaffMiddleware(c *fiber.Ctx) error {
+	user := RequestUser(c)
+	if user == nil || !(user.IsStaff || user.IsSuperuser) {
+		return c.Status(403).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "For staff only"))
+	}
+	return c.Next()
+}
+
+// Lets only superusers through. Goes after AuthMiddleware
+func (ep Endpoint) SuperuserMiddleware(c *fiber.Ctx) error {
+	user := RequestUser(c)
+	if user == nil || !user.IsSuperuser {
+		return c.Status(403).JSON(utils.RequestErr(utils.ERR_NOT_ALLOWED, "For superusers only"))
+	}
+	return c.Next()
+}
+
 func (ep Endpoint) GuestMiddleware(c *fiber.Ctx) error {
 	token := c.Get("Authorization")
 	db := ep.DB
@@ -50,3 +73,53 @@ func (ep Endpoint) GuestMiddleware(c *fiber.Ctx) error {
 	c.Locals("user", user)
 	return c.Next()
 }
+
+// Fiber settings for taking the client IP (which RateLimitMiddleware throttles by) from the proxy header.
+// Behind a proxy every request comes from its address, so all clients would share one limit otherwise.
+// The header is only believed on requests from the trusted proxies, since anyone can send it.
+func ProxyConfig(cfg config.Config, appCfg fiber.Config) fiber.Config {
+	if cfg.ProxyHeader == "" {
+		return appCfg
+	}
+	appCfg.ProxyHeader = cfg.ProxyHeader
+	appCfg.EnableTrustedProxyCheck = true
+	appCfg.EnableIPValidation = true
+	for _, proxy := range strings.Split(cfg.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			appCfg.TrustedProxies = append(appCfg.TrustedProxies, proxy)
+		}
+	}
+	return appCfg
+}
+
+// Throttles a route per client IP and, when the request body holds an email, per account.
+// Behind AuthMiddleware the account is the signed in user's. Hits past a limit within the sliding window get a 429.
+func (ep Endpoint) RateLimitMiddleware(name string, ipLimit int, accountLimit int, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limits := map[string]int{name + ":ip:" + c.IP(): ipLimit}
+		data := struct {
+			Email string `json:"email"`
+		}{}
+		if user, ok := c.Locals("user").(*models.User); ok && user != nil {
+			data.Email = user.Email
+		} else {
+			json.Unmarshal(c.Body(), &data)
+		}
+		if data.Email != "" {
+			limits[name+":account:"+strings.ToLower(data.Email)] = accountLimit
+		}
+		for key, limit := range limits {
+			hits, err := ep.RateLimiter.Hit(key, window)
+			if err != nil {
+				// Don't lock everyone out when the store is down
+				log.Println("Error counting rate limited hit: ", err)
+				continue
+			}
+			if hits > float64(limit) {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(window.Seconds())))
+				return c.Status(429).JSON(utils.RequestErr(utils.ERR_TOO_MANY_REQUESTS, "Too many requests. Try again later"))
+			}
+		}
+		return c.Next()
+	}
+}
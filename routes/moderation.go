@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/managers"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+)
+
+var reportManager = managers.ReportManager{}
+var auditLogManager = managers.AuditLogManager{}
+
+// @Summary Report a Post, Comment, Reply, Message or Profile
+// @Description This endpoint reports content or a user to the staff, with a reason
+// @Description `key is the slug for posts, comments and replies, the message id for messages and the username for profiles. reason should be any of these: SPAM, HARASSMENT, HATE_SPEECH, VIOLENCE, NUDITY, MISINFORMATION, IMPERSONATION, OTHER`
+// @Tags Moderation
+// @Param target path string true "What is reported. Use any of these: POST, COMMENT, REPLY, MESSAGE, PROFILE"
+// @Param key path string true "Slug, message id or username of what is reported"
+// @Param report body schemas.ReportInputSchema true "Report object"
+// @Success 201 {object} schemas.ResponseSchema
+// @Router /reports/{target}/{key} [post]
+// @Security BearerAuth
+func (endpoint Endpoint) CreateReport(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	// Validate Target
+	target := choices.ReportTargetChoice(c.Params("target"))
+	if err := ValidateReportTarget(target); err != nil {
+		return c.Status(404).JSON(err)
+	}
+
+	data := schemas.ReportInputSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	report, errCode, errData := reportManager.GetTarget(db, *user, target, c.Params("key"))
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	if _, created := reportManager.Create(db, *report, data); !created {
+		return c.Status(200).JSON(SuccessResponse("You have already reported this"))
+	}
+	return c.Status(201).JSON(SuccessResponse("Report submitted"))
+}
+
+// @Summary Retrieve Reports
+// @Description This endpoint retrieves a paginated list of reports, latest first
+// @Description `For staff only`
+// @Tags Admin
+// @Param status query string false "Filter by status. Use any of these: PENDING, REVIEWING, RESOLVED, DISMISSED"
+// @Param target query string false "Filter by target. Use any of these: POST, COMMENT, REPLY, MESSAGE, PROFILE"
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.ReportsResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Router /admin/reports [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveReports(c *fiber.Ctx) error {
+	db := endpoint.DB
+
+	// Paginate and return reports
+	reports := []models.Report{}
+	paginatedData, err := PaginateQueryset(reportManager.GetAll(db, c.Query("status"), c.Query("target")), c, &reports)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.ReportsResponseSchema{
+		ResponseSchema: SuccessResponse("Reports fetched"),
+		Data: schemas.ReportsResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       reports,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Retrieve Report
+// @Description This endpoint retrieves a report, with the reported content
+// @Description `For staff only`
+// @Tags Admin
+// @Param id path string true "Report id (uuid)"
+// @Success 200 {object} schemas.ReportResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/reports/{id} [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveReport(c *fiber.Ctx) error {
+	db := endpoint.DB
+
+	// Parse the UUID parameter
+	reportID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	report, errCode, errData := reportManager.GetByID(db, *reportID)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	response := schemas.ReportResponseSchema{
+		ResponseSchema: SuccessResponse("Report fetched"),
+		Data:           report.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Triage Report
+// @Description This endpoint takes a pending report up for review by the auth staff member
+// @Description `For staff only`
+// @Tags Admin
+// @Param id path string true "Report id (uuid)"
+// @Success 200 {object} schemas.ReportResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Router /admin/reports/{id}/triage [post]
+// @Security BearerAuth
+func (endpoint Endpoint) TriageReport(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	// Parse the UUID parameter
+	reportID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	report, errCode, errData := reportManager.GetByID(db, *reportID)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	report, errCode, errData = reportManager.Triage(db, report, *user)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	response := schemas.ReportResponseSchema{
+		ResponseSchema: SuccessResponse("Report under review"),
+		Data:           report.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Resolve Report
+// @Description This endpoint closes a report with an action on it
+// @Description `For staff only. action should be any of these: DISMISS, RESOLVE, HIDE_CONTENT, SUSPEND_USER. HIDE_CONTENT hides the reported post, comment, reply or message from everyone. SUSPEND_USER logs the offender out and keeps them from logging in`
+// @Tags Admin
+// @Param id path string true "Report id (uuid)"
+// @Param action body schemas.ReportActionSchema true "Action object"
+// @Success 200 {object} schemas.ReportResponseSchema
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 422 {object} utils.ErrorResponse
+// @Router /admin/reports/{id}/resolve [post]
+// @Security BearerAuth
+func (endpoint Endpoint) ResolveReport(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	// Parse the UUID parameter
+	reportID, err := utils.ParseUUID(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+
+	data := schemas.ReportActionSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	report, errCode, errData := reportManager.GetByID(db, *reportID)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	report, errCode, errData = reportManager.Resolve(db, report, *user, data)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	message := "Report resolved"
+	if report.Status == choices.RSDISMISSED {
+		message = "Report dismissed"
+	}
+	response := schemas.ReportResponseSchema{
+		ResponseSchema: SuccessResponse(message),
+		Data:           report.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Retrieve Audit Logs
+// @Description This endpoint retrieves a paginated list of what staff did, latest first
+// @Description `For staff only`
+// @Tags Admin
+// @Param action query string false "Filter by action. E.g REPORT_TRIAGED, REPORT_RESOLVED, CONTENT_HIDDEN, USER_SUSPENDED, USER_REACTIVATED, STAFF_GRANTED, EMAIL_VERIFIED, SITE_DETAIL_UPDATED"
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.AuditLogsResponseSchema
+// @Failure 403 {object} utils.ErrorResponse
+// @Router /admin/audit-logs [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveAuditLogs(c *fiber.Ctx) error {
+	db := endpoint.DB
+
+	// Paginate and return audit logs
+	auditLogs := []models.AuditLog{}
+	paginatedData, err := PaginateQueryset(auditLogManager.GetAll(db, c.Query("action")), c, &auditLogs)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	response := schemas.AuditLogsResponseSchema{
+		ResponseSchema: SuccessResponse("Audit logs fetched"),
+		Data: schemas.AuditLogsResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       auditLogs,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
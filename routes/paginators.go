@@ -1,22 +1,93 @@
 package routes
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
 	"math"
 	"reflect"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func PaginateQueryset(queryset interface{}, fiberCtx *fiber.Ctx, opts ...int) (*schemas.PaginatedResponseDataSchema, any, *utils.ErrorResponse) {
-	currentPage := fiberCtx.QueryInt("page", 1)
-	var perPage int
+// Keyset position of a row. It is handed to clients as an opaque token.
+type paginationCursor struct {
+	CreatedAt time.Time `json:"c"`
+	Rank      *float64  `json:"r,omitempty"` // Set for querysets ordered by a rank expression
+	ID        uuid.UUID `json:"i"`
+	Prev      bool      `json:"p,omitempty"`
+}
 
-	if currentPage < 1 {
-		errData := utils.RequestErr(utils.ERR_INVALID_PAGE, "Invalid Page")
-		return nil, nil, &errData
+func (cursor paginationCursor) keyValue() interface{} {
+	if cursor.Rank != nil {
+		return *cursor.Rank
+	}
+	return cursor.CreatedAt
+}
+
+func encodeCursor(item reflect.Value, rank *float64, prev bool) *string {
+	cursor := paginationCursor{
+		CreatedAt: item.FieldByName("CreatedAt").Interface().(time.Time),
+		Rank:      rank,
+		ID:        item.FieldByName("ID").Interface().(uuid.UUID),
+		Prev:      prev,
+	}
+	data, _ := json.Marshal(cursor)
+	token := base64.RawURLEncoding.EncodeToString(data)
+	return &token
+}
+
+func decodeCursor(token string, ranked bool) (*paginationCursor, *utils.ErrorResponse) {
+	cursor := paginationCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
 	}
+	if err != nil || cursor.ID == nil || ranked != (cursor.Rank != nil) {
+		errData := utils.RequestErr(utils.ERR_INVALID_PAGE, "Invalid cursor")
+		return nil, &errData
+	}
+	return &cursor, nil
+}
+
+func orderBy(keyColumn interface{}, idColumn clause.Column, direction string) clause.OrderBy {
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                fmt.Sprintf("(?) %s, ? %s", direction, direction),
+		Vars:               []interface{}{keyColumn, idColumn},
+		WithoutParentheses: true,
+	}}
+}
+
+// Reverses the slice held by the given (settable) reflect value in place
+func reverseItems(itemsValue reflect.Value) {
+	swap := reflect.Swapper(itemsValue.Interface())
+	for i, j := 0, itemsValue.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
+
+// PaginateQueryset runs the query with LIMIT/OFFSET (page param) or a keyset cursor (cursor param)
+// and loads just the requested page into items, which must be a pointer to a slice of models.
+// Rows are ordered by (created_at, id) descending.
+func PaginateQueryset(query *gorm.DB, fiberCtx *fiber.Ctx, items interface{}, opts ...int) (*schemas.PaginatedResponseDataSchema, *utils.ErrorResponse) {
+	return paginate(query, fiberCtx, items, nil, opts...)
+}
+
+// PaginateRankedQueryset works like PaginateQueryset but orders rows by (rank, id) descending.
+// rank must be a numeric SQL expression over the queried table.
+func PaginateRankedQueryset(query *gorm.DB, fiberCtx *fiber.Ctx, items interface{}, rank clause.Expr, opts ...int) (*schemas.PaginatedResponseDataSchema, *utils.ErrorResponse) {
+	return paginate(query, fiberCtx, items, &rank, opts...)
+}
+
+func paginate(query *gorm.DB, fiberCtx *fiber.Ctx, items interface{}, rank *clause.Expr, opts ...int) (*schemas.PaginatedResponseDataSchema, *utils.ErrorResponse) {
+	var perPage int
 
 	// Check if page size is provided as an argument
 	if len(opts) > 0 {
@@ -25,35 +96,107 @@ func PaginateQueryset(queryset interface{}, fiberCtx *fiber.Ctx, opts ...int) (*
 		// Default page size if not provided
 		perPage = 50
 	}
-	querysetValue := reflect.ValueOf(queryset)
-	itemsCount := querysetValue.Len()
-	lastPage := math.Ceil(float64(itemsCount) / float64(perPage))
-	if lastPage == 0 {
-		lastPage = 1
+
+	// Qualify the keyset columns since most querysets join related tables
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(items); err != nil {
+		log.Println("Error parsing paginated model: ", err)
 	}
-	if currentPage > int(lastPage) {
-		errData := utils.RequestErr(utils.ERR_INVALID_PAGE, "Page number is out of range")
-		return nil, nil, &errData
+	table := stmt.Schema.Table
+	var keyColumn interface{} = clause.Column{Table: table, Name: "created_at"}
+	if rank != nil {
+		// Compare ranks as floats so they round-trip exactly through the cursor
+		keyColumn = clause.Expr{SQL: "CAST((?) AS double precision)", Vars: []interface{}{*rank}}
+	}
+	idColumn := clause.Column{Table: table, Name: "id"}
+	query = query.Session(&gorm.Session{})
+
+	paginatorData := schemas.PaginatedResponseDataSchema{PerPage: uint(perPage)}
+	itemsValue := reflect.ValueOf(items).Elem()
+
+	// Builds the cursors pointing at the first and last rows of the page
+	setCursors := func(prev bool, next bool) {
+		itemsCount := itemsValue.Len()
+		if itemsCount == 0 || (!prev && !next) {
+			return
+		}
+		first, last := itemsValue.Index(0), itemsValue.Index(itemsCount-1)
+		var firstRank, lastRank *float64
+		if rank != nil {
+			ranks := []struct {
+				ID   uuid.UUID
+				Rank float64
+			}{}
+			query.Session(&gorm.Session{NewDB: true}).Table(table).
+				Select("? AS id, (?) AS rank", idColumn, keyColumn).
+				Where("? IN ?", idColumn, []uuid.UUID{first.FieldByName("ID").Interface().(uuid.UUID), last.FieldByName("ID").Interface().(uuid.UUID)}).
+				Scan(&ranks)
+			for i := range ranks {
+				rank := ranks[i].Rank
+				if uuid.Equal(ranks[i].ID, first.FieldByName("ID").Interface().(uuid.UUID)) {
+					firstRank = &rank
+				}
+				if uuid.Equal(ranks[i].ID, last.FieldByName("ID").Interface().(uuid.UUID)) {
+					lastRank = &rank
+				}
+			}
+		}
+		if prev {
+			paginatorData.PrevCursor = encodeCursor(first, firstRank, true)
+		}
+		if next {
+			paginatorData.NextCursor = encodeCursor(last, lastRank, false)
+		}
 	}
 
-	startIndex := (currentPage - 1) * perPage
-	endIndex := startIndex + perPage
+	if token := fiberCtx.Query("cursor"); token != "" {
+		cursor, errData := decodeCursor(token, rank != nil)
+		if errData != nil {
+			return nil, errData
+		}
+		condition, direction := "((?), ?) < (?, ?)", "DESC"
+		if cursor.Prev {
+			// Walk backwards from the cursor and flip the rows afterwards
+			condition, direction = "((?), ?) > (?, ?)", "ASC"
+		}
+		// Fetch one extra row to know whether there's more after this page
+		query.Where(condition, keyColumn, idColumn, cursor.keyValue(), cursor.ID).
+			Clauses(orderBy(keyColumn, idColumn, direction)).Limit(perPage + 1).Find(items)
 
-	// Ensure startIndex is within bounds
-	if startIndex < 0 {
-		startIndex = 0
+		hasMore := itemsValue.Len() > perPage
+		if hasMore {
+			itemsValue.Set(itemsValue.Slice(0, perPage))
+		}
+		if cursor.Prev {
+			reverseItems(itemsValue)
+		}
+		// There's always something on the side the cursor came from
+		setCursors(!cursor.Prev || hasMore, cursor.Prev || hasMore)
+		return &paginatorData, nil
 	}
 
-	// Ensure endIndex is within bounds
-	if endIndex > itemsCount {
-		endIndex = itemsCount
+	currentPage := fiberCtx.QueryInt("page", 1)
+	if currentPage < 1 {
+		errData := utils.RequestErr(utils.ERR_INVALID_PAGE, "Invalid Page")
+		return nil, &errData
 	}
 
-	paginatorData := schemas.PaginatedResponseDataSchema{
-		PerPage:     uint(perPage),
-		CurrentPage: uint(currentPage),
-		LastPage:    uint(lastPage),
+	var itemsCount int64
+	query.Model(items).Count(&itemsCount)
+	lastPage := math.Ceil(float64(itemsCount) / float64(perPage))
+	if lastPage == 0 {
+		lastPage = 1
 	}
-	paginatedItems := querysetValue.Slice(startIndex, endIndex).Interface()
-	return &paginatorData, paginatedItems, nil
+	if currentPage > int(lastPage) {
+		errData := utils.RequestErr(utils.ERR_INVALID_PAGE, "Page number is out of range")
+		return nil, &errData
+	}
+
+	offset := (currentPage - 1) * perPage
+	query.Clauses(orderBy(keyColumn, idColumn, "DESC")).Limit(perPage).Offset(offset).Find(items)
+
+	paginatorData.CurrentPage = uint(currentPage)
+	paginatorData.LastPage = uint(lastPage)
+	setCursors(currentPage > 1, currentPage < int(lastPage))
+	return &paginatorData, nil
 }
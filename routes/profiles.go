@@ -45,6 +45,7 @@ func (endpoint Endpoint) RetrieveCities(c *fiber.Ctx) error {
 // @Description This endpoint retrieves a paginated list of users
 // @Tags Profiles
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.ProfilesResponseSchema
 // @Router /profiles [get]
 // @Security BearerAuth
@@ -52,18 +53,18 @@ func (endpoint Endpoint) RetrieveUsers(c *fiber.Ctx) error {
 	db := endpoint.DB
 	user := RequestUser(c)
 
-	users := []models.User{}
-	query := db.Preload(clause.Associations)
+	query := db.Model(&models.User{}).Preload(clause.Associations).Scopes(managers.ActiveUsersScope)
 	if user != nil {
-		query.Not(models.User{BaseModel: models.BaseModel{ID: user.ID}})
+		query = query.Not(models.User{BaseModel: models.BaseModel{ID: user.ID}}).
+			Not("users.id IN (?)", blockManager.GetBlockedIDs(db, *user))
 	}
-	query.Find(&users)
+
 	// Paginate, Convert type and return Users
-	paginatedData, paginatedUsers, err := PaginateQueryset(users, c)
+	users := []models.User{}
+	paginatedData, err := PaginateQueryset(query, c, &users)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	users = paginatedUsers.([]models.User)
 
 	response := schemas.ProfilesResponseSchema{
 		ResponseSchema: SuccessResponse("Users fetched"),
@@ -77,17 +78,20 @@ func (endpoint Endpoint) RetrieveUsers(c *fiber.Ctx) error {
 
 // @Summary Retrieve User Profile
 // @Description This endpoint retrieves a user profile
+// @Description `Authentication is optional. Profiles of users a block stands between you and aren't found`
 // @Tags Profiles
 // @Param username path string true "Username of user"
 // @Success 200 {object} schemas.ProfileResponseSchema
 // @Router /profiles/profile/{username} [get]
+// @Security BearerAuth
 func (endpoint Endpoint) RetrieveUserProfile(c *fiber.Ctx) error {
 	db := endpoint.DB
 	username := c.Params("username")
+	requestUser := RequestUser(c)
 
 	user := models.User{}
 	db.Preload("CityObj").Preload("AvatarObj").Take(&user, models.User{Username: username})
-	if user.ID == nil {
+	if user.ID == nil || (requestUser != nil && blockManager.Check(db, *requestUser, user) != nil) {
 		return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "No user with that username"))
 	}
 
@@ -133,7 +137,7 @@ func (endpoint Endpoint) UpdateProfile(c *fiber.Ctx) error {
 	// Create OR Update File
 	fileType := data.FileType
 	if fileType != nil {
-		file := models.File{ResourceType: *fileType}.UpdateOrCreate(db, user.AvatarId)
+		file := models.NewFile("avatars", *fileType, user.ID).UpdateOrCreate(db, user.AvatarId, "avatars")
 		user.AvatarObj = &file
 	}
 	// Set values & save
@@ -152,7 +156,8 @@ func (endpoint Endpoint) UpdateProfile(c *fiber.Ctx) error {
 }
 
 // @Summary Delete User's Account
-// @Description This endpoint deletes a particular user's account (irreversible)
+// @Description This endpoint deletes a particular user's account
+// @Description `The account is deactivated and logged out everywhere right away, but only deleted for good after a grace period (30 days by default). Logging in before then restores it`
 // @Tags Profiles
 // @Param password body schemas.DeleteUserSchema true "Password"
 // @Success 200 {object} schemas.ResponseSchema
@@ -177,8 +182,8 @@ func (endpoint Endpoint) DeleteUser(c *fiber.Ctx) error {
 		return c.Status(422).JSON(utils.RequestErr(utils.ERR_INVALID_ENTRY, "Invalid Entry", data))
 	}
 
-	// Delete User
-	db.Delete(&user)
+	// Deactivate User. It's purged once the grace period is over
+	accountManager.Deactivate(db, user)
 	return c.Status(200).JSON(SuccessResponse("User deleted"))
 }
 
@@ -188,19 +193,19 @@ var friendManager = managers.FriendManager{}
 // @Description This endpoint retrieves friends of a user
 // @Tags Profiles
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.ProfilesResponseSchema
 // @Router /profiles/friends [get]
 // @Security BearerAuth
 func (endpoint Endpoint) RetrieveFriends(c *fiber.Ctx) error {
 	db := endpoint.DB
 	user := RequestUser(c)
-	friends := friendManager.GetFriends(db, *user)
 	// Paginate and return Friends
-	paginatedData, paginatedFriends, err := PaginateQueryset(friends, c, 20)
+	friends := []models.User{}
+	paginatedData, err := PaginateQueryset(friendManager.GetFriendsQueryset(db, *user), c, &friends, 20)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	friends = paginatedFriends.([]models.User)
 	response := schemas.ProfilesResponseSchema{
 		ResponseSchema: SuccessResponse("Friends fetched"),
 		Data: schemas.ProfilesResponseDataSchema{
@@ -215,6 +220,7 @@ func (endpoint Endpoint) RetrieveFriends(c *fiber.Ctx) error {
 // @Description This endpoint retrieves friend requests of a user
 // @Tags Profiles
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.ProfilesResponseSchema
 // @Router /profiles/friends/requests [get]
 // @Security BearerAuth
@@ -222,14 +228,12 @@ func (endpoint Endpoint) RetrieveFriendRequests(c *fiber.Ctx) error {
 	db := endpoint.DB
 	user := RequestUser(c)
 
-	friendsRequests := friendManager.GetFriendRequests(db, user)
-
 	// Paginate, Convert type and return Friends Requests
-	paginatedData, paginatedFriendRequests, err := PaginateQueryset(friendsRequests, c, 20)
+	friendsRequests := []models.User{}
+	paginatedData, err := PaginateQueryset(friendManager.GetFriendRequests(db, user), c, &friendsRequests, 20)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	friendsRequests = paginatedFriendRequests.([]models.User)
 	response := schemas.ProfilesResponseSchema{
 		ResponseSchema: SuccessResponse("Friend Requests fetched"),
 		Data: schemas.ProfilesResponseDataSchema{
@@ -262,6 +266,9 @@ func (endpoint Endpoint) SendOrDeleteFriendRequest(c *fiber.Ctx) error {
 	if errData != nil {
 		return c.Status(404).JSON(errData)
 	}
+	if errData := blockManager.Check(db, *user, *requestee); errData != nil {
+		return c.Status(403).JSON(errData)
+	}
 	message := "Friend Request sent"
 	statusCode := 201
 	if friend.ID != nil {
@@ -327,12 +334,118 @@ func (endpoint Endpoint) AcceptOrRejectFriendRequest(c *fiber.Ctx) error {
 	return c.Status(200).JSON(SuccessResponse(fmt.Sprintf("Friend Request %s", message)))
 }
 
+var blockManager = managers.BlockManager{}
+
+// @Summary Retrieve Blocked Users
+// @Description This endpoint retrieves the users the auth user blocked, or muted
+// @Description `Blocked users and you can't see or interact with each other. Muted users' posts and notifications are only kept from you`
+// @Tags Profiles
+// @Param muted query bool false "List muted users instead" default(false)
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.ProfilesResponseSchema
+// @Router /profiles/blocks [get]
+// @Security BearerAuth
+func (endpoint Endpoint) RetrieveBlockedUsers(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	muted := c.QueryBool("muted")
+
+	// Paginate and return blocked or muted users
+	users := []models.User{}
+	paginatedData, err := PaginateQueryset(blockManager.GetQueryset(db, *user, muted), c, &users, 20)
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	message := "Blocked users fetched"
+	if muted {
+		message = "Muted users fetched"
+	}
+	response := schemas.ProfilesResponseSchema{
+		ResponseSchema: SuccessResponse(message),
+		Data: schemas.ProfilesResponseDataSchema{
+			PaginatedResponseDataSchema: *paginatedData,
+			Items:                       users,
+		}.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
+
+// @Summary Block Or Mute a User
+// @Description This endpoint blocks a user, or mutes them when mute is true
+// @Description `Blocking a user ends any friendship or friend request between you`
+// @Tags Profiles
+// @Param block body schemas.BlockUserSchema true "Block object"
+// @Success 201 {object} schemas.ResponseSchema
+// @Router /profiles/blocks [post]
+// @Security BearerAuth
+func (endpoint Endpoint) BlockUser(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+
+	data := schemas.BlockUserSchema{}
+
+	// Validate request
+	if errCode, errData := ValidateRequest(c, &data); errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+	target, errCode, errData := blockManager.GetTarget(db, *user, data.Username)
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	// Block or mute
+	if data.Mute {
+		if !blockManager.Mute(db, *user, *target) {
+			return c.Status(200).JSON(SuccessResponse("User already muted"))
+		}
+		return c.Status(201).JSON(SuccessResponse("User muted"))
+	}
+	if !blockManager.Block(db, *user, *target) {
+		return c.Status(200).JSON(SuccessResponse("User already blocked"))
+	}
+	return c.Status(201).JSON(SuccessResponse("User blocked"))
+}
+
+// @Summary Unblock Or Unmute a User
+// @Description This endpoint unblocks a user, or unmutes them when muted is true
+// @Tags Profiles
+// @Param username path string true "Username of user"
+// @Param muted query bool false "Unmute the user instead" default(false)
+// @Success 200 {object} schemas.ResponseSchema
+// @Router /profiles/blocks/{username} [delete]
+// @Security BearerAuth
+func (endpoint Endpoint) UnblockUser(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	muted := c.QueryBool("muted")
+
+	target, errCode, errData := blockManager.GetTarget(db, *user, c.Params("username"))
+	if errData != nil {
+		return c.Status(*errCode).JSON(errData)
+	}
+
+	// Unblock or unmute
+	if muted {
+		if !blockManager.Undo(db, *user, *target, true) {
+			return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "You haven't muted this user"))
+		}
+		return c.Status(200).JSON(SuccessResponse("User unmuted"))
+	}
+	if !blockManager.Undo(db, *user, *target, false) {
+		return c.Status(404).JSON(utils.RequestErr(utils.ERR_NON_EXISTENT, "You haven't blocked this user"))
+	}
+	return c.Status(200).JSON(SuccessResponse("User unblocked"))
+}
+
 var notificationManager = managers.NotificationManager{}
 
 // @Summary Retrieve User Notifications
 // @Description This endpoint retrieves a paginated list of auth user's notifications. Use post, comment, reply slug to navigate to the post, comment or reply.
+// @Description `For mentions in messages, chat_id is set instead`
 // @Tags Profiles
 // @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
 // @Success 200 {object} schemas.NotificationsResponseSchema
 // @Router /profiles/notifications [get]
 // @Security BearerAuth
@@ -340,14 +453,12 @@ func (endpoint Endpoint) RetrieveUserNotifications(c *fiber.Ctx) error {
 	db := endpoint.DB
 	user := RequestUser(c)
 
-	notifications := notificationManager.GetQueryset(db, user.ID)
-
 	// Paginate, Convert type and return notifications
-	paginatedData, paginatedNotifications, err := PaginateQueryset(notifications, c)
+	notifications := []models.Notification{}
+	paginatedData, err := PaginateQueryset(notificationManager.GetQueryset(db, user.ID), c, &notifications)
 	if err != nil {
 		return c.Status(400).JSON(err)
 	}
-	notifications = paginatedNotifications.([]models.Notification)
 	response := schemas.NotificationsResponseSchema{
 		ResponseSchema: SuccessResponse("Notifications fetched"),
 		Data: schemas.NotificationsResponseDataSchema{
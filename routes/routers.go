@@ -1,17 +1,25 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/events"
+	"github.com/kayprogrammer/socialnet-v6/ratelimit"
 	"gorm.io/gorm"
 )
 
 type Endpoint struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Broker      events.Broker // Carries realtime events from handlers to the sockets
+	Hub         *SocketHub
+	RateLimiter ratelimit.Store
 }
 
 func SetupRoutes(app *fiber.App, db *gorm.DB) {
-	endpoint := Endpoint{DB: db}
+	broker := events.NewBroker(cfg, db)
+	endpoint := Endpoint{DB: db, Broker: broker, Hub: NewSocketHub(broker), RateLimiter: ratelimit.NewStore(cfg, db)}
 
 	api := app.Group("/api/v6")
 
@@ -22,50 +30,72 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	generalRouter := api.Group("/general")
 	generalRouter.Get("/site-detail", endpoint.GetSiteDetails)
 
-	// Auth Routes (8)
+	// Auth Routes (14)
 	authRouter := api.Group("/auth")
 	authRouter.Post("/register", endpoint.Register)
-	authRouter.Post("/verify-email", endpoint.VerifyEmail)
-	authRouter.Post("/resend-verification-email", endpoint.ResendVerificationEmail)
-	authRouter.Post("/send-password-reset-otp", endpoint.SendPasswordResetOtp)
-	authRouter.Post("/set-new-password", endpoint.SetNewPassword)
-	authRouter.Post("/login", endpoint.Login)
+	authRouter.Post("/verify-email", endpoint.RateLimitMiddleware("verify-email", 20, 10, 15*time.Minute), endpoint.VerifyEmail)
+	authRouter.Post("/resend-verification-email", endpoint.RateLimitMiddleware("resend-verification-email", 10, 3, 15*time.Minute), endpoint.ResendVerificationEmail)
+	authRouter.Post("/send-password-reset-otp", endpoint.RateLimitMiddleware("send-password-reset-otp", 10, 3, 15*time.Minute), endpoint.SendPasswordResetOtp)
+	authRouter.Post("/set-new-password", endpoint.RateLimitMiddleware("set-new-password", 20, 10, 15*time.Minute), endpoint.SetNewPassword)
+	authRouter.Post("/login", endpoint.RateLimitMiddleware("login", 50, 20, 15*time.Minute), endpoint.Login)
+	authRouter.Post("/login/2fa", endpoint.RateLimitMiddleware("login-2fa", 50, 20, 15*time.Minute), endpoint.LoginTwoFactor)
 	authRouter.Post("/refresh", endpoint.Refresh)
 	authRouter.Get("/logout", endpoint.AuthMiddleware, endpoint.Logout)
+	authRouter.Get("/sessions", endpoint.AuthMiddleware, endpoint.RetrieveSessions)
+	authRouter.Delete("/sessions/:id", endpoint.AuthMiddleware, endpoint.RevokeSession)
+	authRouter.Post("/2fa/setup", endpoint.AuthMiddleware, endpoint.SetupTwoFactor)
+	authRouter.Post("/2fa/activate", endpoint.AuthMiddleware, endpoint.RateLimitMiddleware("2fa-activate", 50, 20, 15*time.Minute), endpoint.ActivateTwoFactor)
+	authRouter.Post("/2fa/disable", endpoint.AuthMiddleware, endpoint.RateLimitMiddleware("2fa-disable", 50, 20, 15*time.Minute), endpoint.DisableTwoFactor)
 
-	// Profile Routes (12)
+	// Profile Routes (15)
 	profilesRouter := api.Group("/profiles")
 	profilesRouter.Get("/cities", endpoint.RetrieveCities)
 	profilesRouter.Get("", endpoint.GuestMiddleware, endpoint.RetrieveUsers)
-	profilesRouter.Get("/profile/:username", endpoint.RetrieveUserProfile)
+	profilesRouter.Get("/profile/:username", endpoint.GuestMiddleware, endpoint.RetrieveUserProfile)
 	profilesRouter.Patch("/profile", endpoint.AuthMiddleware, endpoint.UpdateProfile)
 	profilesRouter.Post("/profile", endpoint.AuthMiddleware, endpoint.DeleteUser)
 	profilesRouter.Get("/friends", endpoint.AuthMiddleware, endpoint.RetrieveFriends)
 	profilesRouter.Get("/friends/requests", endpoint.AuthMiddleware, endpoint.RetrieveFriendRequests)
 	profilesRouter.Post("/friends/requests", endpoint.AuthMiddleware, endpoint.SendOrDeleteFriendRequest)
 	profilesRouter.Put("/friends/requests", endpoint.AuthMiddleware, endpoint.AcceptOrRejectFriendRequest)
+	profilesRouter.Get("/blocks", endpoint.AuthMiddleware, endpoint.RetrieveBlockedUsers)
+	profilesRouter.Post("/blocks", endpoint.AuthMiddleware, endpoint.BlockUser)
+	profilesRouter.Delete("/blocks/:username", endpoint.AuthMiddleware, endpoint.UnblockUser)
 	profilesRouter.Get("/notifications", endpoint.AuthMiddleware, endpoint.RetrieveUserNotifications)
 	profilesRouter.Post("/notifications", endpoint.AuthMiddleware, endpoint.ReadNotification)
 
-	// Feed Routes (18)
+	// Feed Routes (28)
 	feedRouter := api.Group("/feed")
-	feedRouter.Get("/posts", endpoint.RetrievePosts)
+	feedRouter.Get("/timeline", endpoint.AuthMiddleware, endpoint.RetrieveTimeline)
+	feedRouter.Get("/posts", endpoint.GuestMiddleware, endpoint.RetrievePosts)
 	feedRouter.Post("/posts", endpoint.AuthMiddleware, endpoint.CreatePost)
-	feedRouter.Get("/posts/:slug", endpoint.RetrievePost)
+	feedRouter.Get("/posts/:slug", endpoint.GuestMiddleware, endpoint.RetrievePost)
 	feedRouter.Put("/posts/:slug", endpoint.AuthMiddleware, endpoint.UpdatePost)
 	feedRouter.Delete("/posts/:slug", endpoint.AuthMiddleware, endpoint.DeletePost)
-	feedRouter.Get("/reactions/:focus/:slug", endpoint.RetrieveReactions)
+	feedRouter.Post("/posts/:slug/repost", endpoint.AuthMiddleware, endpoint.RepostPost)
+	feedRouter.Get("/reactions/:focus/:slug", endpoint.GuestMiddleware, endpoint.RetrieveReactions)
 	feedRouter.Post("/reactions/:focus/:slug", endpoint.AuthMiddleware, endpoint.CreateReaction)
 	feedRouter.Delete("/reactions/:id", endpoint.AuthMiddleware, endpoint.DeleteReaction)
-	feedRouter.Get("/posts/:slug/comments", endpoint.RetrieveComments)
+	feedRouter.Get("/posts/:slug/comments", endpoint.GuestMiddleware, endpoint.RetrieveComments)
 	feedRouter.Post("/posts/:slug/comments", endpoint.AuthMiddleware, endpoint.CreateComment)
-	feedRouter.Get("/comments/:slug", endpoint.RetrieveCommentWithReplies)
+	feedRouter.Get("/comments/:slug", endpoint.GuestMiddleware, endpoint.RetrieveCommentWithReplies)
 	feedRouter.Post("/comments/:slug", endpoint.AuthMiddleware, endpoint.CreateReply)
 	feedRouter.Put("/comments/:slug", endpoint.AuthMiddleware, endpoint.UpdateComment)
 	feedRouter.Delete("/comments/:slug", endpoint.AuthMiddleware, endpoint.DeleteComment)
-	feedRouter.Get("/replies/:slug", endpoint.RetrieveReply)
+	feedRouter.Get("/replies/:slug", endpoint.GuestMiddleware, endpoint.RetrieveReply)
 	feedRouter.Put("/replies/:slug", endpoint.AuthMiddleware, endpoint.UpdateReply)
 	feedRouter.Delete("/replies/:slug", endpoint.AuthMiddleware, endpoint.DeleteReply)
+	feedRouter.Get("/hashtags/trending", endpoint.RetrieveTrendingHashtags)
+	feedRouter.Get("/hashtags/:tag", endpoint.GuestMiddleware, endpoint.RetrieveHashtagPosts)
+	feedRouter.Get("/bookmarks", endpoint.AuthMiddleware, endpoint.RetrieveBookmarks)
+	feedRouter.Post("/posts/:slug/bookmark", endpoint.AuthMiddleware, endpoint.BookmarkPost)
+	feedRouter.Delete("/posts/:slug/bookmark", endpoint.AuthMiddleware, endpoint.DeleteBookmark)
+	feedRouter.Get("/bookmarks/collections", endpoint.AuthMiddleware, endpoint.RetrieveCollections)
+	feedRouter.Post("/bookmarks/collections", endpoint.AuthMiddleware, endpoint.CreateCollection)
+	feedRouter.Delete("/bookmarks/collections/:id", endpoint.AuthMiddleware, endpoint.DeleteCollection)
+
+	// Search Routes (1)
+	api.Get("/search", endpoint.GuestMiddleware, endpoint.Search)
 
 	// Chat Routes (9)
 	chatRouter := api.Group("/chats", endpoint.AuthMiddleware)
@@ -78,6 +108,28 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	chatRouter.Delete("/messages/:message_id", endpoint.DeleteMessage)
 	chatRouter.Post("/groups/group", endpoint.CreateGroupChat)
 
+	// Moderation Routes (1)
+	api.Post("/reports/:target/:key", endpoint.AuthMiddleware, endpoint.CreateReport)
+
+	// Admin Routes (10). All are for staff, and those that pass SuperuserMiddleware too are for superusers only
+	adminRouter := api.Group("/admin", endpoint.AuthMiddleware, endpoint.StaffMiddleware)
+	adminRouter.Get("/reports", endpoint.RetrieveReports)
+	adminRouter.Get("/reports/:id", endpoint.RetrieveReport)
+	adminRouter.Post("/reports/:id/triage", endpoint.TriageReport)
+	adminRouter.Post("/reports/:id/resolve", endpoint.ResolveReport)
+	adminRouter.Get("/audit-logs", endpoint.RetrieveAuditLogs)
+	adminRouter.Post("/notifications", endpoint.SendAdminNotification)
+	adminRouter.Patch("/site-detail", endpoint.SuperuserMiddleware, endpoint.UpdateSiteDetail)
+	adminRouter.Get("/users", endpoint.SuperuserMiddleware, endpoint.RetrieveAdminUsers)
+	adminRouter.Patch("/users/:username", endpoint.SuperuserMiddleware, endpoint.UpdateAdminUser)
+	adminRouter.Post("/users/:username/logout", endpoint.SuperuserMiddleware, endpoint.LogoutAdminUser)
+
+	// Media Routes (3). The wildcard ones stand in for the object store when files are kept locally
+	mediaRouter := api.Group("/media")
+	mediaRouter.Post("/files/:id/complete", endpoint.AuthMiddleware, endpoint.CompleteUpload)
+	mediaRouter.Put("/*", endpoint.UploadMedia)
+	mediaRouter.Get("/*", endpoint.RetrieveMedia)
+
 	// Register Sockets
 	api.Get("/ws/notifications", websocket.New(endpoint.NotificationSocket))
 	api.Get("/ws/chats/:id", websocket.New(endpoint.ChatSocket))
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/managers"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+	"gorm.io/gorm"
+)
+
+var searchManager = managers.SearchManager{}
+
+// Paginates the search results in items by relevance and highlights them
+func paginateSearch(c *fiber.Ctx, db *gorm.DB, query *gorm.DB, table string, q string, items interface{}) (*schemas.PaginatedResponseDataSchema, *utils.ErrorResponse) {
+	paginatedData, err := PaginateRankedQueryset(query, c, items, searchManager.Rank(table, q))
+	if err != nil {
+		return nil, err
+	}
+	itemsValue := reflect.ValueOf(items).Elem()
+	ids := []uuid.UUID{}
+	for i := 0; i < itemsValue.Len(); i++ {
+		ids = append(ids, itemsValue.Index(i).FieldByName("ID").Interface().(uuid.UUID))
+	}
+	highlights := searchManager.Highlights(db, table, q, ids)
+	for i := 0; i < itemsValue.Len(); i++ {
+		if highlight, ok := highlights[ids[i].String()]; ok {
+			itemsValue.Index(i).FieldByName("Highlight").Set(reflect.ValueOf(&highlight))
+		}
+	}
+	return paginatedData, nil
+}
+
+// @Summary Search
+// @Description This endpoint searches posts, comments, users or the messages of the user's chats.
+// @Description Results are ordered by relevance and come with a highlight of the matching text, where matched terms are wrapped in <b></b>.
+// @Tags Search
+// @Param q query string true "Search terms. Supports quoted phrases, 'or' and '-' exclusions"
+// @Param type query string false "What to search" Enums(posts, comments, users, messages) default(posts)
+// @Param page query int false "Current Page" default(1)
+// @Param cursor query string false "Cursor (next_cursor or prev_cursor) from a previous page. Takes precedence over page"
+// @Success 200 {object} schemas.SearchResponseSchema
+// @Router /search [get]
+// @Security BearerAuth
+func (endpoint Endpoint) Search(c *fiber.Ctx) error {
+	db := endpoint.DB
+	user := RequestUser(c)
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INVALID_VALUE, "Search query is required"))
+	}
+
+	var (
+		paginatedData *schemas.PaginatedResponseDataSchema
+		err           *utils.ErrorResponse
+		data          = schemas.SearchResponseDataSchema{}
+	)
+	switch c.Query("type", "posts") {
+	case "posts":
+		posts := []models.Post{}
+		paginatedData, err = paginateSearch(c, db, searchManager.Posts(db, q, user), "posts", q, &posts)
+		data.Posts = &posts
+	case "comments":
+		comments := []models.Comment{}
+		paginatedData, err = paginateSearch(c, db, searchManager.Comments(db, q, user), "comments", q, &comments)
+		data.Comments = &comments
+	case "users":
+		users := []models.User{}
+		paginatedData, err = paginateSearch(c, db, searchManager.Users(db, q, user), "users", q, &users)
+		data.Users = &users
+	case "messages":
+		if user == nil {
+			return c.Status(401).JSON(utils.RequestErr(utils.ERR_UNAUTHORIZED_USER, "Login to search your messages"))
+		}
+		messages := []models.Message{}
+		paginatedData, err = paginateSearch(c, db, searchManager.Messages(db, *user, q), "messages", q, &messages)
+		data.Messages = &messages
+	default:
+		return c.Status(400).JSON(utils.RequestErr(utils.ERR_INVALID_VALUE, "Invalid 'type' value"))
+	}
+	if err != nil {
+		return c.Status(400).JSON(err)
+	}
+	data.PaginatedResponseDataSchema = *paginatedData
+	response := schemas.SearchResponseSchema{
+		ResponseSchema: SuccessResponse("Search results fetched"),
+		Data:           data.Init(),
+	}
+	return c.Status(200).JSON(response)
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/kayprogrammer/socialnet-v6/database"
@@ -14,8 +15,8 @@ import (
 
 // Entry & Exit Schemas
 type SocketMessageEntrySchema struct {
-	Status string    `json:"status" validate:"required,oneof=CREATED UPDATED DELETED"`
-	ID     uuid.UUID `json:"id" validate:"required"`
+	Status string    `json:"status" validate:"required,oneof=CREATED UPDATED DELETED TYPING_START TYPING_STOP DELIVERED READ"`
+	ID     uuid.UUID `json:"id,omitempty"` // Not needed for typing events
 }
 
 type SocketMessageExitSchema struct {
@@ -23,11 +24,16 @@ type SocketMessageExitSchema struct {
 	Status string `json:"status"`
 }
 
-// ---------------------------
+// Typing, receipt and presence events
+type SocketChatEventSchema struct {
+	Status     string                `json:"status"`
+	ID         uuid.UUID             `json:"id,omitempty"` // Latest message covered by a receipt
+	ChatID     uuid.UUID             `json:"chat_id"`
+	User       models.UserDataSchema `json:"user"`
+	LastSeenAt *time.Time            `json:"last_seen_at,omitempty"` // Set on presence events
+}
 
-var (
-	messageData = SocketMessageEntrySchema{}
-)
+// ---------------------------
 
 // Retrieve chat or user based on the given id
 func GetChatOrUser(c *websocket.Conn, db *gorm.DB, user models.User, id string) (models.Chat, *models.User) {
@@ -45,6 +51,7 @@ func GetChatOrUser(c *websocket.Conn, db *gorm.DB, user models.User, id string)
 		objUser = &user // Message is sent to self
 	}
 	c.Locals("objUser", objUser)
+	c.Locals("chat", chat)
 	return chat, objUser
 }
 
@@ -54,7 +61,7 @@ func GetChatOrUser(c *websocket.Conn, db *gorm.DB, user models.User, id string)
 func ValidateChatMembership(c *websocket.Conn, db *gorm.DB, user models.User, id string) (*int, *string, *string) {
 	chat, objUser := GetChatOrUser(c, db, user, id)
 
-	if chat.ID == nil && objUser.ID == nil {
+	if chat.ID == nil && (objUser == nil || objUser.ID == nil) {
 		// If no chat nor user
 		errCode := 4004
 		errType := "invalid_input"
@@ -72,30 +79,10 @@ func ValidateChatMembership(c *websocket.Conn, db *gorm.DB, user models.User, id
 
 // ----------------------------------------------------
 
-// Store new connection client
-func AddChatClient(c *websocket.Conn, db *gorm.DB, id string) (*int, *string, *string) {
-	// Validate chat ID & membership
-	user := c.Locals("user").(*models.User)
-	secret := c.Locals("secret").(*string)
-
-	if secret == nil {
-		// validate chat memership
-		errCode, errType, errMsg := ValidateChatMembership(c, db, *user, id)
-		if errCode != nil && errType != nil && errMsg != nil {
-			return errCode, errType, errMsg
-		}
-	}
-
-	// Add client
-	AddClient(c)
-	return nil, nil, nil
-}
-
-// ------------------------------------------
-
 // Validate data entering the socket.
-func ValidateEnteredData(c *websocket.Conn, db *gorm.DB, user *models.User, secret *string, data []byte) (*[]byte, *int, *string, *string, *map[string]string) {
+func ValidateEnteredData(c *websocket.Conn, db *gorm.DB, user *models.User, data []byte) (*[]byte, *int, *string, *string, *map[string]string) {
 	// Ensure data is a Message data. That means it aligns with the Message schema above
+	messageData := SocketMessageEntrySchema{}
 	err := json.Unmarshal(data, &messageData)
 	if err != nil {
 		errCode := 4220
@@ -109,66 +96,83 @@ func ValidateEnteredData(c *websocket.Conn, db *gorm.DB, user *models.User, secr
 		errData := err.Data
 		return nil, &errCode, &errType, &errMsg, errData
 	}
-	status := messageData.Status
-	if status == "DELETED" && secret == nil {
-		// Only allowed for secret users (in app)
+	if messageData.Status == "DELETED" {
+		// Only published by the app itself
 		errCode := 4001
 		errType := utils.ERR_UNAUTHORIZED_USER
 		errMsg := "Not allowed to send deletion socket message"
 		return nil, &errCode, &errType, &errMsg, nil
 	}
-	messageDataToReturn := data
-	if status != "DELETED" {
+	switch messageData.Status {
+	case "TYPING_START", "TYPING_STOP", "DELIVERED", "READ":
+		return ValidateChatEventData(c, db, user, messageData)
+	}
+	if messageData.ID == nil {
+		errCode := 4220
+		errType := utils.ERR_INVALID_ENTRY
+		errMsg := "Invalid Message data"
+		return nil, &errCode, &errType, &errMsg, &map[string]string{"id": "This field is required."}
+	}
+	message := messageManager.GetByID(db, messageData.ID)
+	if message.ID == nil {
+		errCode := 4004
+		errType := utils.ERR_NON_EXISTENT
+		errMsg := "Invalid message ID"
+		return nil, &errCode, &errType, &errMsg, nil
+	} else if message.SenderID.String() != user.ID.String() {
+		errCode := 4001
+		errType := utils.ERR_INVALID_OWNER
+		errMsg := "Message isn't yours"
+		return nil, &errCode, &errType, &errMsg, nil
+	}
+	messageExitData := SocketMessageExitSchema{
+		Message: message.Init(),
+		Status:  messageData.Status,
+	}
+	messageDataToReturn, _ := json.Marshal(messageExitData)
+	return &messageDataToReturn, nil, nil, nil, nil
+}
+
+// Validate typing and receipt events, storing the receipts.
+func ValidateChatEventData(c *websocket.Conn, db *gorm.DB, user *models.User, messageData SocketMessageEntrySchema) (*[]byte, *int, *string, *string, *map[string]string) {
+	chat := c.Locals("chat").(models.Chat)
+	if chat.ID == nil {
+		// Connected with a user ID, so there's no chat to type or read in yet
+		errCode := 4004
+		errType := utils.ERR_NON_EXISTENT
+		errMsg := "Typing and receipts need a chat ID"
+		return nil, &errCode, &errType, &errMsg, nil
+	}
+	eventData := SocketChatEventSchema{
+		Status: messageData.Status,
+		ChatID: chat.ID,
+		User:   models.UserDataSchema{}.Init(*user),
+	}
+
+	if messageData.Status == "DELIVERED" || messageData.Status == "READ" {
+		if messageData.ID == nil {
+			errCode := 4220
+			errType := utils.ERR_INVALID_ENTRY
+			errMsg := "Invalid Message data"
+			return nil, &errCode, &errType, &errMsg, &map[string]string{"id": "This field is required."}
+		}
 		message := messageManager.GetByID(db, messageData.ID)
-		if message.ID == nil {
+		if message.ID == nil || !uuid.Equal(message.ChatID, chat.ID) {
 			errCode := 4004
 			errType := utils.ERR_NON_EXISTENT
 			errMsg := "Invalid message ID"
 			return nil, &errCode, &errType, &errMsg, nil
-		} else if message.SenderID.String() != user.ID.String() {
+		} else if uuid.Equal(message.SenderID, user.ID) {
 			errCode := 4001
 			errType := utils.ERR_INVALID_OWNER
-			errMsg := "Message isn't yours"
+			errMsg := "Can't send a receipt for your own message"
 			return nil, &errCode, &errType, &errMsg, nil
 		}
-		messageData := SocketMessageExitSchema{
-			Message: message.Init(),
-			Status:  messageData.Status,
-		}
-		messageDataJson, _ := json.Marshal(messageData)
-		messageDataToReturn = []byte(messageDataJson)
-	}
-	return &messageDataToReturn, nil, nil, nil, nil
-}
-
-// --------------------------------------------
-
-// Broadcast chat messages to connected clients
-func broadcastChatMessage(c *websocket.Conn, mt int, groupName string, data []byte) {
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
-
-	for client := range clients {
-		secret := client.Locals("secret").(*string)
-
-		// Only true receivers should access the data
-		if client.Locals("groupName") == groupName && secret == nil {
-			user := client.Locals("user").(*models.User)
-			objUser := client.Locals("objUser").(*models.User)
-			if objUser != nil {
-				// Ensure that reading messages from a user id can only be done by the owner
-				if user.ID.String() == objUser.ID.String() {
-					if err := client.WriteMessage(mt, data); err != nil {
-						log.Println("write:", err)
-					}
-				}
-			} else {
-				if err := client.WriteMessage(mt, data); err != nil {
-					log.Println("write:", err)
-				}
-			}
-		}
+		messageReceiptManager.Acknowledge(db, *user, message, messageData.Status == "READ")
+		eventData.ID = message.ID
 	}
+	eventDataToReturn, _ := json.Marshal(eventData)
+	return &eventDataToReturn, nil, nil, nil, nil
 }
 
 // --------------------------------------------
@@ -182,51 +186,58 @@ func (ep Endpoint) ChatSocket(c *websocket.Conn) {
 	chatID := c.Params("id")
 
 	var (
-		mt        int
 		entryData []byte
 		exitData  *[]byte
 		err       error
-		user      *models.User
-		secret    *string
 		errC      *int               // error code
 		errT      *string            // error type
-		errM      *string            // error message
 		errD      *map[string]string // error data
 	)
 
 	// Validate Auth
-	if user, secret, errM = ValidateAuth(db, token); errM != nil {
+	user, errM := ValidateAuth(db, token)
+	if errM != nil {
 		ReturnError(c, utils.ERR_INVALID_TOKEN, *errM, 4001)
 		return
 	}
-	c.Locals("user", user)
-	c.Locals("secret", secret)
-	// Set Group name
-	groupName := "chat_" + chatID
-	c.Locals("groupName", groupName)
 
-	// Add the client to the list of connected clients
-	errC, errT, errM = AddChatClient(c, db, chatID)
-	if errC != nil || errT != nil || errM != nil {
+	// Validate chat ID & membership
+	errC, errT, errM = ValidateChatMembership(c, db, *user, chatID)
+	if errC != nil {
 		ReturnError(c, *errT, *errM, *errC)
 		return
 	}
-	// Remove the client from the list when the handler exits
-	defer RemoveClient(c)
+	topic := chatTopic(chatID)
+	client := NewSocketClient(c)
+	defer client.Close()
+	ep.UpdatePresence(db, user, true)
+	defer ep.UpdatePresence(db, user, false)
+
+	// Only true receivers should access the data.
+	// Reading messages from a user id can only be done by the owner
+	objUser := c.Locals("objUser").(*models.User)
+	if objUser == nil || user.ID.String() == objUser.ID.String() {
+		ep.Hub.Join(topic, client)
+		defer ep.Hub.Leave(topic, client)
+	}
 
 	for {
-		if mt, entryData, err = c.ReadMessage(); err != nil {
+		if _, entryData, err = c.ReadMessage(); err != nil {
+			client.Close()
 			ReturnError(c, utils.ERR_INVALID_ENTRY, "Invalid Entry", 4220)
 			break
 		}
 
 		// Validate received data
-		exitData, errC, errT, errM, errD = ValidateEnteredData(c, db, user, secret, entryData)
+		exitData, errC, errT, errM, errD = ValidateEnteredData(c, db, user, entryData)
 		if errC != nil {
+			client.Close()
 			ReturnError(c, *errT, *errM, *errC, errD)
 			break
 		}
-		broadcastChatMessage(c, mt, groupName, *exitData)
+		if err = ep.Broker.Publish(topic, *exitData); err != nil {
+			log.Println("Error publishing chat message: ", err)
+		}
 	}
 }
 
@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/kayprogrammer/socialnet-v6/events"
+)
+
+const (
+	socketSendBufferSize = 256              // Events a connection may have queued before it's evicted as too slow
+	socketWriteWait      = 10 * time.Second // Time allowed to write one event to a connection
+)
+
+// SocketConn is the part of a websocket connection (*websocket.Conn) a SocketClient writes with
+type SocketConn interface {
+	SetWriteDeadline(t time.Time) error
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// SocketClient owns the writes to a websocket connection. Events are queued without blocking
+// and written by a dedicated goroutine, so one slow connection never holds up the others.
+type SocketClient struct {
+	conn      SocketConn
+	send      chan []byte
+	evicted   chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+	evictOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewSocketClient(conn SocketConn) *SocketClient {
+	client := &SocketClient{
+		conn:    conn,
+		send:    make(chan []byte, socketSendBufferSize),
+		evicted: make(chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go client.writePump()
+	return client
+}
+
+// Queues data for the connection. A client whose queue is full can't keep up, so it gets evicted.
+func (client *SocketClient) Send(data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		client.evictOnce.Do(func() { close(client.evicted) })
+	}
+}
+
+// Stops the writer and waits for it to exit, after which the caller may write to the connection directly
+func (client *SocketClient) Close() {
+	client.stopOnce.Do(func() { close(client.stop) })
+	<-client.stopped
+}
+
+func (client *SocketClient) writePump() {
+	defer close(client.stopped)
+	for {
+		select {
+		case data := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Println("write:", err)
+				client.conn.Close() // Unblocks the handler's read so it can clean up
+				return
+			}
+		case <-client.evicted:
+			client.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Too slow to keep up"))
+			client.conn.Close()
+			return
+		case <-client.stop:
+			return
+		}
+	}
+}
+
+// ----------------------------------
+// SOCKET HUB
+// --------------------------------
+
+// SocketHub groups connections by topic (a chat group or a user's notifications). Each group holds
+// a single broker subscription, so an event only costs as much as the group it's published to.
+type SocketHub struct {
+	broker events.Broker
+	mutex  sync.Mutex
+	groups map[string]*socketGroup
+}
+
+type socketGroup struct {
+	sub     *events.Subscription
+	mutex   sync.RWMutex
+	clients map[*SocketClient]bool
+}
+
+func NewSocketHub(broker events.Broker) *SocketHub {
+	return &SocketHub{broker: broker, groups: make(map[string]*socketGroup)}
+}
+
+func (hub *SocketHub) Join(topic string, client *SocketClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	group := hub.groups[topic]
+	if group == nil {
+		group = &socketGroup{sub: hub.broker.Subscribe(topic), clients: make(map[*SocketClient]bool)}
+		hub.groups[topic] = group
+		go group.forward()
+	}
+	group.mutex.Lock()
+	group.clients[client] = true
+	group.mutex.Unlock()
+}
+
+func (hub *SocketHub) Leave(topic string, client *SocketClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	group := hub.groups[topic]
+	if group == nil {
+		return
+	}
+	group.mutex.Lock()
+	delete(group.clients, client)
+	empty := len(group.clients) == 0
+	group.mutex.Unlock()
+	if empty {
+		// Closes the subscription, which ends the group's forwarder
+		hub.broker.Unsubscribe(group.sub)
+		delete(hub.groups, topic)
+	}
+}
+
+// Hands every event published on the group's topic to its clients
+func (group *socketGroup) forward() {
+	for data := range group.sub.C {
+		group.mutex.RLock()
+		for client := range group.clients {
+			client.Send(data)
+		}
+		group.mutex.RUnlock()
+	}
+}
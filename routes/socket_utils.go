@@ -2,7 +2,6 @@ package routes
 
 import (
 	"encoding/json"
-	"sync"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/kayprogrammer/socialnet-v6/models"
@@ -10,26 +9,7 @@ import (
 	"gorm.io/gorm"
 )
 
-// Maintain db & a list of connected clients
-var (
-	clients      = make(map[*websocket.Conn]bool)
-	clientsMutex = &sync.Mutex{}
-	validator    = utils.Validator()
-)
-
-// Function to add a client to the list
-func AddClient(c *websocket.Conn) {
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
-	clients[c] = true
-}
-
-// Function to remove a client from the list
-func RemoveClient(c *websocket.Conn) {
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
-	delete(clients, c)
-}
+var validator = utils.Validator()
 
 type ErrorResp struct {
 	Status  string             `json:"status"`
@@ -48,24 +28,11 @@ func ReturnError(c *websocket.Conn, errType string, message string, code int, da
 	c.WriteMessage(websocket.TextMessage, jsonResponse)
 }
 
-func ValidateAuth(db *gorm.DB, token string) (*models.User, *string, *string) {
-	var (
-		errMsg *string
-		secret *string
-		user   *models.User
-	)
+func ValidateAuth(db *gorm.DB, token string) (*models.User, *string) {
 	if len(token) < 1 {
 		err := "Auth bearer not set"
-		errMsg = &err
-	} else if token == cfg.SocketSecret {
-		secret = &token
-	} else {
-		// Get User
-		userObj, err := GetUser(token, db)
-		if err != nil {
-			errMsg = err
-		}
-		user = userObj
+		return nil, &err
 	}
-	return user, secret, errMsg
+	// Get User
+	return GetUser(token, db)
 }
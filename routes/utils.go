@@ -2,17 +2,16 @@ package routes
 
 import (
 	"encoding/json"
-	"net/http"
-	"net/url"
-	"os"
+	"log"
 
-	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/managers"
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
+	"gorm.io/gorm"
 )
 
 func SuccessResponse(message string) schemas.ResponseSchema {
@@ -32,21 +31,33 @@ func ValidateReactionFocus(focus choices.FocusTypeChoice) *utils.ErrorResponse {
 	return &err
 }
 
-func SendNotificationInSocket(fiberCtx *fiber.Ctx, notification models.Notification, commentSlug *string, replySlug *string, statusOpts ...string) error {
-	if os.Getenv("ENVIRONMENT") == "TESTING" {
+func ValidateReportTarget(target choices.ReportTargetChoice) *utils.ErrorResponse {
+	switch target {
+	case choices.RTPOST, choices.RTCOMMENT, choices.RTREPLY, choices.RTMESSAGE, choices.RTPROFILE:
 		return nil
 	}
-	
-	// Check if page size is provided as an argument
+	err := utils.RequestErr(utils.ERR_INVALID_VALUE, "Invalid 'target' value")
+	return &err
+}
+
+func notificationsTopic(userID uuid.UUID) string {
+	return "notifications_" + userID.String()
+}
+
+func chatTopic(chatID string) string {
+	return "chat_" + chatID
+}
+
+// Publishes a notification to the notification sockets of each of its receivers
+func (ep Endpoint) PublishNotification(notification models.Notification, commentSlug *string, replySlug *string, statusOpts ...string) {
+	if notification.ID == nil { // Not created, as none of its receivers could be reached
+		return
+	}
+	// Check if status is provided as an argument
 	status := "CREATED"
 	if len(statusOpts) > 0 {
 		status = statusOpts[0]
 	}
-	webSocketScheme := "ws://"
-	if fiberCtx.Secure() {
-		webSocketScheme = "wss://"
-	}
-	uri := webSocketScheme + fiberCtx.Hostname() + "/api/v6/ws/notifications/"
 	notificationData := SocketNotificationSchema{
 		Notification: models.Notification{BaseModel: models.BaseModel{ID: notification.ID}, Ntype: notification.Ntype, CommentSlug: commentSlug, ReplySlug: replySlug},
 		Status:             status,
@@ -57,77 +68,108 @@ func SendNotificationInSocket(fiberCtx *fiber.Ctx, notification models.Notificat
 			Status:             status,
 		}
 	}
-
-	// Connect to the WebSocket server
-	u, err := url.Parse(uri)
-	if err != nil {
-		return err
+	data, _ := json.Marshal(notificationData)
+	for _, receiverID := range notificationManager.GetReceiverIDs(ep.DB, notification.ID) {
+		if err := ep.Broker.Publish(notificationsTopic(receiverID), data); err != nil {
+			log.Println("Error publishing notification: ", err)
+		}
 	}
+}
 
-	headers := make(http.Header)
-	headers.Add("Authorization", cfg.SocketSecret)
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), headers)
-	if err != nil {
-		return err
+// Publishes an admin notification to the notification sockets of its receivers who are online.
+// The rest get it with their notifications
+func (ep Endpoint) PublishAdminNotification(notification models.Notification) {
+	data, _ := json.Marshal(SocketNotificationSchema{Notification: notification.Init(nil), Status: "CREATED"})
+	for _, receiverID := range notificationManager.GetOnlineReceiverIDs(ep.DB, notification.ID) {
+		if err := ep.Broker.Publish(notificationsTopic(receiverID), data); err != nil {
+			log.Println("Error publishing notification: ", err)
+		}
 	}
-	defer conn.Close()
+}
 
-	// Marshal the notification data to JSON
-	data, err := json.Marshal(notificationData)
-	if err != nil {
-		return err
-	}
+var (
+	mentionManager = managers.MentionManager{}
+	hashtagManager = managers.HashtagManager{}
+)
 
-	// Send the notification to the WebSocket server
-	err = conn.WriteMessage(websocket.TextMessage, data)
-	if err != nil {
-		return err
+// Records the hashtags and mentions in the text of a post or comment (whichever is given),
+// and notifies the users it newly mentions. Only users who can see the post can be mentioned
+func (ep Endpoint) SyncTags(user *models.User, post *models.Post, comment *models.Comment) {
+	db := ep.DB
+	var text string
+	mentionTarget, hashtagTarget := models.Mention{}, models.Hashtag{}
+	visibleTo := models.Post{}
+	if post != nil {
+		text = post.Text
+		mentionTarget.PostID, hashtagTarget.PostID = &post.ID, &post.ID
+		visibleTo = *post
+	} else {
+		text = comment.Text
+		mentionTarget.CommentID, hashtagTarget.CommentID = &comment.ID, &comment.ID
+		db.Take(&visibleTo, "id = ?", comment.PostID)
+	}
+	hashtagManager.Sync(db, hashtagTarget, text)
+	mentioned := mentionManager.Sync(db, mentionTarget, text, *user, postManager.AudienceScope(visibleTo))
+	if len(mentioned) > 0 {
+		notification := notificationManager.CreateMention(db, user, mentioned, post, comment, nil)
+		ep.PublishNotification(notification, nil, nil)
 	}
-
-	// Close the WebSocket connection
-	return conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 }
 
-func SendMessageDeletionInSocket(fiberCtx *fiber.Ctx, chatID uuid.UUID, messageID uuid.UUID) error {
-	if os.Getenv("ENVIRONMENT") == "TESTING" {
-		return nil
+// Records the mentions in a message and notifies the users it newly mentions.
+// Only members of the message's chat can be mentioned in it
+func (ep Endpoint) SyncMessageMentions(user *models.User, chat models.Chat, message *models.Message) {
+	db := ep.DB
+	if message.Text == nil {
+		return
+	}
+	memberIDs := db.Table("chat_users").Select("user_id").Where("chat_id = ?", chat.ID)
+	inChat := func(q *gorm.DB) *gorm.DB {
+		return q.Where("users.id = ? OR users.id IN (?)", chat.OwnerID, memberIDs)
 	}
-	webSocketScheme := "ws://"
-	if fiberCtx.Secure() {
-		webSocketScheme = "wss://"
+	mentioned := mentionManager.Sync(db, models.Mention{MessageID: &message.ID}, *message.Text, *user, inChat)
+	if len(mentioned) > 0 {
+		notification := notificationManager.CreateMention(db, user, mentioned, nil, nil, message)
+		ep.PublishNotification(notification, nil, nil)
 	}
-	uri := webSocketScheme + fiberCtx.Hostname() + "/api/v6/ws/chats/" + chatID.String()
+}
+
+// Lets the chat sockets know that a message was deleted
+func (ep Endpoint) PublishMessageDeletion(chatID uuid.UUID, messageID uuid.UUID) {
 	chatData := SocketMessageEntrySchema{
 		ID:     messageID,
 		Status: "DELETED",
 	}
-
-	// Connect to the WebSocket server
-	u, err := url.Parse(uri)
-	if err != nil {
-		return err
-	}
-
-	headers := make(http.Header)
-	headers.Add("Authorization", cfg.SocketSecret)
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), headers)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	// Marshal the notification data to JSON
-	data, err := json.Marshal(chatData)
-	if err != nil {
-		return err
+	data, _ := json.Marshal(chatData)
+	if err := ep.Broker.Publish(chatTopic(chatID.String()), data); err != nil {
+		log.Println("Error publishing message deletion: ", err)
 	}
+}
 
-	// Send the message to the WebSocket server
-	err = conn.WriteMessage(websocket.TextMessage, data)
-	if err != nil {
-		return err
+// Counts a socket connection (or disconnection) of the user.
+// Their chats are told when that brings them online or takes them offline.
+func (ep Endpoint) UpdatePresence(db *gorm.DB, user *models.User, connected bool) {
+	status := "ONLINE"
+	changed := false
+	if connected {
+		changed = presenceManager.Connect(db, user)
+	} else {
+		status = "OFFLINE"
+		changed = presenceManager.Disconnect(db, user)
+	}
+	if !changed {
+		return
+	}
+	for _, chatID := range chatManager.GetUserChatIDs(db, *user) {
+		presenceData := SocketChatEventSchema{
+			Status:     status,
+			ChatID:     chatID,
+			User:       models.UserDataSchema{}.Init(*user),
+			LastSeenAt: user.LastSeenAt,
+		}
+		data, _ := json.Marshal(presenceData)
+		if err := ep.Broker.Publish(chatTopic(chatID.String()), data); err != nil {
+			log.Println("Error publishing presence: ", err)
+		}
 	}
-
-	// Close the WebSocket connection
-	return conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 }
@@ -0,0 +1,132 @@
+package schemas
+
+import (
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/pborman/uuid"
+)
+
+type SiteDetailUpdateSchema struct {
+	Name    *string `json:"name" validate:"omitempty,min=1,max=50" example:"SocialNet"`
+	Email   *string `json:"email" validate:"omitempty,email" example:"kayprogrammer1@gmail.com"`
+	Phone   *string `json:"phone" validate:"omitempty,min=1,max=20" example:"+2348133831036"`
+	Address *string `json:"address" validate:"omitempty,min=1,max=500" example:"234, Lagos, Nigeria"`
+	Fb      *string `json:"fb" validate:"omitempty,url" example:"https://facebook.com"`
+	Tw      *string `json:"tw" validate:"omitempty,url" example:"https://twitter.com"`
+	Wh      *string `json:"wh" validate:"omitempty,url" example:"https://wa.me/2348133831036"`
+	Ig      *string `json:"ig" validate:"omitempty,url" example:"https://instagram.com"`
+}
+
+func (s SiteDetailUpdateSchema) SetValues(siteDetail *models.SiteDetail) *models.SiteDetail {
+	if s.Name != nil {
+		siteDetail.Name = *s.Name
+	}
+	if s.Email != nil {
+		siteDetail.Email = *s.Email
+	}
+	if s.Phone != nil {
+		siteDetail.Phone = *s.Phone
+	}
+	if s.Address != nil {
+		siteDetail.Address = *s.Address
+	}
+	if s.Fb != nil {
+		siteDetail.Fb = *s.Fb
+	}
+	if s.Tw != nil {
+		siteDetail.Tw = *s.Tw
+	}
+	if s.Wh != nil {
+		siteDetail.Wh = *s.Wh
+	}
+	if s.Ig != nil {
+		siteDetail.Ig = *s.Ig
+	}
+	return siteDetail
+}
+
+// Filters of the users listed for superusers. Unset ones aren't applied
+type UserFilterSchema struct {
+	Search          string
+	IsEmailVerified *bool
+	IsStaff         *bool
+	IsSuperuser     *bool
+	IsSuspended     *bool
+}
+
+// Flags to change on a user. Unset ones are left as they are
+type AdminUserUpdateSchema struct {
+	IsEmailVerified *bool `json:"is_email_verified" example:"true"`
+	IsStaff         *bool `json:"is_staff" example:"true"`
+	IsSuspended     *bool `json:"is_suspended" example:"false"` // Suspending logs the user out everywhere
+}
+
+// Admin notification and who it's for. city_id, country_id or usernames goes with the matching audience
+type AdminNotificationSchema struct {
+	Text      string                             `json:"text" validate:"required,max=10000" example:"A new update is coming!"`
+	Audience  choices.NotificationAudienceChoice `json:"audience" validate:"required,notification_audience_validator" example:"ALL"`
+	CityID    *uuid.UUID                         `json:"city_id" validate:"required_if=Audience CITY" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	CountryID *uuid.UUID                         `json:"country_id" validate:"required_if=Audience COUNTRY" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+	Usernames []string                           `json:"usernames" validate:"required_if=Audience USERS" example:"john-doe"`
+}
+
+// RESPONSE SCHEMAS
+// USERS
+// A user with the account details only superusers get to see
+type AdminUserSchema struct {
+	models.User
+	IsEmailVerified bool       `json:"is_email_verified" example:"true"`
+	IsStaff         bool       `json:"is_staff" example:"false"`
+	IsSuperuser     bool       `json:"is_superuser" example:"false"`
+	IsSuspended     bool       `json:"is_suspended" example:"false"`
+	TotpEnabled     bool       `json:"totp_enabled" example:"false"`
+	LastSeenAt      *time.Time `json:"last_seen_at"`
+}
+
+func (data AdminUserSchema) Init(user models.User) AdminUserSchema {
+	data.User = user.Init()
+	data.IsEmailVerified = user.IsEmailVerified
+	data.IsStaff = user.IsStaff
+	data.IsSuperuser = user.IsSuperuser
+	data.IsSuspended = user.IsSuspended
+	data.TotpEnabled = user.TotpEnabled
+	data.LastSeenAt = user.LastSeenAt
+	return data
+}
+
+type AdminUsersResponseDataSchema struct {
+	PaginatedResponseDataSchema
+	Items []AdminUserSchema `json:"users"`
+}
+
+func (data AdminUsersResponseDataSchema) Init(users []models.User) AdminUsersResponseDataSchema {
+	// Set Initial Data
+	data.Items = []AdminUserSchema{}
+	for _, user := range users {
+		data.Items = append(data.Items, AdminUserSchema{}.Init(user))
+	}
+	return data
+}
+
+type AdminUsersResponseSchema struct {
+	ResponseSchema
+	Data AdminUsersResponseDataSchema `json:"data"`
+}
+
+type AdminUserResponseSchema struct {
+	ResponseSchema
+	Data AdminUserSchema `json:"data"`
+}
+
+// NOTIFICATIONS
+type AdminNotificationDataSchema struct {
+	models.Notification
+	ReceiversCount int64 `json:"receivers_count" example:"1000"`
+}
+
+type AdminNotificationResponseSchema struct {
+	ResponseSchema
+	Data AdminNotificationDataSchema `json:"data"`
+}
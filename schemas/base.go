@@ -10,9 +10,11 @@ type ResponseSchema struct {
 }
 
 type PaginatedResponseDataSchema struct {
-	PerPage     uint `json:"per_page" example:"100"`
-	CurrentPage uint `json:"current_page" example:"1"`
-	LastPage    uint `json:"last_page" example:"100"`
+	PerPage     uint    `json:"per_page" example:"100"`
+	CurrentPage uint    `json:"current_page" example:"1"`
+	LastPage    uint    `json:"last_page" example:"100"`
+	NextCursor  *string `json:"next_cursor" example:"eyJjIjoiMjAyNC0wMS0wMVQwMDowMDowMFoiLCJpIjoiZDEwZGRlNjQtYTI0Mi00ZWQwLWJkNzUtNGM3NTk2NDRiM2E2In0"`
+	PrevCursor  *string `json:"prev_cursor" example:"eyJjIjoiMjAyNC0wMS0wMVQwMDowMDowMFoiLCJpIjoiZDEwZGRlNjQtYTI0Mi00ZWQwLWJkNzUtNGM3NTk2NDRiM2E2IiwicCI6dHJ1ZX0"`
 }
 
 type UserDataSchema struct {
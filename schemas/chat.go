@@ -9,12 +9,12 @@ type MessageCreateSchema struct {
 	ChatID   *uuid.UUID `json:"chat_id" validate:"omitempty" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
 	Username *string    `json:"username,omitempty" validate:"required_without=ChatID" example:"john-doe"`
 	Text     *string    `json:"text" validate:"required_without=FileType" example:"I am not in danger skyler, I am the danger"`
-	FileType *string    `json:"file_type" validate:"omitempty,file_type_validator" example:"image/jpeg"`
+	FileType *string    `json:"file_type" validate:"omitempty,media_type_validator" example:"image/jpeg"`
 }
 
 type MessageUpdateSchema struct {
 	Text     *string `json:"text" validate:"required_without=FileType" example:"The Earth is the Lord's and the fullness thereof"`
-	FileType *string `json:"file_type" validate:"omitempty,file_type_validator" example:"image/jpeg"`
+	FileType *string `json:"file_type" validate:"omitempty,media_type_validator" example:"image/jpeg"`
 }
 
 type MessagesResponseDataSchema struct {
@@ -35,15 +35,21 @@ func (data MessagesResponseDataSchema) Init() MessagesResponseDataSchema {
 type MessagesSchema struct {
 	Chat     models.Chat                `json:"chat"`
 	Messages MessagesResponseDataSchema `json:"messages"`
-	Users    []models.UserDataSchema    `json:"users"`
+	Users    []models.ChatUserSchema    `json:"users"`
 }
 
 func (data MessagesSchema) Init() MessagesSchema {
 	// Set Initial Data
-	chat := data.Chat.InitG()
-	// Set Users
-	data.Users = chat.Users
-	chat.Users = nil
+	chat := data.Chat.Init()
+	// Set Users alongside their presence
+	users := []models.ChatUserSchema{}
+	for _, user := range chat.UserObjs {
+		if !user.IsActive() {
+			continue
+		}
+		users = append(users, models.ChatUserSchema{}.Init(user))
+	}
+	data.Users = users
 	data.Chat = chat
 	return data
 }
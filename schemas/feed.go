@@ -3,11 +3,35 @@ package schemas
 import (
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/pborman/uuid"
 )
 
 type PostInputSchema struct {
 	Text				string		`json:"text" validate:"required" example:"God is good"`
-	FileType			*string		`json:"file_type" example:"image/jpeg" validate:"omitempty,file_type_validator"`
+	FileTypes			[]string	`json:"file_types" example:"image/jpeg,video/mp4" validate:"omitempty,dive,media_type_validator"`
+	// PUBLIC, FRIENDS, ONLY_ME or CUSTOM. A new post is PUBLIC and an updated one keeps its own when it's not sent
+	Visibility			choices.PostVisibilityChoice	`json:"visibility" validate:"omitempty,post_visibility_validator" example:"PUBLIC"`
+	// Usernames of who can see a CUSTOM post. An updated CUSTOM post keeps its audience when it's not sent
+	Audience			*[]string	`json:"audience" example:"john-doe"`
+}
+
+type PostUpdateSchema struct {
+	PostInputSchema
+	// Ids of the post's media in the order they should be in. Media left out are removed, and new
+	// ones from file_types come after. The media stay as they are when it's not sent.
+	MediaIDs			*[]string	`json:"media_ids" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
+}
+
+type RepostInputSchema struct {
+	Text				string		`json:"text" example:"So true!"` // Leave out for a plain repost
+}
+
+type BookmarkInputSchema struct {
+	CollectionID		*uuid.UUID	`json:"collection_id" validate:"omitempty" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"` // Leave out to bookmark outside collections
+}
+
+type CollectionInputSchema struct {
+	Name				string		`json:"name" validate:"required,max=100" example:"Recipes"`
 }
 
 // // REACTION SCHEMA
@@ -83,10 +107,21 @@ type ReactionResponseSchema struct {
 	Data			models.Reaction		`json:"data"`
 }
 
+// HASHTAGS
+type TrendingHashtagSchema struct {
+	Tag				string			`json:"tag" example:"jesus"`
+	Count			int64			`json:"count" example:"120"` // Times used within the window
+}
+
+type TrendingHashtagsResponseSchema struct {
+	ResponseSchema
+	Data			[]TrendingHashtagSchema		`json:"data"`
+}
+
 // COMMENTS & REPLIES
 type CommentWithRepliesResponseDataSchema struct {
 	PaginatedResponseDataSchema
-	Items			[]models.Reply		`json:"items"`
+	Items			[]models.Comment		`json:"items"`
 }
 
 func (data CommentWithRepliesResponseDataSchema) Init () CommentWithRepliesResponseDataSchema {
@@ -136,5 +171,15 @@ type CommentWithRepliesResponseSchema struct {
 
 type ReplyResponseSchema struct {
 	ResponseSchema
-	Data			models.Reply			`json:"data"`
-}
\ No newline at end of file
+	Data			models.Comment			`json:"data"`
+}
+// BOOKMARKS
+type CollectionResponseSchema struct {
+	ResponseSchema
+	Data			models.Collection		`json:"data"`
+}
+
+type CollectionsResponseSchema struct {
+	ResponseSchema
+	Data			[]models.Collection		`json:"data"`
+}
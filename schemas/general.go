@@ -6,3 +6,49 @@ type SiteDetailResponseSchema struct {
 	ResponseSchema
 	Data models.SiteDetail `json:"data"`
 }
+
+// FILES
+type FileResponseSchema struct {
+	ResponseSchema
+	Data models.File `json:"data"`
+}
+
+// SEARCH
+// Only the list of the searched type is set
+type SearchResponseDataSchema struct {
+	PaginatedResponseDataSchema
+	Posts    *[]models.Post    `json:"posts,omitempty"`
+	Comments *[]models.Comment `json:"comments,omitempty"`
+	Users    *[]models.User    `json:"users,omitempty"`
+	Messages *[]models.Message `json:"messages,omitempty"`
+}
+
+func (data SearchResponseDataSchema) Init() SearchResponseDataSchema {
+	// Set Initial Data
+	if posts := data.Posts; posts != nil {
+		for i := range *posts {
+			(*posts)[i] = (*posts)[i].Init()
+		}
+	}
+	if comments := data.Comments; comments != nil {
+		for i := range *comments {
+			(*comments)[i] = (*comments)[i].Init()
+		}
+	}
+	if users := data.Users; users != nil {
+		for i := range *users {
+			(*users)[i] = (*users)[i].Init()
+		}
+	}
+	if messages := data.Messages; messages != nil {
+		for i := range *messages {
+			(*messages)[i] = (*messages)[i].Init()
+		}
+	}
+	return data
+}
+
+type SearchResponseSchema struct {
+	ResponseSchema
+	Data SearchResponseDataSchema `json:"data"`
+}
@@ -0,0 +1,64 @@
+package schemas
+
+import (
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+)
+
+type ReportInputSchema struct {
+	Reason  choices.ReportReasonChoice `json:"reason" validate:"required,report_reason_validator" example:"SPAM"`
+	Details *string                    `json:"details" validate:"omitempty,max=1000" example:"Keeps posting the same link"`
+}
+
+type ReportActionSchema struct {
+	Action choices.ReportActionChoice `json:"action" validate:"required,report_action_validator" example:"HIDE_CONTENT"`
+	Note   *string                    `json:"note" validate:"omitempty,max=1000" example:"Spam link removed"`
+}
+
+// RESPONSE SCHEMAS
+// REPORTS
+type ReportsResponseDataSchema struct {
+	PaginatedResponseDataSchema
+	Items []models.Report `json:"reports"`
+}
+
+func (data ReportsResponseDataSchema) Init() ReportsResponseDataSchema {
+	// Set Initial Data
+	items := data.Items
+	for i := range items {
+		items[i] = items[i].Init()
+	}
+	data.Items = items
+	return data
+}
+
+type ReportsResponseSchema struct {
+	ResponseSchema
+	Data ReportsResponseDataSchema `json:"data"`
+}
+
+type ReportResponseSchema struct {
+	ResponseSchema
+	Data models.Report `json:"data"`
+}
+
+// AUDIT LOGS
+type AuditLogsResponseDataSchema struct {
+	PaginatedResponseDataSchema
+	Items []models.AuditLog `json:"audit_logs"`
+}
+
+func (data AuditLogsResponseDataSchema) Init() AuditLogsResponseDataSchema {
+	// Set Initial Data
+	items := data.Items
+	for i := range items {
+		items[i] = items[i].Init()
+	}
+	data.Items = items
+	return data
+}
+
+type AuditLogsResponseSchema struct {
+	ResponseSchema
+	Data AuditLogsResponseDataSchema `json:"data"`
+}
@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/kayprogrammer/socialnet-v6/models"
-	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 )
 
@@ -42,6 +41,11 @@ type AcceptFriendRequestSchema struct {
 	Accepted bool `json:"accepted" example:"true"`
 }
 
+type BlockUserSchema struct {
+	Username string `json:"username" validate:"required" example:"john-doe"`
+	Mute     bool   `json:"mute" example:"false"` // Mutes the user instead of blocking them
+}
+
 type ReadNotificationSchema struct {
 	MarkAllAsRead bool       `json:"mark_all_as_read" example:"false"`
 	ID            *uuid.UUID `json:"id" validate:"required_if=MarkAllAsRead false,omitempty" example:"d10dde64-a242-4ed0-bd75-4c759644b3a6"`
@@ -92,14 +96,13 @@ type ProfileResponseSchema struct {
 
 type ProfileUpdateResponseDataSchema struct {
 	models.User
-	FileUploadData *utils.SignatureFormat `json:"file_upload_data"`
+	FileUploadData *models.FileUploadData `json:"file_upload_data"`
 }
 
 func (profileData ProfileUpdateResponseDataSchema) Init(fileType *string) ProfileUpdateResponseDataSchema {
 	image := profileData.User.AvatarObj
 	if fileType != nil && image != nil { // Generate data when file is being uploaded
-		fuData := utils.GenerateFileSignature(image.ID.String(), "avatars")
-		profileData.FileUploadData = &fuData
+		profileData.FileUploadData = image.UploadData("avatars")
 	}
 	profileData.User = profileData.User.Init()
 	return profileData
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+)
+
+// Cloudinary only honours signed upload requests for an hour
+const cloudinarySignatureLifetime = time.Hour
+
+type CloudinaryStorage struct {
+	cld       *cloudinary.Cloudinary
+	cloudName string
+	apiKey    string
+	apiSecret string
+}
+
+func NewCloudinaryStorage(cfg config.Config) *CloudinaryStorage {
+	cld, err := cloudinary.NewFromParams(cfg.CloudinaryCloudName, cfg.CloudinaryAPIKey, cfg.CloudinaryAPISecret)
+	if err != nil && cfg.StorageBackend == "cloudinary" {
+		log.Println("Error initializing Cloudinary: ", err)
+	}
+	return &CloudinaryStorage{cld: cld, cloudName: cfg.CloudinaryCloudName, apiKey: cfg.CloudinaryAPIKey, apiSecret: cfg.CloudinaryAPISecret}
+}
+
+func (backend *CloudinaryStorage) Name() string {
+	return "cloudinary"
+}
+
+// Cloudinary keeps videos and audio as "video" assets and documents as "raw" ones
+func resourceType(key string) api.AssetType {
+	contentType, _ := utils.MediaTypeByExtension(strings.TrimPrefix(path.Ext(key), "."))
+	switch utils.MediaTypes[contentType].Kind {
+	case choices.MKVIDEO, choices.MKAUDIO:
+		return api.Video
+	case choices.MKDOCUMENT:
+		return api.File
+	}
+	return api.Image
+}
+
+// Cloudinary public ids leave out the extension, except for raw files which are served as they are
+func publicId(key string) string {
+	if resourceType(key) == api.File {
+		return key
+	}
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+func (backend *CloudinaryStorage) PresignUpload(key string, contentType string) UploadData {
+	timestamp := time.Now().Unix()
+	values := url.Values{}
+	values.Add("public_id", publicId(key))
+	values.Add("timestamp", fmt.Sprint(timestamp))
+	signature, err := api.SignParameters(values, backend.apiSecret)
+	if err != nil {
+		log.Println("Error signing params: ", err)
+	}
+	return UploadData{
+		Method: "POST",
+		Url:    fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/%s/upload", backend.cloudName, resourceType(key)),
+		Fields: map[string]string{
+			"api_key":   backend.apiKey,
+			"public_id": publicId(key),
+			"timestamp": fmt.Sprint(timestamp),
+			"signature": signature,
+		},
+		ExpiresAt: time.Unix(timestamp, 0).Add(cloudinarySignatureLifetime),
+	}
+}
+
+// Delivery urls of public uploads don't expire
+func (backend *CloudinaryStorage) PresignDownload(key string, contentType string) string {
+	if backend.cld == nil {
+		return ""
+	}
+	newAsset := backend.cld.Image
+	switch resourceType(key) {
+	case api.Video:
+		newAsset = backend.cld.Video
+	case api.File:
+		newAsset = backend.cld.File
+	}
+	asset, err := newAsset(key)
+	if err != nil {
+		log.Println("Error generating Cloudinary URL:", err)
+		return ""
+	}
+	url, err := asset.String()
+	if err != nil {
+		log.Println("Error converting to string:", err)
+	}
+	return url
+}
+
+func (backend *CloudinaryStorage) Open(key string) (io.ReadCloser, error) {
+	url := backend.PresignDownload(key, "")
+	if url == "" {
+		return nil, fmt.Errorf("couldn't build url for %s", key)
+	}
+	return openUrl(url)
+}
+
+func (backend *CloudinaryStorage) Delete(key string) error {
+	if backend.cld == nil {
+		return fmt.Errorf("cloudinary isn't configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := backend.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: publicId(key), ResourceType: string(resourceType(key))})
+	if err != nil {
+		return err
+	}
+	if result.Error.Message != "" {
+		return fmt.Errorf("cloudinary: %s", result.Error.Message)
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Playing time of an audio or video file in seconds, read from its container's headers.
+// Containers that aren't handled here (or can't be parsed) give none.
+func probeDuration(file io.ReaderAt, size int64, contentType string) *float64 {
+	head := make([]byte, 12)
+	if n, _ := file.ReadAt(head, 0); n < len(head) {
+		return nil
+	}
+	var seconds float64
+	var ok bool
+	switch {
+	case string(head[4:8]) == "ftyp":
+		seconds, ok = mp4Duration(file, size)
+	case bytes.Equal(head[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		seconds, ok = webmDuration(file, size)
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		seconds, ok = wavDuration(file, size)
+	case string(head[:4]) == "OggS":
+		seconds, ok = oggDuration(file, size)
+	case contentType == "audio/mpeg": // No magic of its own, just an optional ID3 tag
+		seconds, ok = mp3Duration(file, size)
+	}
+	if !ok || seconds <= 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return nil
+	}
+	return &seconds
+}
+
+// Reads exactly len(buf) bytes at the offset
+func readFull(file io.ReaderAt, buf []byte, offset int64) bool {
+	n, _ := file.ReadAt(buf, offset)
+	return n == len(buf)
+}
+
+// MP4, MOV and M4A: the movie header box holds the duration in its own timescale
+
+// Finds the box with the name among the boxes between start and end, returning where its content starts and its size
+func findBox(file io.ReaderAt, start int64, end int64, name string) (int64, int64, bool) {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		n, _ := file.ReadAt(header, offset)
+		if n < 8 {
+			return 0, 0, false
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header[0:4])), int64(8)
+		switch boxSize {
+		case 0: // Runs to the end
+			boxSize = end - offset
+		case 1: // 64 bit size follows the name
+			if n < 16 {
+				return 0, 0, false
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if boxSize < headerSize {
+			return 0, 0, false
+		}
+		if string(header[4:8]) == name {
+			return offset + headerSize, boxSize - headerSize, true
+		}
+		offset += boxSize
+	}
+	return 0, 0, false
+}
+
+func mp4Duration(file io.ReaderAt, size int64) (float64, bool) {
+	moov, moovSize, ok := findBox(file, 0, size, "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, _, ok := findBox(file, moov, moov+moovSize, "mvhd")
+	if !ok {
+		return 0, false
+	}
+	buf := make([]byte, 32)
+	if !readFull(file, buf, mvhd) {
+		return 0, false
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 { // Version 1 has 64 bit times
+		timescale, duration = uint64(binary.BigEndian.Uint32(buf[20:24])), binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale, duration = uint64(binary.BigEndian.Uint32(buf[12:16])), uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return float64(duration) / float64(timescale), true
+}
+
+// WebM and Matroska: EBML elements, with the duration in the segment info
+
+// Reads an EBML variable length integer. IDs keep their length marker, sizes don't
+func readVint(file io.ReaderAt, offset int64, keepMarker bool) (uint64, int, bool) {
+	first := make([]byte, 1)
+	if !readFull(file, first, offset) || first[0] == 0 {
+		return 0, 0, false
+	}
+	length := 1
+	for mask := byte(0x80); first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	buf := make([]byte, length)
+	if !readFull(file, buf, offset) {
+		return 0, 0, false
+	}
+	if !keepMarker {
+		buf[0] &= 0xFF >> length
+	}
+	value := uint64(0)
+	for _, b := range buf {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, true
+}
+
+// Reads an element header, returning its id, where its data starts and its size (-1 if unknown)
+func ebmlElement(file io.ReaderAt, offset int64) (uint64, int64, int64, bool) {
+	id, idLength, ok := readVint(file, offset, true)
+	if !ok || idLength > 4 {
+		return 0, 0, 0, false
+	}
+	dataSize, sizeLength, ok := readVint(file, offset+int64(idLength), false)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	size := int64(dataSize)
+	if dataSize == 1<<(7*sizeLength)-1 || size < 0 { // All ones means the size isn't known
+		size = -1
+	}
+	return id, offset + int64(idLength+sizeLength), size, true
+}
+
+const (
+	ebmlSegmentID       = 0x18538067
+	ebmlInfoID          = 0x1549A966
+	ebmlClusterID       = 0x1F43B675
+	ebmlTimecodeScaleID = 0x2AD7B1
+	ebmlDurationID      = 0x4489
+)
+
+func webmDuration(file io.ReaderAt, size int64) (float64, bool) {
+	// Skip the EBML header to the segment
+	_, data, dataSize, ok := ebmlElement(file, 0)
+	if !ok || dataSize < 0 {
+		return 0, false
+	}
+	id, segment, segmentSize, ok := ebmlElement(file, data+dataSize)
+	if !ok || id != ebmlSegmentID {
+		return 0, false
+	}
+	segmentEnd := size
+	if segmentSize >= 0 && segment+segmentSize < size {
+		segmentEnd = segment + segmentSize
+	}
+	for offset := segment; offset < segmentEnd; {
+		id, data, dataSize, ok := ebmlElement(file, offset)
+		if !ok || dataSize < 0 || id == ebmlClusterID { // The info comes before any media
+			return 0, false
+		}
+		if id == ebmlInfoID {
+			return webmInfoDuration(file, data, data+dataSize)
+		}
+		offset = data + dataSize
+	}
+	return 0, false
+}
+
+func webmInfoDuration(file io.ReaderAt, start int64, end int64) (float64, bool) {
+	timecodeScale, duration := float64(1000000), float64(-1) // Nanoseconds per tick by default
+	for offset := start; offset < end; {
+		id, data, dataSize, ok := ebmlElement(file, offset)
+		if !ok || dataSize < 0 || dataSize > 8 && (id == ebmlTimecodeScaleID || id == ebmlDurationID) {
+			return 0, false
+		}
+		switch id {
+		case ebmlTimecodeScaleID:
+			buf := make([]byte, dataSize)
+			if !readFull(file, buf, data) {
+				return 0, false
+			}
+			scale := uint64(0)
+			for _, b := range buf {
+				scale = scale<<8 | uint64(b)
+			}
+			timecodeScale = float64(scale)
+		case ebmlDurationID:
+			buf := make([]byte, dataSize)
+			if !readFull(file, buf, data) {
+				return 0, false
+			}
+			switch dataSize {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(buf))
+			default:
+				return 0, false
+			}
+		}
+		offset = data + dataSize
+	}
+	if duration < 0 {
+		return 0, false
+	}
+	return duration * timecodeScale / 1e9, true
+}
+
+// WAV: the data chunk's size over the byte rate of the format chunk
+
+func wavDuration(file io.ReaderAt, size int64) (float64, bool) {
+	byteRate, dataSize := uint32(0), int64(-1)
+	header := make([]byte, 8)
+	for offset := int64(12); offset+8 <= size && (byteRate == 0 || dataSize < 0); {
+		if !readFull(file, header, offset) {
+			return 0, false
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:8]))
+		switch string(header[0:4]) {
+		case "fmt ":
+			format := make([]byte, 12)
+			if !readFull(file, format, offset+8) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+		case "data":
+			dataSize = chunkSize
+			if offset+8+dataSize > size { // Streamed files may not have the size filled in
+				dataSize = size - offset - 8
+			}
+		}
+		offset += 8 + chunkSize + chunkSize%2 // Chunks are padded to even sizes
+	}
+	if byteRate == 0 || dataSize < 0 {
+		return 0, false
+	}
+	return float64(dataSize) / float64(byteRate), true
+}
+
+// Ogg (Vorbis or Opus): the granule position of the last page counts samples at the stream's rate
+
+func oggDuration(file io.ReaderAt, size int64) (float64, bool) {
+	// The first page carries just the codec's identification header
+	pageHeader := make([]byte, 27)
+	if !readFull(file, pageHeader, 0) {
+		return 0, false
+	}
+	packet := make([]byte, 19)
+	if !readFull(file, packet, 27+int64(pageHeader[26])) {
+		return 0, false
+	}
+	var sampleRate, preSkip float64
+	switch {
+	case string(packet[:7]) == "\x01vorbis":
+		sampleRate = float64(binary.LittleEndian.Uint32(packet[12:16]))
+	case string(packet[:8]) == "OpusHead":
+		sampleRate, preSkip = 48000, float64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0, false
+	}
+
+	tailSize := int64(65536) // Pages can't be longer than this
+	if tailSize > size {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+	if !readFull(file, tail, size-tailSize) {
+		return 0, false
+	}
+	lastPage := bytes.LastIndex(tail, []byte("OggS"))
+	if lastPage < 0 || lastPage+14 > len(tail) || sampleRate == 0 {
+		return 0, false
+	}
+	granule := float64(binary.LittleEndian.Uint64(tail[lastPage+6 : lastPage+14]))
+	return (granule - preSkip) / sampleRate, true
+}
+
+// MP3: frame count from a Xing or VBRI header, or a constant bitrate worked out from the first frame
+
+var (
+	mp3Bitrates       = [2][15]int{{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}, {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}}
+	mp3SampleRates    = [3]int{44100, 48000, 32000}
+	mp3FrameSyncLimit = int64(65536) // How far past the tag to look for the first frame
+)
+
+func mp3Duration(file io.ReaderAt, size int64) (float64, bool) {
+	offset := int64(0)
+	id3 := make([]byte, 10)
+	if readFull(file, id3, 0) && string(id3[:3]) == "ID3" {
+		tagSize := int64(id3[6]&0x7F)<<21 | int64(id3[7]&0x7F)<<14 | int64(id3[8]&0x7F)<<7 | int64(id3[9]&0x7F)
+		offset = 10 + tagSize
+		if id3[5]&0x10 != 0 { // Footer present
+			offset += 10
+		}
+	}
+
+	// Find the first Layer III frame
+	window := mp3FrameSyncLimit
+	if offset+window > size {
+		window = size - offset
+	}
+	if window < 4 {
+		return 0, false
+	}
+	buf := make([]byte, window)
+	if !readFull(file, buf, offset) {
+		return 0, false
+	}
+	frame := -1
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] == 0xFF && buf[i+1]&0xE0 == 0xE0 && (buf[i+1]>>1)&3 == 1 && buf[i+2]>>4 != 0 && buf[i+2]>>4 != 15 && (buf[i+2]>>2)&3 != 3 && (buf[i+1]>>3)&3 != 1 {
+			frame = i
+			break
+		}
+	}
+	if frame < 0 {
+		return 0, false
+	}
+	header := buf[frame : frame+4]
+	version := (header[1] >> 3) & 3 // 3 is MPEG 1, 2 is MPEG 2 and 0 is MPEG 2.5
+	sampleRate := mp3SampleRates[(header[2]>>2)&3]
+	bitrates, samplesPerFrame, sideInfo := mp3Bitrates[0], 1152, 32
+	if version != 3 {
+		bitrates, samplesPerFrame, sideInfo = mp3Bitrates[1], 576, 17
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+	}
+	if header[3]>>6 == 3 { // Mono
+		if version == 3 {
+			sideInfo = 17
+		} else {
+			sideInfo = 9
+		}
+	}
+	frameStart := offset + int64(frame)
+
+	// VBR files say how many frames they have
+	xing := make([]byte, 12)
+	if readFull(file, xing, frameStart+4+int64(sideInfo)) && (string(xing[:4]) == "Xing" || string(xing[:4]) == "Info") && xing[7]&1 != 0 {
+		frames := binary.BigEndian.Uint32(xing[8:12])
+		return float64(frames) * float64(samplesPerFrame) / float64(sampleRate), true
+	}
+	vbri := make([]byte, 18)
+	if readFull(file, vbri, frameStart+4+32) && string(vbri[:4]) == "VBRI" {
+		frames := binary.BigEndian.Uint32(vbri[14:18])
+		return float64(frames) * float64(samplesPerFrame) / float64(sampleRate), true
+	}
+	bitrate := bitrates[header[2]>>4] * 1000
+	return float64(size-frameStart) * 8 / float64(bitrate), true
+}
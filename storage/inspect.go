@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+)
+
+// What an uploaded file turned out to be
+type Metadata struct {
+	Size     int64
+	Width    *int
+	Height   *int
+	Duration *float64 // Seconds, for audio and video
+	Checksum string   // Hex sha256 of the content
+	MimeType string   // Sniffed from the content
+}
+
+// Reads the content of a file uploaded as the content type. It's spooled to a temporary
+// file on the way, since probing some containers means seeking around.
+func Inspect(content io.Reader, contentType string) (Metadata, error) {
+	spool, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), content)
+	if err != nil {
+		return Metadata{}, err
+	}
+	metadata := Metadata{Size: size, Checksum: hex.EncodeToString(hash.Sum(nil))}
+
+	head := make([]byte, 512)
+	n, _ := spool.ReadAt(head, 0)
+	metadata.MimeType = http.DetectContentType(head[:n])
+	if mimeType, _, err := mime.ParseMediaType(metadata.MimeType); err == nil {
+		metadata.MimeType = mimeType
+	}
+
+	switch utils.MediaTypes[contentType].Kind {
+	case choices.MKIMAGE:
+		if config, _, err := image.DecodeConfig(io.NewSectionReader(spool, 0, size)); err == nil {
+			metadata.Width, metadata.Height = &config.Width, &config.Height
+		}
+	case choices.MKVIDEO, choices.MKAUDIO:
+		metadata.Duration = probeDuration(spool, size, contentType)
+	}
+	return metadata, nil
+}
+
+// Whether sniffed content can be what the client said it uploaded
+func MatchesType(sniffed string, declared string) bool {
+	mediaType := utils.MediaTypes[declared]
+	if sniffed == declared {
+		return true
+	}
+	for _, alias := range mediaType.SniffedAs {
+		if sniffed == alias {
+			return true
+		}
+	}
+	if mediaType.Sniffable {
+		return false
+	}
+	switch sniffed {
+	case "application/octet-stream", "text/plain", "text/xml":
+		return true
+	}
+	return false
+}
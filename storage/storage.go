@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kayprogrammer/socialnet-v6/config"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/pborman/uuid"
+)
+
+// Folder every key lives under, so the app can share a bucket or cloud account
+const baseFolder = "socialnet-v6/"
+
+// Storage keeps the uploaded files. Clients never send file content through the API:
+// they upload and download straight from the backend with presigned requests.
+type Storage interface {
+	Name() string
+	// Request the client sends the file's content with
+	PresignUpload(key string, contentType string) UploadData
+	// URL the file can be fetched from
+	PresignDownload(key string, contentType string) string
+	// Content of the file, or ErrNotFound if nothing was uploaded under the key
+	Open(key string) (io.ReadCloser, error)
+	// Removes the file. Deleting a file that doesn't exist isn't an error
+	Delete(key string) error
+}
+
+var ErrNotFound = errors.New("file not found")
+
+// Client for backends reached over http
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Opens the body of a GET request to the url, mapping a 404 to ErrNotFound
+func openUrl(url string) (io.ReadCloser, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("unexpected status fetching file: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// UploadData tells a client how to upload a file. Either post the file as "file" in a multipart
+// form along with the fields, or send it as the raw body along with the headers.
+type UploadData struct {
+	Method    string            `json:"method" example:"PUT"`
+	Url       string            `json:"url" example:"https://bucket.s3.amazonaws.com/socialnet-v6/posts/f47ac10b-58cc-4372-a567-0e02b2c3d479.jpg?X-Amz-Signature=..."`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+var (
+	cfg      config.Config
+	backends map[string]Storage
+	loadOnce sync.Once
+)
+
+func load() {
+	cfg = config.GetConfig()
+	backends = map[string]Storage{
+		"cloudinary": NewCloudinaryStorage(cfg),
+		"local":      NewLocalStorage(cfg),
+		"s3":         NewS3Storage(cfg),
+	}
+	if backends[cfg.StorageBackend] == nil {
+		log.Fatal("Unknown storage backend: ", cfg.StorageBackend)
+	}
+}
+
+// Backend new files are uploaded to, as set in the config
+func Default() Storage {
+	loadOnce.Do(load)
+	return backends[cfg.StorageBackend]
+}
+
+// Backend with the given name. Files stay where they were uploaded even after the config changes
+func Get(name string) Storage {
+	loadOnce.Do(load)
+	if backend, ok := backends[name]; ok {
+		return backend
+	}
+	return backends[cfg.StorageBackend]
+}
+
+func Local() *LocalStorage {
+	return Get("local").(*LocalStorage)
+}
+
+// Key for a new file in the folder (e.g "posts")
+func NewKey(folder string, contentType string) string {
+	return Key(folder, uuid.New(), contentType)
+}
+
+func Key(folder string, name string, contentType string) string {
+	return fmt.Sprintf("%s%s/%s.%s", baseFolder, folder, name, utils.MediaTypes[contentType].Extension)
+}
+
+func urlExpiry() time.Duration {
+	return time.Duration(cfg.StorageUrlExpireMinutes) * time.Minute
+}
+
+// Largest file of the type that can be uploaded, in bytes
+func MaxSize(contentType string) int64 {
+	loadOnce.Do(load)
+	sizeMB := cfg.MaxImageSizeMB
+	switch utils.MediaTypes[contentType].Kind {
+	case choices.MKVIDEO:
+		sizeMB = cfg.MaxVideoSizeMB
+	case choices.MKAUDIO:
+		sizeMB = cfg.MaxAudioSizeMB
+	case choices.MKDOCUMENT:
+		sizeMB = cfg.MaxDocumentSizeMB
+	}
+	return sizeMB * 1024 * 1024
+}
+
+// Largest file of any type
+func MaxUploadSize() int64 {
+	maxSize := int64(0)
+	for contentType := range utils.MediaTypes {
+		if size := MaxSize(contentType); size > maxSize {
+			maxSize = size
+		}
+	}
+	return maxSize
+}
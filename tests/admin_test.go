@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/database"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func updateSiteDetail(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	superuser := CreateTestVerifiedUser(db)
+	token := AccessToken(db)
+	t.Run("Update Site Detail", func(t *testing.T) {
+		url := fmt.Sprintf("%s/site-detail", baseUrl)
+		name := "SocialNet V6"
+
+		// Test for valid response for non-superusers
+		res := ProcessTestBody(t, app, url, "PATCH", schemas.SiteDetailUpdateSchema{Name: &name}, token)
+		assert.Equal(t, 403, res.StatusCode)
+
+		// Test for valid response for invalid entry
+		db.Model(&superuser).Updates(models.User{IsStaff: true, IsSuperuser: true})
+		invalidUrl := "not-a-url"
+		res = ProcessTestBody(t, app, url, "PATCH", schemas.SiteDetailUpdateSchema{Fb: &invalidUrl}, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Test for valid response for valid entry
+		res = ProcessTestBody(t, app, url, "PATCH", schemas.SiteDetailUpdateSchema{Name: &name}, token)
+		assert.Equal(t, 200, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, name, body["data"].(map[string]interface{})["name"])
+		assert.Equal(t, "kayprogrammer1@gmail.com", body["data"].(map[string]interface{})["email"])
+	})
+}
+
+func manageUsers(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	superuser := CreateTestVerifiedUser(db)
+	user := CreateAnotherTestVerifiedUser(db)
+	token := AccessToken(db)
+	userToken := AnotherAccessToken(db)
+	t.Run("Manage Users", func(t *testing.T) {
+		url := fmt.Sprintf("%s/users", baseUrl)
+
+		// Test for valid response for searching and filtering users
+		req := httptest.NewRequest("GET", url+"?search=anothertest&is_staff=false", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ := app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		users := body["data"].(map[string]interface{})["users"].([]interface{})
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, user.Username, users[0].(map[string]interface{})["username"])
+		assert.Equal(t, true, users[0].(map[string]interface{})["is_email_verified"])
+
+		// Test for valid response for managing one's own account
+		userUrl := fmt.Sprintf("%s/%s", url, user.Username)
+		isTrue, isFalse := true, false
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/%s", url, superuser.Username), "PATCH", schemas.AdminUserUpdateSchema{IsStaff: &isFalse}, token)
+		assert.Equal(t, 400, res.StatusCode)
+
+		// Test for valid response for unverifying and granting staff
+		res = ProcessTestBody(t, app, userUrl, "PATCH", schemas.AdminUserUpdateSchema{IsEmailVerified: &isFalse, IsStaff: &isTrue}, token)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		data := body["data"].(map[string]interface{})
+		assert.Equal(t, false, data["is_email_verified"])
+		assert.Equal(t, true, data["is_staff"])
+
+		// Test for valid response for suspending. The user is logged out
+		res = ProcessTestBody(t, app, userUrl, "PATCH", schemas.AdminUserUpdateSchema{IsEmailVerified: &isTrue, IsSuspended: &isTrue}, token)
+		assert.Equal(t, 200, res.StatusCode)
+		req = httptest.NewRequest("GET", "/api/v6/profiles/friends", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", userToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Test for valid response for suspending a superuser
+		db.Model(&user).Update("is_superuser", true)
+		res = ProcessTestBody(t, app, userUrl, "PATCH", schemas.AdminUserUpdateSchema{IsSuspended: &isTrue}, token)
+		assert.Equal(t, 403, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_NOT_ALLOWED, body["code"])
+
+		// Test for valid response for reactivating and logging out
+		res = ProcessTestBody(t, app, userUrl, "PATCH", schemas.AdminUserUpdateSchema{IsSuspended: &isFalse}, token)
+		assert.Equal(t, 200, res.StatusCode)
+		userToken = AnotherAccessToken(db)
+		res = ProcessTestBody(t, app, userUrl+"/logout", "POST", nil, token)
+		assert.Equal(t, 200, res.StatusCode)
+		req = httptest.NewRequest("GET", "/api/v6/profiles/friends", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", userToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Every change was recorded
+		var count int64
+		db.Model(&models.AuditLog{}).Where("target_user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(6), count)
+	})
+}
+
+func sendNotifications(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	staff := CreateTestVerifiedUser(db)
+	user := CreateAnotherTestVerifiedUser(db)
+	city := CreateCity(db)
+	token := AccessToken(db)
+	t.Run("Send Admin Notifications", func(t *testing.T) {
+		url := fmt.Sprintf("%s/notifications", baseUrl)
+		text := "A new update is coming!"
+		db.Model(&staff).Update("is_staff", true)
+		db.Model(&user).Update("city_id", city.ID)
+
+		// Test for valid response for a missing audience value
+		res := ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NACITY}, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Test for valid response for unknown usernames
+		res = ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NAUSERS, Usernames: []string{"invalid_username"}}, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Test for valid response for everyone
+		res = ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NAALL}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		data := body["data"].(map[string]interface{})
+		assert.Equal(t, text, data["message"])
+		assert.Equal(t, "ADMIN", data["ntype"])
+		assert.Equal(t, float64(2), data["receivers_count"])
+
+		// Test for valid response for a city
+		res = ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NACITY, CityID: &city.ID}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, float64(1), body["data"].(map[string]interface{})["receivers_count"])
+
+		// The receiver gets it in their notifications
+		var count int64
+		db.Table("notification_receivers").Where("user_id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(2), count)
+
+		// Test for valid response for everyone and a city with the user deactivated. They're left out
+		db.Model(&user).Update("deactivated_at", time.Now())
+		res = ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NAALL}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, float64(1), body["data"].(map[string]interface{})["receivers_count"])
+		res = ProcessTestBody(t, app, url, "POST", schemas.AdminNotificationSchema{Text: text, Audience: choices.NACITY, CityID: &city.ID}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, float64(0), body["data"].(map[string]interface{})["receivers_count"])
+		db.Model(&user).Update("deactivated_at", nil)
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	os.Setenv("ENVIRONMENT", "TESTING")
+	app := fiber.New()
+	db := Setup(t, app)
+	BASEURL := "/api/v6/admin"
+
+	// Run Admin Endpoint Tests
+	updateSiteDetail(t, app, db, BASEURL)
+	manageUsers(t, app, db, BASEURL)
+	sendNotifications(t, app, db, BASEURL)
+
+	// Drop Tables and Close Connectiom
+	database.DropTables(db)
+	CloseTestDatabase(db)
+}
@@ -6,10 +6,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/kayprogrammer/socialnet-v6/config"
 	"github.com/kayprogrammer/socialnet-v6/database"
 	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/ratelimit"
 	"github.com/kayprogrammer/socialnet-v6/routes"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
@@ -85,6 +89,19 @@ func verifyEmail(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		db.Take(&realOtp, realOtp)
 		db.Save(&realOtp) // Create or save
 		emailOtpData.Otp = realOtp.Code
+
+		// Verify that the otp stops working after too many attempts, even with the right code
+		db.Model(&realOtp).UpdateColumn("attempts", config.GetConfig(true).OtpMaxAttempts)
+		res = ProcessTestBody(t, app, url, "POST", emailOtpData)
+		assert.Equal(t, 400, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_LOCKED_OTP, body["code"])
+		assert.Equal(t, "Too many incorrect attempts. Request a new otp", body["message"])
+
+		// A new otp works again
+		db.Save(&realOtp)
+		emailOtpData.Otp = realOtp.Code
 		res = ProcessTestBody(t, app, url, "POST", emailOtpData)
 		assert.Equal(t, 200, res.StatusCode)
 
@@ -273,14 +290,156 @@ func login(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		body = ParseResponseBody(t, res.Body).(map[string]interface{})
 		assert.Equal(t, "success", body["status"])
 		assert.Equal(t, "Login successful", body["message"])
-		db.Take(&user, user.ID) // Get updated user 
-		expectedData := map[string]string{
-			"access":  *user.Access,
-			"refresh": *user.Refresh,
+		dataRep := body["data"].(map[string]interface{})
+		assert.NotEmpty(t, dataRep["access"])
+		assert.NotEmpty(t, dataRep["refresh"])
+
+		// Verify that a session holding the refresh token was created
+		session := models.Session{}
+		db.Where(models.Session{UserId: user.ID}).Take(&session)
+		assert.Equal(t, utils.HashToken(dataRep["refresh"].(string)), session.RefreshHash)
+
+		// Test for account lockout after repeated bad passwords
+		correctPassword := loginData.Password
+		loginData.Password = "wrongpassword"
+		for i := 0; i < config.GetConfig(true).LoginMaxAttempts; i++ {
+			res = ProcessTestBody(t, app, url, "POST", loginData)
+			assert.Equal(t, 401, res.StatusCode)
 		}
-		data, _ := json.Marshal(body["data"])
-		expectedDataJson, _ := json.Marshal(expectedData)
-		assert.Equal(t, expectedDataJson, data)
+		loginData.Password = correctPassword
+		res = ProcessTestBody(t, app, url, "POST", loginData)
+		assert.Equal(t, 429, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get("Retry-After"))
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_LOCKED_ACCOUNT, body["code"])
+
+		// Test for a successful login once the lockout is over
+		db.Model(&user).UpdateColumn("locked_until", time.Now())
+		res = ProcessTestBody(t, app, url, "POST", loginData)
+		assert.Equal(t, 201, res.StatusCode)
+		db.Take(&user, user.ID)
+		assert.Equal(t, 0, user.FailedLogins)
+		assert.Nil(t, user.LockedUntil)
+	})
+}
+
+func twoFactorAuth(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	t.Run("Two Factor Auth", func(t *testing.T) {
+		user := CreateTestVerifiedUser(db)
+		_, token, _ := CreateSession(db, user)
+
+		// Test for the setup
+		res := ProcessTestBody(t, app, fmt.Sprintf("%s/2fa/setup", baseUrl), "POST", nil, token)
+		assert.Equal(t, 200, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "success", body["status"])
+		assert.Equal(t, "Two-factor authentication setup started", body["message"])
+		setupData := body["data"].(map[string]interface{})
+		secret := setupData["secret"].(string)
+		assert.Contains(t, setupData["otpauth_uri"], "otpauth://totp/")
+
+		// Test for activation with an incorrect code
+		activateUrl := fmt.Sprintf("%s/2fa/activate", baseUrl)
+		codeData := schemas.TwoFactorCodeSchema{Code: "abcdef"}
+		res = ProcessTestBody(t, app, activateUrl, "POST", codeData, token)
+		assert.Equal(t, 400, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_INCORRECT_OTP, body["code"])
+		assert.Equal(t, "Incorrect authentication code", body["message"])
+
+		// Test for activation with a code from the authenticator
+		step := utils.TotpStep(time.Now())
+		codeData.Code = utils.TotpCode(secret, step)
+		res = ProcessTestBody(t, app, activateUrl, "POST", codeData, token)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Two-factor authentication enabled", body["message"])
+		recoveryCodes := body["data"].(map[string]interface{})["recovery_codes"].([]interface{})
+		assert.Equal(t, 10, len(recoveryCodes))
+
+		// Verify that login now asks for a challenge to be completed
+		loginData := schemas.LoginSchema{Email: user.Email, Password: "testpassword"}
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/login", baseUrl), "POST", loginData)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Two-factor authentication required", body["message"])
+		challenge := body["data"].(map[string]interface{})["challenge"].(string)
+
+		// Test for an invalid challenge
+		loginTwoFactorUrl := fmt.Sprintf("%s/login/2fa", baseUrl)
+		twoFactorData := schemas.TwoFactorLoginSchema{Challenge: token, TwoFactorCodeSchema: schemas.TwoFactorCodeSchema{Code: "abcdef"}}
+		res = ProcessTestBody(t, app, loginTwoFactorUrl, "POST", twoFactorData)
+		assert.Equal(t, 401, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_INVALID_TOKEN, body["code"])
+		assert.Equal(t, "Challenge token is invalid or expired", body["message"])
+
+		// Test for an incorrect code
+		twoFactorData.Challenge = challenge
+		res = ProcessTestBody(t, app, loginTwoFactorUrl, "POST", twoFactorData)
+		assert.Equal(t, 401, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_INCORRECT_OTP, body["code"])
+
+		// Verify that the code used for activation can't be replayed
+		twoFactorData.Code = utils.TotpCode(secret, step)
+		res = ProcessTestBody(t, app, loginTwoFactorUrl, "POST", twoFactorData)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Test for a login with a recovery code, which only works once
+		twoFactorData.Code = recoveryCodes[0].(string)
+		res = ProcessTestBody(t, app, loginTwoFactorUrl, "POST", twoFactorData)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Login successful", body["message"])
+		assert.NotEmpty(t, body["data"].(map[string]interface{})["access"])
+		res = ProcessTestBody(t, app, loginTwoFactorUrl, "POST", twoFactorData)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Test for guessing codes to disable. Failures count toward the lockout
+		codeData.Code = "abcdef"
+		for i := 0; i < config.GetConfig(true).LoginMaxAttempts; i++ {
+			res = ProcessTestBody(t, app, fmt.Sprintf("%s/2fa/disable", baseUrl), "POST", codeData, token)
+			assert.Equal(t, 400, res.StatusCode)
+		}
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/2fa/disable", baseUrl), "POST", codeData, token)
+		assert.Equal(t, 429, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_LOCKED_ACCOUNT, body["code"])
+		db.Model(&user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+
+		// Test for disabling with the next code from the authenticator
+		codeData.Code = utils.TotpCode(secret, step+1)
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/2fa/disable", baseUrl), "POST", codeData, token)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Two-factor authentication disabled", body["message"])
+		db.Take(&user, user.ID)
+		assert.False(t, user.TotpEnabled)
+		assert.Nil(t, user.TotpSecret)
+	})
+}
+
+func rateLimitAuth(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	t.Run("Rate Limit Auth", func(t *testing.T) {
+		url := fmt.Sprintf("%s/send-password-reset-otp", baseUrl)
+		emailData := schemas.EmailRequestSchema{Email: "throttled@example.com"}
+
+		// Hits within the per-account limit go through to the endpoint
+		for i := 0; i < 3; i++ {
+			res := ProcessTestBody(t, app, url, "POST", emailData)
+			assert.Equal(t, 404, res.StatusCode)
+		}
+
+		// Test for the request past the limit
+		res := ProcessTestBody(t, app, url, "POST", emailData)
+		assert.Equal(t, 429, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get("Retry-After"))
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_TOO_MANY_REQUESTS, body["code"])
+		assert.Equal(t, "Too many requests. Try again later", body["message"])
 	})
 }
 
@@ -307,12 +466,8 @@ func refresh(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		assert.Equal(t, "Refresh token is invalid or expired", body["message"])
 
 		// Test for valid refresh token
-		access := "whatever"
-		refresh := routes.GenerateRefreshToken()
-		user.Access = &access
-		user.Refresh = &refresh
-		db.Save(&user)
-		refreshTokenData.Refresh = *user.Refresh
+		session, _, refresh := CreateSession(db, user)
+		refreshTokenData.Refresh = refresh
 		res = ProcessTestBody(t, app, url, "POST", refreshTokenData)
 		// Assert response
 		assert.Equal(t, 201, res.StatusCode)
@@ -320,14 +475,29 @@ func refresh(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		body = ParseResponseBody(t, res.Body).(map[string]interface{})
 		assert.Equal(t, "success", body["status"])
 		assert.Equal(t, "Tokens refresh successful", body["message"])
-		db.Take(&user, user.ID) // Get updated user 
-		expectedData := map[string]string{
-			"access":  *user.Access,
-			"refresh": *user.Refresh,
-		}
-		data, _ := json.Marshal(body["data"])
-		expectedDataJson, _ := json.Marshal(expectedData)
-		assert.Equal(t, expectedDataJson, data)
+		dataRep := body["data"].(map[string]interface{})
+		assert.NotEmpty(t, dataRep["access"])
+		newRefresh := dataRep["refresh"].(string)
+		assert.NotEqual(t, refresh, newRefresh)
+		db.Take(&session, session.ID) // Get updated session
+		assert.Equal(t, utils.HashToken(newRefresh), session.RefreshHash)
+
+		// Test for reuse of an already rotated refresh token
+		res = ProcessTestBody(t, app, url, "POST", refreshTokenData)
+		// Assert Status code
+		assert.Equal(t, 401, res.StatusCode)
+		// Parse and assert body
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_INVALID_TOKEN, body["code"])
+		assert.Equal(t, "Refresh token has already been used. Session revoked", body["message"])
+
+		// Verify that the whole session was revoked, including the latest token
+		refreshTokenData.Refresh = newRefresh
+		res = ProcessTestBody(t, app, url, "POST", refreshTokenData)
+		assert.Equal(t, 401, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Refresh token is invalid or expired", body["message"])
 	})
 }
 
@@ -365,6 +535,123 @@ func logout(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	})
 }
 
+func getSessions(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	// Drop Session Data since the previous tests create sessions for the verified_user...
+	DropAndCreateSingleTable(db, models.Session{})
+	user := CreateTestVerifiedUser(db)
+	session, access, _ := CreateSession(db, user)
+	t.Run("Retrieve Sessions", func(t *testing.T) {
+		url := fmt.Sprintf("%s/sessions", baseUrl)
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", access))
+		res, _ := app.Test(req)
+
+		// Assert Status code
+		assert.Equal(t, 200, res.StatusCode)
+
+		// Parse and assert body
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "success", body["status"])
+		assert.Equal(t, "Sessions fetched", body["message"])
+		sessions := body["data"].([]interface{})
+		assert.Equal(t, 1, len(sessions))
+		sessionRep := sessions[0].(map[string]interface{})
+		expectedData := map[string]interface{}{
+			"id":           session.ID.String(),
+			"device_name":  session.DeviceName,
+			"ip_address":   session.IPAddress,
+			"user_agent":   session.UserAgent,
+			"is_current":   true,
+			"last_used_at": sessionRep["last_used_at"],
+			"created_at":   sessionRep["created_at"],
+			"updated_at":   sessionRep["updated_at"],
+		}
+		data, _ := json.Marshal(sessionRep)
+		expectedDataJson, _ := json.Marshal(expectedData)
+		assert.JSONEq(t, string(expectedDataJson), string(data))
+	})
+}
+
+func revokeSession(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	user := CreateTestVerifiedUser(db)
+	_, access, _ := CreateSession(db, user)
+	otherSession, otherAccess, _ := CreateSession(db, user)
+	t.Run("Revoke Session", func(t *testing.T) {
+		// Test for non-existent session
+		url := fmt.Sprintf("%s/sessions/%s", baseUrl, uuid.New())
+		req := httptest.NewRequest("DELETE", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", access))
+		res, _ := app.Test(req)
+
+		// Assert Status code
+		assert.Equal(t, 404, res.StatusCode)
+
+		// Parse and assert body
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_NON_EXISTENT, body["code"])
+		assert.Equal(t, "Session does not exist", body["message"])
+
+		// Test for valid session
+		url = fmt.Sprintf("%s/sessions/%s", baseUrl, otherSession.ID)
+		req = httptest.NewRequest("DELETE", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", access))
+		res, _ = app.Test(req)
+
+		// Assert Status code
+		assert.Equal(t, 200, res.StatusCode)
+
+		// Parse and assert body
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "success", body["status"])
+		assert.Equal(t, "Session revoked", body["message"])
+
+		// Verify that the revoked session's access token no longer works
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/sessions", baseUrl), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", otherAccess))
+		res, _ = app.Test(req)
+		assert.Equal(t, 401, res.StatusCode)
+	})
+}
+
+func rateLimitBehindProxy(t *testing.T) {
+	t.Run("Rate Limit Behind A Proxy", func(t *testing.T) {
+		// Requests of app.Test come from 0.0.0.0, which stands in for the proxy
+		newApp := func(trustedProxies string) *fiber.App {
+			app := fiber.New(routes.ProxyConfig(config.Config{ProxyHeader: "X-Real-IP", TrustedProxies: trustedProxies}, fiber.Config{}))
+			endpoint := routes.Endpoint{RateLimiter: ratelimit.NewMemoryStore()}
+			app.Get("/limited", endpoint.RateLimitMiddleware("limited", 2, 2, time.Minute), func(c *fiber.Ctx) error {
+				return c.SendStatus(200)
+			})
+			return app
+		}
+		request := func(app *fiber.App, clientIP string) int {
+			req := httptest.NewRequest("GET", "/limited", nil)
+			req.Header.Set("X-Real-IP", clientIP)
+			res, _ := app.Test(req)
+			return res.StatusCode
+		}
+
+		// Verify that each client behind a trusted proxy gets its own limit
+		app := newApp("0.0.0.0, 10.0.0.0/8")
+		assert.Equal(t, 200, request(app, "203.0.113.1"))
+		assert.Equal(t, 200, request(app, "203.0.113.1"))
+		assert.Equal(t, 429, request(app, "203.0.113.1"))
+		assert.Equal(t, 200, request(app, "203.0.113.2"))
+
+		// Verify that the header is ignored from anyone else, so it can't be used to dodge the limit
+		app = newApp("10.0.0.1")
+		assert.Equal(t, 200, request(app, "203.0.113.1"))
+		assert.Equal(t, 200, request(app, "203.0.113.2"))
+		assert.Equal(t, 429, request(app, "203.0.113.3"))
+	})
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	os.Setenv("ENVIRONMENT", "TESTING")
+	rateLimitBehindProxy(t)
+}
+
 func TestAuth(t *testing.T) {
 	os.Setenv("ENVIRONMENT", "TESTING")
 	app := fiber.New()
@@ -380,6 +667,10 @@ func TestAuth(t *testing.T) {
 	login(t, app, db, BASEURL)
 	logout(t, app, db, BASEURL)
 	refresh(t, app, db, BASEURL)
+	getSessions(t, app, db, BASEURL)
+	revokeSession(t, app, db, BASEURL)
+	twoFactorAuth(t, app, db, BASEURL)
+	rateLimitAuth(t, app, db, BASEURL)
 
 	// Drop Tables and Close Connectiom
 	database.DropTables(db)
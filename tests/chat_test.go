@@ -6,9 +6,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/kayprogrammer/socialnet-v6/database"
+	"github.com/kayprogrammer/socialnet-v6/managers"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
@@ -19,11 +21,15 @@ import (
 )
 
 func getChats(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
-	CreateChat(db)
+	chat := CreateChat(db)
+	recipient := chat.UserObjs[0]
+	text := "Are you there?"
+	message := messageManager.Create(db, recipient, chat, &text, nil)
+	token := AccessToken(db)
 	t.Run("Retrieve Chats", func(t *testing.T) {
 		url := baseUrl
 		req := httptest.NewRequest("GET", url, nil)
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", AccessToken(db)))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 		res, _ := app.Test(req)
 
 		// Assert Status code
@@ -35,6 +41,19 @@ func getChats(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		assert.Equal(t, "Chats fetched", body["message"])
 		data, _ := json.Marshal(body["data"])
 		assert.Equal(t, true, (len(data) > 0))
+
+		// The recipient's message hasn't been read yet
+		chats := body["data"].(map[string]interface{})["chats"].([]interface{})
+		assert.Equal(t, float64(1), chats[0].(map[string]interface{})["unread_count"])
+
+		// Test for the unread count after a read receipt
+		messageReceiptManager.Acknowledge(db, chat.OwnerObj, message, true)
+		req = httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		chats = body["data"].(map[string]interface{})["chats"].([]interface{})
+		assert.Equal(t, float64(0), chats[0].(map[string]interface{})["unread_count"])
 	})
 }
 
@@ -122,6 +141,9 @@ func getChatMessages(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 		data, _ := json.Marshal(body)
 		ownerData := GetUserMap(owner)
 		recipientUser := chat.UserObjs[0]
+		recipientData := GetUserMap(recipientUser)
+		recipientData["is_online"] = false
+		recipientData["last_seen_at"] = nil
 
 		expectedData := map[string]interface{}{
 			"status":  "success",
@@ -146,6 +168,8 @@ func getChatMessages(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 					"per_page":     400,
 					"current_page": 1,
 					"last_page":    1,
+					"next_cursor":  nil,
+					"prev_cursor":  nil,
 					"items": []map[string]interface{}{
 						{
 							"id":         message.ID,
@@ -159,7 +183,7 @@ func getChatMessages(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 					},
 				},
 				"users": []map[string]interface{}{
-					GetUserMap(recipientUser),
+					recipientData,
 				},
 			},
 		}
@@ -406,6 +430,24 @@ func createGroupChat(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 	})
 }
 
+func dropExpiredPresence(t *testing.T, db *gorm.DB) {
+	user := CreateTestVerifiedUser(db)
+	presenceManager := managers.PresenceManager{}
+	t.Run("Drop Expired Presence", func(t *testing.T) {
+		// Two sockets make the user online, and closing one keeps them so
+		assert.True(t, presenceManager.Connect(db, &user))
+		assert.False(t, presenceManager.Connect(db, &user))
+		assert.False(t, presenceManager.Disconnect(db, &user))
+		assert.True(t, user.IsOnline())
+
+		// Sockets of an instance that went silent expire, leaving the user offline
+		assert.Equal(t, 0, presenceManager.DropExpired(db, time.Hour))
+		assert.Equal(t, 1, presenceManager.DropExpired(db, 0))
+		db.Take(&user, user.ID)
+		assert.False(t, user.IsOnline())
+	})
+}
+
 func TestChat(t *testing.T) {
 	os.Setenv("ENVIRONMENT", "TESTING")
 	app := fiber.New()
@@ -421,6 +463,7 @@ func TestChat(t *testing.T) {
 	updateMessage(t, app, db, BASEURL)
 	deleteMessage(t, app, db, BASEURL)
 	createGroupChat(t, app, db, BASEURL)
+	dropExpiredPresence(t, db)
 
 	// Drop Tables and Close Connectiom
 	database.DropTables(db)
@@ -10,17 +10,21 @@ import (
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/routes"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
 	"gorm.io/gorm"
 )
 
 var (
-	notificationManager = managers.NotificationManager{}
-	chatManager         = managers.ChatManager{}
-	messageManager      = managers.MessageManager{}
-	postManager         = managers.PostManager{}
-	reactionManager     = managers.ReactionManager{}
-	commentManager      = managers.CommentManager{}
-	replyManager        = managers.ReplyManager{}
+	notificationManager   = managers.NotificationManager{}
+	chatManager           = managers.ChatManager{}
+	messageManager        = managers.MessageManager{}
+	messageReceiptManager = managers.MessageReceiptManager{}
+	postManager           = managers.PostManager{}
+	reactionManager       = managers.ReactionManager{}
+	commentManager        = managers.CommentManager{}
+	sessionManager        = managers.SessionManager{}
+	fileManager           = managers.FileManager{}
+	accountManager        = managers.AccountManager{}
 )
 
 // AUTH FIXTURES
@@ -60,25 +64,25 @@ func CreateAnotherTestVerifiedUser(db *gorm.DB) models.User {
 	return user
 }
 
-func CreateJwt(db *gorm.DB, user models.User) models.User {
-	access := routes.GenerateAccessToken(user.ID, user.Username)
-	refresh := routes.GenerateRefreshToken()
-	user.Access = &access
-	user.Refresh = &refresh
-	db.Save(&user)
-	return user
+func CreateSession(db *gorm.DB, user models.User) (models.Session, string, string) {
+	session := sessionManager.Create(db, user, "Test device", "0.0.0.0", "Test agent")
+	access := routes.GenerateAccessToken(user.ID, user.Username, session.ID)
+	refresh := routes.GenerateRefreshToken(session.ID)
+	session.RefreshHash = utils.HashToken(refresh)
+	db.Save(&session)
+	return session, access, refresh
 }
 
 func AccessToken(db *gorm.DB) string {
 	user := CreateTestVerifiedUser(db)
-	user = CreateJwt(db, user)
-	return *user.Access
+	_, access, _ := CreateSession(db, user)
+	return access
 }
 
 func AnotherAccessToken(db *gorm.DB) string {
 	user := CreateAnotherTestVerifiedUser(db)
-	user = CreateJwt(db, user)
-	return *user.Access
+	_, access, _ := CreateSession(db, user)
+	return access
 }
 
 // ----------------------------------------------------------------------------
@@ -110,7 +114,7 @@ func CreateFriend(db *gorm.DB, status choices.FriendStatusChoice) models.Friend
 func CreateNotification(db *gorm.DB) models.Notification {
 	user := CreateTestVerifiedUser(db)
 	text := "A new update is coming!"
-	notification := notificationManager.Create(db, nil, "ADMIN", []models.User{user}, nil, nil, nil, &text)
+	notification := notificationManager.Create(db, nil, "ADMIN", []models.User{user}, nil, nil, &text)
 	return notification
 }
 
@@ -159,7 +163,7 @@ func CreatePost(db *gorm.DB) models.Post {
 
 func CreateReaction(db *gorm.DB) models.Reaction {
 	post := CreatePost(db)
-	reaction := reactionManager.Create(db, post.AuthorObj, choices.FTPOST, &post, nil, nil, choices.RLIKE)
+	reaction := reactionManager.Create(db, post.AuthorObj, choices.FTPOST, &post, nil, choices.RLIKE)
 	return reaction
 }
 
@@ -169,9 +173,9 @@ func CreateComment(db *gorm.DB) models.Comment {
 	return comment
 }
 
-func CreateReply(db *gorm.DB) models.Reply {
+func CreateReply(db *gorm.DB) models.Comment {
 	comment := CreateComment(db)
-	reply := replyManager.Create(db, comment.AuthorObj, comment, "Simple reply")
+	reply := commentManager.CreateReply(db, comment.AuthorObj, comment, "Simple reply")
 	return reply
 }
 
@@ -186,6 +190,14 @@ func GetUserMap(user models.User) map[string]interface{} {
 	}
 }
 
+func EmptyReactionsBreakdown() map[choices.ReactionChoice]int {
+	breakdown := map[choices.ReactionChoice]int{}
+	for _, rtype := range choices.ReactionChoices {
+		breakdown[rtype] = 0
+	}
+	return breakdown
+}
+
 func ConvertDateTime(timeObj time.Time) string {
 	roundedTime := timeObj.Round(time.Microsecond)
 	formatted := roundedTime.Format("2006-01-02T15:04:05")
@@ -1,15 +1,27 @@
 package tests
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/kayprogrammer/socialnet-v6/config"
 	"github.com/kayprogrammer/socialnet-v6/database"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/stretchr/testify/assert"
@@ -38,20 +50,134 @@ func getPosts(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 				"per_page":     50,
 				"current_page": 1,
 				"last_page":    1,
+				"next_cursor":  nil,
+				"prev_cursor":  nil,
 				"posts": []map[string]interface{}{
 					{
-						"author":          GetUserMap(user),
-						"text":            post.Text,
-						"slug":            post.Slug,
-						"reactions_count": 0,
-						"comments_count":  0,
-						"image":           nil,
+						"author":              GetUserMap(user),
+						"text":                post.Text,
+						"slug":                post.Slug,
+						"reactions_count":     0,
+						"reactions_breakdown": EmptyReactionsBreakdown(),
+						"my_reaction":         nil,
+						"comments_count":      0,
+						"reposts_count":       0,
+						"original_post":       nil,
+						"is_quote":            false,
+						"is_bookmarked":       false,
+						"visibility":          "PUBLIC",
+						"media":               []interface{}{},
 					},
 				},
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
 		assert.JSONEq(t, string(expectedDataJson), string(data))
+
+		// Test for invalid cursor
+		req = httptest.NewRequest("GET", url+"?cursor=invalid_cursor", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 400, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_INVALID_PAGE, body["code"])
+		assert.Equal(t, "Invalid cursor", body["message"])
+	})
+
+	t.Run("Paginate Posts With Cursors", func(t *testing.T) {
+		url := fmt.Sprintf("%s/posts", baseUrl)
+		// 119 older posts in groups of 7 that share a created_at, so ties fall across page boundaries
+		createdAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+		posts := []models.Post{}
+		for i := 0; i < 119; i++ {
+			slug := fmt.Sprintf("paginated-post-%d", i)
+			posts = append(posts, models.Post{FeedAbstract: models.FeedAbstract{
+				BaseModel: models.BaseModel{CreatedAt: createdAt.Add(-time.Duration(i/7) * time.Minute)},
+				AuthorID:  user.ID, Text: slug, Slug: slug,
+			}})
+		}
+		db.Create(&posts)
+		expectedSlugs := []string{}
+		db.Model(&models.Post{}).Order("created_at DESC, id DESC").Pluck("slug", &expectedSlugs)
+		assert.Equal(t, 120, len(expectedSlugs))
+
+		fetch := func(query string) ([]string, interface{}, interface{}) {
+			req := httptest.NewRequest("GET", url+query, nil)
+			res, _ := app.Test(req)
+			assert.Equal(t, 200, res.StatusCode)
+			data := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+			slugs := []string{}
+			for _, post := range data["posts"].([]interface{}) {
+				slugs = append(slugs, post.(map[string]interface{})["slug"].(string))
+			}
+			return slugs, data["next_cursor"], data["prev_cursor"]
+		}
+
+		// Follow next_cursor to the end. Pages join up in order, with nothing repeated or skipped
+		firstPage, next, prev := fetch("")
+		assert.Nil(t, prev)
+		secondPage, next, prev := fetch(fmt.Sprintf("?cursor=%s", next))
+		assert.NotNil(t, prev)
+		lastPage, next, prev := fetch(fmt.Sprintf("?cursor=%s", next))
+		assert.Nil(t, next)
+		assert.Equal(t, 50, len(firstPage))
+		assert.Equal(t, 50, len(secondPage))
+		assert.Equal(t, 20, len(lastPage))
+		assert.Equal(t, expectedSlugs, append(append(append([]string{}, firstPage...), secondPage...), lastPage...))
+
+		// Follow prev_cursor back to the start. The same pages come back
+		page, next, prev := fetch(fmt.Sprintf("?cursor=%s", prev))
+		assert.Equal(t, secondPage, page)
+		assert.NotNil(t, next)
+		page, next, prev = fetch(fmt.Sprintf("?cursor=%s", prev))
+		assert.Equal(t, firstPage, page)
+		assert.NotNil(t, next)
+		assert.Nil(t, prev)
+
+		db.Delete(&posts)
+	})
+}
+
+func getTimeline(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	friendPost := CreatePost(db)
+	user := CreateAnotherTestVerifiedUser(db)
+	post := postManager.Create(db, user, schemas.PostInputSchema{Text: "My timeline post"})
+	token := AnotherAccessToken(db)
+	t.Run("Retrieve Timeline", func(t *testing.T) {
+		url := fmt.Sprintf("%s/timeline", baseUrl)
+
+		// Verify that only the user's posts are returned when they have no friends
+		CreateFriend(db, choices.FPENDING)
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ := app.Test(req)
+
+		// Assert Status code
+		assert.Equal(t, 200, res.StatusCode)
+
+		// Parse and assert body
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "success", body["status"])
+		assert.Equal(t, "Timeline fetched", body["message"])
+		posts := body["data"].(map[string]interface{})["posts"].([]interface{})
+		assert.Equal(t, 1, len(posts))
+		assert.Equal(t, post.Slug, posts[0].(map[string]interface{})["slug"])
+
+		// Verify that friends' posts are included, ranked by recency and engagement
+		CreateFriend(db, choices.FACCEPTED)
+		req = httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		posts = body["data"].(map[string]interface{})["posts"].([]interface{})
+		assert.Greater(t, len(posts), 1)
+		assert.Equal(t, post.Slug, posts[0].(map[string]interface{})["slug"])
+		slugs := []interface{}{}
+		for _, item := range posts {
+			slugs = append(slugs, item.(map[string]interface{})["slug"])
+		}
+		assert.Contains(t, slugs, friendPost.Slug)
 	})
 }
 
@@ -73,14 +199,21 @@ func createPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Post created",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(sender),
-				"text":            postData.Text,
-				"slug":            dataRep["slug"],
-				"reactions_count": 0,
-				"comments_count":  0,
-				"created_at":      dataRep["created_at"],
-				"updated_at":      dataRep["updated_at"],
-				"image":           nil,
+				"author":              GetUserMap(sender),
+				"text":                postData.Text,
+				"slug":                dataRep["slug"],
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"comments_count":      0,
+				"reposts_count":       0,
+				"original_post":       nil,
+				"is_quote":            false,
+				"is_bookmarked":       false,
+				"visibility":          "PUBLIC",
+				"created_at":          dataRep["created_at"],
+				"updated_at":          dataRep["updated_at"],
+				"media":               []interface{}{},
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -88,6 +221,116 @@ func createPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	})
 }
 
+func uploadPostImage(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	user := CreateTestVerifiedUser(db)
+	token := AccessToken(db)
+	t.Run("Upload Post Image", func(t *testing.T) {
+		fileType := "image/png"
+		postData := schemas.PostInputSchema{Text: "My new Post with image", FileTypes: []string{fileType}}
+		res := ProcessTestBody(t, app, fmt.Sprintf("%s/posts", baseUrl), "POST", postData, token)
+		assert.Equal(t, 201, res.StatusCode)
+		dataRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		mediaRep := dataRep["media"].([]interface{})[0].(map[string]interface{})
+		assert.Nil(t, mediaRep["url"]) // No url till the upload is completed
+		uploadData := mediaRep["file_upload_data"].(map[string]interface{})
+		assert.Equal(t, "PUT", uploadData["method"])
+		uploadUrl, _ := url.Parse(uploadData["url"].(string))
+		completeUrl := fmt.Sprintf("/api/v6/media/files/%s/complete", uploadData["file_id"])
+		upload := func(content []byte, uri string) int {
+			req := httptest.NewRequest("PUT", uri, bytes.NewReader(content))
+			req.Header.Set("Content-Type", fileType)
+			res, _ := app.Test(req)
+			return res.StatusCode
+		}
+
+		// Verify that completing before uploading fails
+		res = ProcessTestBody(t, app, completeUrl, "POST", nil, token)
+		assert.Equal(t, 400, res.StatusCode)
+
+		// Verify that only the uploader can complete it
+		CreateAnotherTestVerifiedUser(db)
+		res = ProcessTestBody(t, app, completeUrl, "POST", nil, AnotherAccessToken(db))
+		assert.Equal(t, 404, res.StatusCode)
+
+		// Verify that a tampered url is rejected
+		assert.Equal(t, 403, upload([]byte("content"), uploadUrl.Path+"?expires=1&signature=invalid"))
+
+		// Verify that content of another type fails the file
+		assert.Equal(t, 200, upload([]byte("not an image"), uploadUrl.RequestURI()))
+		res = ProcessTestBody(t, app, completeUrl, "POST", nil, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Upload with the presigned request and complete it
+		var content bytes.Buffer
+		png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 2, 3)))
+		assert.Equal(t, 200, upload(content.Bytes(), uploadUrl.RequestURI()))
+		res = ProcessTestBody(t, app, completeUrl, "POST", nil, token)
+		assert.Equal(t, 200, res.StatusCode)
+		fileRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		checksum := sha256.Sum256(content.Bytes())
+		assert.Equal(t, "READY", fileRep["status"])
+		assert.Equal(t, "image/png", fileRep["mime_type"])
+		assert.Equal(t, float64(content.Len()), fileRep["size"])
+		assert.Equal(t, float64(2), fileRep["width"])
+		assert.Equal(t, float64(3), fileRep["height"])
+		assert.Equal(t, hex.EncodeToString(checksum[:]), fileRep["checksum"])
+		assert.Equal(t, "IMAGE", fileRep["media_kind"])
+
+		// Verify that the file is served from the post media's url
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/posts/%s", baseUrl, dataRep["slug"]), "GET", nil)
+		postRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		mediaRep = postRep["media"].([]interface{})[0].(map[string]interface{})
+		imageUrl, _ := url.Parse(mediaRep["url"].(string))
+		res, _ = app.Test(httptest.NewRequest("GET", imageUrl.RequestURI(), nil))
+		assert.Equal(t, 200, res.StatusCode)
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, content.Bytes(), body)
+		assert.Equal(t, "IMAGE", mediaRep["media_kind"])
+	})
+
+	t.Run("Upload Post Audio", func(t *testing.T) {
+		fileType := "audio/wav"
+		postData := schemas.PostInputSchema{Text: "My new Post with a voice note", FileTypes: []string{fileType}}
+		res := ProcessTestBody(t, app, fmt.Sprintf("%s/posts", baseUrl), "POST", postData, token)
+		assert.Equal(t, 201, res.StatusCode)
+		dataRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		uploadData := dataRep["media"].([]interface{})[0].(map[string]interface{})["file_upload_data"].(map[string]interface{})
+		uploadUrl, _ := url.Parse(uploadData["url"].(string))
+
+		// Two seconds of silence at 8000 bytes a second
+		var content bytes.Buffer
+		content.WriteString("RIFF")
+		binary.Write(&content, binary.LittleEndian, uint32(36+16000))
+		content.WriteString("WAVEfmt ")
+		binary.Write(&content, binary.LittleEndian, []uint32{16, 1<<16 | 1, 8000, 8000, 8<<16 | 1})
+		content.WriteString("data")
+		binary.Write(&content, binary.LittleEndian, uint32(16000))
+		content.Write(make([]byte, 16000))
+
+		req := httptest.NewRequest("PUT", uploadUrl.RequestURI(), bytes.NewReader(content.Bytes()))
+		req.Header.Set("Content-Type", fileType)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		res = ProcessTestBody(t, app, fmt.Sprintf("/api/v6/media/files/%s/complete", uploadData["file_id"]), "POST", nil, token)
+		assert.Equal(t, 200, res.StatusCode)
+		fileRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, "AUDIO", fileRep["media_kind"])
+		assert.Equal(t, float64(2), fileRep["duration"])
+		assert.Nil(t, fileRep["width"])
+	})
+
+	t.Run("Delete Abandoned Uploads", func(t *testing.T) {
+		file := models.NewFile("posts", "image/png", user.ID)
+		db.Create(&file)
+		db.Model(&file).UpdateColumn("updated_at", time.Now().Add(-3*time.Hour))
+		assert.Equal(t, 1, fileManager.DeletePending(db, 2*time.Hour))
+
+		var count int64
+		db.Model(&models.File{}).Where("id = ?", file.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
+
 func getPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	post := CreatePost(db)
 	user := post.AuthorObj
@@ -122,14 +365,21 @@ func getPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Post Detail fetched",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"text":            post.Text,
-				"slug":            post.Slug,
-				"reactions_count": 0,
-				"comments_count":  0,
-				"image":           nil,
-				"created_at":      dataRep["created_at"],
-				"updated_at":      dataRep["updated_at"],
+				"author":              GetUserMap(user),
+				"text":                post.Text,
+				"slug":                post.Slug,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"comments_count":      0,
+				"reposts_count":       0,
+				"original_post":       nil,
+				"is_quote":            false,
+				"is_bookmarked":       false,
+				"visibility":          "PUBLIC",
+				"media":               []interface{}{},
+				"created_at":          dataRep["created_at"],
+				"updated_at":          dataRep["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -142,7 +392,7 @@ func updatePost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	user := post.AuthorObj
 	token := AccessToken(db)
 	t.Run("Update Post", func(t *testing.T) {
-		postData := schemas.PostInputSchema{Text: "Post Text Updated"}
+		postData := schemas.PostUpdateSchema{PostInputSchema: schemas.PostInputSchema{Text: "Post Text Updated"}}
 
 		// Check if endpoint fails for invalid post
 		url := fmt.Sprintf("%s/posts/invalid_slug", baseUrl)
@@ -179,14 +429,21 @@ func updatePost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Post updated",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"text":            postData.Text,
-				"slug":            dataRep["slug"],
-				"reactions_count": 0,
-				"comments_count":  0,
-				"created_at":      dataRep["created_at"],
-				"updated_at":      dataRep["updated_at"],
-				"image":           nil,
+				"author":              GetUserMap(user),
+				"text":                postData.Text,
+				"slug":                dataRep["slug"],
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"comments_count":      0,
+				"reposts_count":       0,
+				"original_post":       nil,
+				"is_quote":            false,
+				"is_bookmarked":       false,
+				"visibility":          "PUBLIC",
+				"created_at":          dataRep["created_at"],
+				"updated_at":          dataRep["updated_at"],
+				"media":               []interface{}{},
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -194,6 +451,52 @@ func updatePost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	})
 }
 
+func updatePostMedia(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	user := CreateTestVerifiedUser(db)
+	token := AccessToken(db)
+	t.Run("Update Post Media", func(t *testing.T) {
+		post := postManager.Create(db, user, schemas.PostInputSchema{Text: "My album", FileTypes: []string{"image/png", "video/mp4", "image/jpeg"}})
+		first, second, third := post.MediaObjs[0], post.MediaObjs[1], post.MediaObjs[2]
+		url := fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug)
+
+		// Check if endpoint fails for a media of another post
+		postData := schemas.PostUpdateSchema{PostInputSchema: schemas.PostInputSchema{Text: post.Text}, MediaIDs: &[]string{third.ID.String(), third.ID.String()}}
+		res := ProcessTestBody(t, app, url, "PUT", postData, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Check if endpoint fails for too many media
+		fileTypes := make([]string, 10)
+		for i := range fileTypes {
+			fileTypes[i] = "image/png"
+		}
+		postData = schemas.PostUpdateSchema{PostInputSchema: schemas.PostInputSchema{Text: post.Text, FileTypes: fileTypes}}
+		res = ProcessTestBody(t, app, url, "PUT", postData, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Reorder, remove one and add another
+		postData = schemas.PostUpdateSchema{
+			PostInputSchema: schemas.PostInputSchema{Text: post.Text, FileTypes: []string{"audio/mpeg"}},
+			MediaIDs:        &[]string{third.ID.String(), first.ID.String()},
+		}
+		res = ProcessTestBody(t, app, url, "PUT", postData, token)
+		assert.Equal(t, 200, res.StatusCode)
+		mediaRep := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})["media"].([]interface{})
+		assert.Equal(t, 3, len(mediaRep))
+		assert.Equal(t, third.ID.String(), mediaRep[0].(map[string]interface{})["id"])
+		assert.Equal(t, first.ID.String(), mediaRep[1].(map[string]interface{})["id"])
+		assert.Equal(t, "AUDIO", mediaRep[2].(map[string]interface{})["media_kind"])
+
+		// Verify that the kept media weren't recreated and the removed one is gone with its file
+		var fileIDs []string
+		db.Model(&models.PostMedia{}).Where("post_id = ?", post.ID).Order("position").Pluck("file_id", &fileIDs)
+		assert.Equal(t, third.FileID.String(), fileIDs[0])
+		assert.Equal(t, first.FileID.String(), fileIDs[1])
+		var count int64
+		db.Model(&models.File{}).Where("id = ?", second.FileID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
+
 func deletePost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	post := CreatePost(db)
 	token := AccessToken(db)
@@ -283,6 +586,8 @@ func getReactions(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 				"per_page":     50,
 				"current_page": 1,
 				"last_page":    1,
+				"next_cursor":  nil,
+				"prev_cursor":  nil,
 				"reactions": []map[string]interface{}{
 					{
 						"id":    reaction.ID,
@@ -405,13 +710,17 @@ func getComments(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 				"per_page":     50,
 				"current_page": 1,
 				"last_page":    1,
+				"next_cursor":  nil,
+				"prev_cursor":  nil,
 				"comments": []map[string]interface{}{
 					{
-						"author":          GetUserMap(user),
-						"slug":            comment.Slug,
-						"text":            comment.Text,
-						"reactions_count": 0,
-						"replies_count":   0,
+						"author":              GetUserMap(user),
+						"slug":                comment.Slug,
+						"text":                comment.Text,
+						"reactions_count":     0,
+						"reactions_breakdown": EmptyReactionsBreakdown(),
+						"my_reaction":         nil,
+						"replies_count":       0,
 					},
 				},
 			},
@@ -440,13 +749,15 @@ func createComment(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Comment created",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"slug":            body["data"].(map[string]interface{})["slug"],
-				"text":            commentData.Text,
-				"reactions_count": 0,
-				"replies_count":   0,
-				"created_at":      dataMap["created_at"],
-				"updated_at":      dataMap["updated_at"],
+				"author":              GetUserMap(user),
+				"slug":                body["data"].(map[string]interface{})["slug"],
+				"text":                commentData.Text,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"replies_count":       0,
+				"created_at":          dataMap["created_at"],
+				"updated_at":          dataMap["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -456,7 +767,7 @@ func createComment(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 
 func getCommentWithReplies(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	reply := CreateReply(db)
-	comment := reply.CommentObj
+	comment := *reply.ParentObj
 	user := GetUserMap(reply.AuthorObj)
 	t.Run("Retrieve Comment With Replies", func(t *testing.T) {
 		// Test for comment slug
@@ -486,6 +797,9 @@ func getCommentWithReplies(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl st
 		commentMap := dataMap["comment"].(map[string]interface{})
 		repliesMap := dataMap["replies"].(map[string]interface{})
 		repliesItems := repliesMap["items"].([]interface{})
+		if !assert.Equal(t, 1, len(repliesItems)) {
+			return
+		}
 		replyItemMap := repliesItems[0].(map[string]interface{})
 
 		data, _ := json.Marshal(body)
@@ -494,26 +808,34 @@ func getCommentWithReplies(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl st
 			"message": "Comment with replies fetched",
 			"data": map[string]interface{}{
 				"comment": map[string]interface{}{
-					"author":          user,
-					"slug":            comment.Slug,
-					"text":            comment.Text,
-					"reactions_count": 0,
-					"replies_count":   1,
-					"created_at":      commentMap["created_at"],
-					"updated_at":      commentMap["updated_at"],
+					"author":              user,
+					"slug":                comment.Slug,
+					"text":                comment.Text,
+					"reactions_count":     0,
+					"reactions_breakdown": EmptyReactionsBreakdown(),
+					"my_reaction":         nil,
+					"replies_count":       1,
+					"created_at":          commentMap["created_at"],
+					"updated_at":          commentMap["updated_at"],
 				},
 				"replies": map[string]interface{}{
 					"per_page":     50,
 					"current_page": 1,
 					"last_page":    1,
+					"next_cursor":  nil,
+					"prev_cursor":  nil,
 					"items": []map[string]interface{}{
 						{
-							"author":          user,
-							"slug":            reply.Slug,
-							"text":            reply.Text,
-							"reactions_count": 0,
-							"created_at":      replyItemMap["created_at"],
-							"updated_at":      replyItemMap["updated_at"],
+							"author":              user,
+							"slug":                reply.Slug,
+							"text":                reply.Text,
+							"reactions_count":     0,
+							"reactions_breakdown": EmptyReactionsBreakdown(),
+							"my_reaction":         nil,
+							"replies_count":       0,
+							"replies":             []interface{}{},
+							"created_at":          replyItemMap["created_at"],
+							"updated_at":          replyItemMap["updated_at"],
 						},
 					},
 				},
@@ -521,6 +843,21 @@ func getCommentWithReplies(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl st
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
 		assert.JSONEq(t, string(expectedDataJson), string(data))
+
+		// Verify that the thread below each reply comes along
+		nestedReply := commentManager.CreateReply(db, reply.AuthorObj, reply, "Nested reply")
+		req = httptest.NewRequest("GET", url, nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		repliesItems = body["data"].(map[string]interface{})["replies"].(map[string]interface{})["items"].([]interface{})
+		if !assert.Equal(t, 1, len(repliesItems)) {
+			return
+		}
+		threadItems := repliesItems[0].(map[string]interface{})["replies"].([]interface{})
+		if assert.Equal(t, 1, len(threadItems)) {
+			assert.Equal(t, nestedReply.Slug, threadItems[0].(map[string]interface{})["slug"])
+		}
 	})
 }
 
@@ -543,12 +880,15 @@ func createReply(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Reply created",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"slug":            body["data"].(map[string]interface{})["slug"],
-				"text":            replyData.Text,
-				"reactions_count": 0,
-				"created_at":      dataMap["created_at"],
-				"updated_at":      dataMap["updated_at"],
+				"author":              GetUserMap(user),
+				"slug":                body["data"].(map[string]interface{})["slug"],
+				"text":                replyData.Text,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"replies_count":       0,
+				"created_at":          dataMap["created_at"],
+				"updated_at":          dataMap["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -556,6 +896,74 @@ func createReply(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	})
 }
 
+func getCommentThread(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	reply := CreateReply(db)
+	comment := *reply.ParentObj
+	nestedReply := commentManager.CreateReply(db, reply.AuthorObj, reply, "Nested reply")
+	token := AccessToken(db)
+	t.Run("Retrieve Comment Thread", func(t *testing.T) {
+		// Nested replies come within their parents
+		url := fmt.Sprintf("%s/comments/%s", baseUrl, comment.Slug)
+		req := httptest.NewRequest("GET", url, nil)
+		res, _ := app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		items := body["data"].(map[string]interface{})["replies"].(map[string]interface{})["items"].([]interface{})
+		replyMap := items[0].(map[string]interface{})
+		assert.Equal(t, reply.Slug, replyMap["slug"])
+		assert.Equal(t, float64(1), replyMap["replies_count"])
+		thread := replyMap["replies"].([]interface{})
+		assert.Equal(t, 1, len(thread))
+		nestedMap := thread[0].(map[string]interface{})
+		assert.Equal(t, nestedReply.Slug, nestedMap["slug"])
+		assert.Equal(t, []interface{}{}, nestedMap["replies"])
+
+		// The tree stops at the given depth
+		req = httptest.NewRequest("GET", url+"?depth=1", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		items = body["data"].(map[string]interface{})["replies"].(map[string]interface{})["items"].([]interface{})
+		replyMap = items[0].(map[string]interface{})
+		assert.Equal(t, float64(1), replyMap["replies_count"])
+		assert.NotContains(t, replyMap, "replies")
+
+		// Nested replies are still replies
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/replies/%s", baseUrl, nestedReply.Slug), nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+
+		// A comment on a post isn't a reply
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/replies/%s", baseUrl, comment.Slug), nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("Reply Depth Limit", func(t *testing.T) {
+		// Replies can be answered
+		url := fmt.Sprintf("%s/comments/%s", baseUrl, nestedReply.Slug)
+		res := ProcessTestBody(t, app, url, "POST", schemas.CommentInputSchema{Text: "Reply to a reply"}, token)
+		assert.Equal(t, 201, res.StatusCode)
+
+		// But not beyond the maximum depth
+		deepest := nestedReply
+		for deepest.Depth < config.GetConfig(true).MaxCommentDepth {
+			deepest = commentManager.CreateReply(db, reply.AuthorObj, deepest, "Deeper reply")
+		}
+		url = fmt.Sprintf("%s/comments/%s", baseUrl, deepest.Slug)
+		res = ProcessTestBody(t, app, url, "POST", schemas.CommentInputSchema{Text: "Too deep"}, token)
+		assert.Equal(t, 403, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_NOT_ALLOWED, body["code"])
+
+		// Deleting a reply takes the replies under it along
+		db.Delete(&reply)
+		var count int64
+		db.Model(&models.Comment{}).Where("path LIKE ?", reply.Path+"%").Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+}
+
 func updateComment(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 	comment := CreateComment(db)
 	user := comment.AuthorObj
@@ -575,13 +983,15 @@ func updateComment(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Comment updated",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"slug":            comment.Slug,
-				"text":            commentData.Text,
-				"reactions_count": 0,
-				"replies_count":   len(comment.Replies),
-				"created_at":      dataMap["created_at"],
-				"updated_at":      dataMap["updated_at"],
+				"author":              GetUserMap(user),
+				"slug":                comment.Slug,
+				"text":                commentData.Text,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"replies_count":       comment.RepliesCount,
+				"created_at":          dataMap["created_at"],
+				"updated_at":          dataMap["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -609,6 +1019,11 @@ func deleteComment(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
 		assert.JSONEq(t, string(expectedDataJson), string(data))
+
+		// Verify that the comment was deleted
+		var count int64
+		db.Model(&models.Comment{}).Where("slug = ?", comment.Slug).Count(&count)
+		assert.Equal(t, int64(0), count)
 	})
 	// You can test for other error responses yourself
 }
@@ -646,12 +1061,15 @@ func getReply(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Reply Fetched",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"slug":            reply.Slug,
-				"text":            reply.Text,
-				"reactions_count": 0,
-				"created_at":      dataMap["created_at"],
-				"updated_at":      dataMap["updated_at"],
+				"author":              GetUserMap(user),
+				"slug":                reply.Slug,
+				"text":                reply.Text,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"replies_count":       0,
+				"created_at":          dataMap["created_at"],
+				"updated_at":          dataMap["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -678,12 +1096,15 @@ func updateReply(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"status":  "success",
 			"message": "Reply updated",
 			"data": map[string]interface{}{
-				"author":          GetUserMap(user),
-				"slug":            reply.Slug,
-				"text":            replyData.Text,
-				"reactions_count": 0,
-				"created_at":      dataMap["created_at"],
-				"updated_at":      dataMap["updated_at"],
+				"author":              GetUserMap(user),
+				"slug":                reply.Slug,
+				"text":                replyData.Text,
+				"reactions_count":     0,
+				"reactions_breakdown": EmptyReactionsBreakdown(),
+				"my_reaction":         nil,
+				"replies_count":       0,
+				"created_at":          dataMap["created_at"],
+				"updated_at":          dataMap["updated_at"],
 			},
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
@@ -712,10 +1133,349 @@ func deleteReply(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		}
 		expectedDataJson, _ := json.Marshal(expectedData)
 		assert.JSONEq(t, string(expectedDataJson), string(data))
+
+		// Verify that the reply was deleted
+		var count int64
+		db.Model(&models.Comment{}).Where("slug = ?", reply.Slug).Count(&count)
+		assert.Equal(t, int64(0), count)
 	})
 	// You can test for other error responses yourself
 }
 
+func hashtagsAndMentions(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	token := AccessToken(db)
+	mentionedUser := CreateAnotherTestVerifiedUser(db)
+	t.Run("Hashtags And Mentions", func(t *testing.T) {
+		postData := schemas.PostUpdateSchema{PostInputSchema: schemas.PostInputSchema{
+			Text: fmt.Sprintf("Loving #GoLang with @%s. #golang all the way", mentionedUser.Username),
+		}}
+		res := ProcessTestBody(t, app, baseUrl+"/posts", "POST", postData.PostInputSchema, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		slug := body["data"].(map[string]interface{})["slug"].(string)
+		post := models.Post{}
+		db.Take(&post, models.Post{FeedAbstract: models.FeedAbstract{Slug: slug}})
+
+		// Repeated tags count once, in lowercase
+		var count int64
+		db.Model(&models.Hashtag{}).Where(models.Hashtag{PostID: &post.ID}).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		// Hashtag feed
+		req := httptest.NewRequest("GET", baseUrl+"/hashtags/GoLang", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		posts := body["data"].(map[string]interface{})["posts"].([]interface{})
+		assert.Equal(t, 1, len(posts))
+		assert.Equal(t, slug, posts[0].(map[string]interface{})["slug"])
+
+		// Trending
+		req = httptest.NewRequest("GET", baseUrl+"/hashtags/trending", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Contains(t, body["data"], map[string]interface{}{"tag": "golang", "count": float64(1)})
+
+		// The mentioned user is notified
+		notification := models.Notification{}
+		db.Take(&notification, models.Notification{Ntype: choices.NMENTION, PostID: &post.ID})
+		assert.NotNil(t, notification.ID)
+		receiverIDs := notificationManager.GetReceiverIDs(db, notification.ID)
+		assert.Equal(t, 1, len(receiverIDs))
+		assert.Equal(t, mentionedUser.ID.String(), receiverIDs[0].String())
+
+		// But only once, and the tags follow the text when the post is edited
+		postData.Text = fmt.Sprintf("Still @%s, now with #rust", mentionedUser.Username)
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/posts/%s", baseUrl, slug), "PUT", postData, token)
+		assert.Equal(t, 200, res.StatusCode)
+		db.Model(&models.Notification{}).Where(models.Notification{Ntype: choices.NMENTION, PostID: &post.ID}).Count(&count)
+		assert.Equal(t, int64(1), count)
+		tags := []string{}
+		db.Model(&models.Hashtag{}).Where(models.Hashtag{PostID: &post.ID}).Pluck("tag", &tags)
+		assert.Equal(t, []string{"rust"}, tags)
+	})
+}
+
+func repostPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	post := CreatePost(db)
+	token := AnotherAccessToken(db)
+	t.Run("Repost A Post", func(t *testing.T) {
+		url := fmt.Sprintf("%s/posts/%s/repost", baseUrl, post.Slug)
+
+		// Plain repost
+		res := ProcessTestBody(t, app, url, "POST", schemas.RepostInputSchema{}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		data := body["data"].(map[string]interface{})
+		assert.Equal(t, "Post reposted", body["message"])
+		assert.Equal(t, false, data["is_quote"])
+		assert.Equal(t, post.Slug, data["original_post"].(map[string]interface{})["slug"])
+		plainSlug := data["slug"].(string)
+
+		// Reposting twice isn't allowed, even through the repost
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/posts/%s/repost", baseUrl, plainSlug), "POST", schemas.RepostInputSchema{}, token)
+		assert.Equal(t, 400, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_NOT_ALLOWED, body["code"])
+		assert.Equal(t, "You have already reposted this post", body["message"])
+
+		// Quote
+		res = ProcessTestBody(t, app, url, "POST", schemas.RepostInputSchema{Text: "So true!"}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		data = body["data"].(map[string]interface{})
+		assert.Equal(t, true, data["is_quote"])
+		assert.Equal(t, "So true!", data["text"])
+		quoteSlug := data["slug"].(string)
+
+		// Both are counted on the original
+		req := httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug), nil)
+		res, _ = app.Test(req)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, float64(2), body["data"].(map[string]interface{})["reposts_count"])
+
+		// The author is notified
+		var count int64
+		db.Model(&models.Notification{}).Where(models.Notification{Ntype: choices.NREPOST}).Count(&count)
+		assert.Equal(t, int64(2), count)
+
+		// Deleting the original takes the plain repost along and keeps the quote
+		db.Delete(&post)
+		db.Model(&models.Post{}).Where(models.Post{FeedAbstract: models.FeedAbstract{Slug: plainSlug}}).Count(&count)
+		assert.Equal(t, int64(0), count)
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, quoteSlug), nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		data = body["data"].(map[string]interface{})
+		assert.Equal(t, true, data["is_quote"])
+		assert.Nil(t, data["original_post"])
+	})
+}
+
+func bookmarkPost(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	post := CreatePost(db)
+	token := AccessToken(db)
+	t.Run("Bookmark A Post", func(t *testing.T) {
+		// Create a collection
+		res := ProcessTestBody(t, app, baseUrl+"/bookmarks/collections", "POST", schemas.CollectionInputSchema{Name: "Favourites"}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		collectionID := body["data"].(map[string]interface{})["id"].(string)
+
+		// Names are unique per user
+		res = ProcessTestBody(t, app, baseUrl+"/bookmarks/collections", "POST", schemas.CollectionInputSchema{Name: "Favourites"}, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Bookmark into the collection
+		url := fmt.Sprintf("%s/posts/%s/bookmark", baseUrl, post.Slug)
+		res = ProcessTestBody(t, app, url, "POST", map[string]string{"collection_id": collectionID}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Post bookmarked", body["message"])
+		assert.Equal(t, true, body["data"].(map[string]interface{})["is_bookmarked"])
+
+		// Listed in the bookmarks and in the collection
+		for _, bookmarksUrl := range []string{baseUrl + "/bookmarks", baseUrl + "/bookmarks?collection_id=" + collectionID} {
+			req := httptest.NewRequest("GET", bookmarksUrl, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			res, _ = app.Test(req)
+			assert.Equal(t, 200, res.StatusCode)
+			body = ParseResponseBody(t, res.Body).(map[string]interface{})
+			posts := body["data"].(map[string]interface{})["posts"].([]interface{})
+			assert.Equal(t, 1, len(posts))
+			assert.Equal(t, post.Slug, posts[0].(map[string]interface{})["slug"])
+		}
+
+		// Counted in the collection
+		req := httptest.NewRequest("GET", baseUrl+"/bookmarks/collections", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		collections := body["data"].([]interface{})
+		assert.Equal(t, 1, len(collections))
+		assert.Equal(t, float64(1), collections[0].(map[string]interface{})["bookmarks_count"])
+
+		// Shown to the user who bookmarked it only
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, true, body["data"].(map[string]interface{})["is_bookmarked"])
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug), nil)
+		res, _ = app.Test(req)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, false, body["data"].(map[string]interface{})["is_bookmarked"])
+
+		// Deleting the collection keeps the bookmark
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("%s/bookmarks/collections/%s", baseUrl, collectionID), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		var count int64
+		db.Model(&models.Bookmark{}).Where(models.Bookmark{PostID: post.ID}).Count(&count)
+		assert.Equal(t, int64(1), count)
+
+		// Remove the bookmark
+		req = httptest.NewRequest("DELETE", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		req = httptest.NewRequest("DELETE", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 404, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "You haven't bookmarked this post", body["message"])
+	})
+}
+
+func viewerReactions(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	comment := CreateComment(db)
+	post := comment.PostObj
+	user := comment.AuthorObj
+	anotherUser := CreateAnotherTestVerifiedUser(db)
+	token := AccessToken(db)
+	reactionManager.Create(db, user, choices.FTPOST, &post, nil, choices.RLOVE)
+	reactionManager.Create(db, anotherUser, choices.FTPOST, &post, nil, choices.RLOVE)
+	reactionManager.Create(db, anotherUser, choices.FTCOMMENT, nil, &comment, choices.RHAHA)
+	t.Run("Viewer Reactions", func(t *testing.T) {
+		breakdown := EmptyReactionsBreakdown()
+		breakdown[choices.RLOVE] = 2
+		expectedBreakdown, _ := json.Marshal(breakdown)
+
+		// The user's reaction and the counts by type
+		req := httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ := app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		data := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, float64(2), data["reactions_count"])
+		assert.Equal(t, "LOVE", data["my_reaction"])
+		breakdownJson, _ := json.Marshal(data["reactions_breakdown"])
+		assert.JSONEq(t, string(expectedBreakdown), string(breakdownJson))
+
+		// Guests get the counts only
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s", baseUrl, post.Slug), nil)
+		res, _ = app.Test(req)
+		data = ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, float64(2), data["reactions_count"])
+		assert.Nil(t, data["my_reaction"])
+
+		// Comments too
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/posts/%s/comments", baseUrl, post.Slug), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		comments := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})["comments"].([]interface{})
+		commentData := comments[0].(map[string]interface{})
+		assert.Equal(t, float64(1), commentData["reactions_count"])
+		assert.Equal(t, float64(1), commentData["reactions_breakdown"].(map[string]interface{})["HAHA"])
+		assert.Nil(t, commentData["my_reaction"])
+	})
+}
+
+func engagementCounters(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	reply := CreateReply(db)
+	comment := models.Comment{}
+	db.Take(&comment, "id = ?", *reply.ParentID)
+	post := models.Post{}
+	db.Take(&post, "id = ?", comment.PostID)
+	reactionManager.Create(db, reply.AuthorObj, choices.FTREPLY, nil, &reply, choices.RLIKE)
+	t.Run("Engagement Counters", func(t *testing.T) {
+		// Kept as comments, replies and reactions are created
+		assert.Equal(t, 1, post.CommentsCount)
+		assert.Equal(t, 1, comment.RepliesCount)
+		db.Take(&reply, "id = ?", reply.ID)
+		assert.Equal(t, 1, reply.ReactionsCount)
+
+		// Drifted counters are recomputed
+		db.Exec("UPDATE posts SET comments_count = 10 WHERE id = ?", post.ID)
+		db.Exec("UPDATE comments SET replies_count = 10, reactions_count = 10")
+		assert.Nil(t, database.ReconcileCounters(db))
+		db.Take(&post, "id = ?", post.ID)
+		db.Take(&comment, "id = ?", comment.ID)
+		db.Take(&reply, "id = ?", reply.ID)
+		assert.Equal(t, 1, post.CommentsCount)
+		assert.Equal(t, 1, comment.RepliesCount)
+		assert.Equal(t, 1, reply.ReactionsCount)
+
+		// And kept as they're deleted
+		db.Delete(&reply)
+		db.Take(&comment, "id = ?", comment.ID)
+		assert.Equal(t, 0, comment.RepliesCount)
+		db.Delete(&comment)
+		db.Take(&post, "id = ?", post.ID)
+		assert.Equal(t, 0, post.CommentsCount)
+	})
+}
+
+func postVisibility(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	anotherUser := CreateAnotherTestVerifiedUser(db)
+	token := AccessToken(db)
+	anotherToken := AnotherAccessToken(db)
+	DropAndCreateSingleTable(db, models.Friend{})
+	t.Run("Post Visibility", func(t *testing.T) {
+		createPost := func(postData schemas.PostInputSchema) map[string]interface{} {
+			res := ProcessTestBody(t, app, baseUrl+"/posts", "POST", postData, token)
+			assert.Equal(t, 201, res.StatusCode)
+			return ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})
+		}
+		getStatus := func(url string, token string) int {
+			req := httptest.NewRequest("GET", url, nil)
+			if token != "" {
+				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			}
+			res, _ := app.Test(req)
+			return res.StatusCode
+		}
+
+		// Only the author sees their ONLY_ME posts
+		slug := createPost(schemas.PostInputSchema{Text: "Just for me", Visibility: choices.PVONLYME})["slug"].(string)
+		postUrl := fmt.Sprintf("%s/posts/%s", baseUrl, slug)
+		assert.Equal(t, 200, getStatus(postUrl, token))
+		assert.Equal(t, 404, getStatus(postUrl, anotherToken))
+		assert.Equal(t, 404, getStatus(postUrl, ""))
+
+		// FRIENDS posts are seen by friends, along with what's on them
+		slug = createPost(schemas.PostInputSchema{Text: "For my friends", Visibility: choices.PVFRIENDS})["slug"].(string)
+		postUrl = fmt.Sprintf("%s/posts/%s", baseUrl, slug)
+		assert.Equal(t, 404, getStatus(postUrl, anotherToken))
+		assert.Equal(t, 404, getStatus(postUrl+"/comments", anotherToken))
+		res := ProcessTestBody(t, app, fmt.Sprintf("%s/reactions/POST/%s", baseUrl, slug), "POST", schemas.ReactionInputSchema{Rtype: choices.RLIKE}, anotherToken)
+		assert.Equal(t, 404, res.StatusCode)
+		CreateFriend(db, choices.FACCEPTED)
+		assert.Equal(t, 200, getStatus(postUrl, anotherToken))
+		assert.Equal(t, 200, getStatus(postUrl+"/comments", anotherToken))
+		assert.Equal(t, 404, getStatus(postUrl, ""))
+
+		// Only public posts can be reposted
+		res = ProcessTestBody(t, app, postUrl+"/repost", "POST", schemas.RepostInputSchema{}, anotherToken)
+		assert.Equal(t, 400, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Only public posts can be reposted", body["message"])
+
+		// CUSTOM posts need an audience, who are the only others to see them
+		res = ProcessTestBody(t, app, baseUrl+"/posts", "POST", schemas.PostInputSchema{Text: "For some", Visibility: choices.PVCUSTOM}, token)
+		assert.Equal(t, 422, res.StatusCode)
+		data := createPost(schemas.PostInputSchema{Text: "For some", Visibility: choices.PVCUSTOM, Audience: &[]string{anotherUser.Username}})
+		assert.Equal(t, 1, len(data["audience"].([]interface{})))
+		postUrl = fmt.Sprintf("%s/posts/%s", baseUrl, data["slug"])
+		assert.Equal(t, 200, getStatus(postUrl, anotherToken))
+		assert.Equal(t, 404, getStatus(postUrl, ""))
+
+		// Guests are only shown public posts
+		req := httptest.NewRequest("GET", baseUrl+"/posts", nil)
+		res, _ = app.Test(req)
+		posts := ParseResponseBody(t, res.Body).(map[string]interface{})["data"].(map[string]interface{})["posts"].([]interface{})
+		for _, post := range posts {
+			assert.Equal(t, "PUBLIC", post.(map[string]interface{})["visibility"])
+		}
+	})
+}
+
 func TestFeed(t *testing.T) {
 	os.Setenv("ENVIRONMENT", "TESTING")
 	app := fiber.New()
@@ -724,22 +1484,32 @@ func TestFeed(t *testing.T) {
 
 	// Run Feed Endpoint Tests
 	getPosts(t, app, db, BASEURL)
+	getTimeline(t, app, db, BASEURL)
 	createPost(t, app, db, BASEURL)
+	uploadPostImage(t, app, db, BASEURL)
 	getPost(t, app, db, BASEURL)
 	updatePost(t, app, db, BASEURL)
+	updatePostMedia(t, app, db, BASEURL)
 	deletePost(t, app, db, BASEURL)
+	repostPost(t, app, db, BASEURL)
+	bookmarkPost(t, app, db, BASEURL)
 	getReactions(t, app, db, BASEURL)
 	createReaction(t, app, db, BASEURL)
 	deleteReaction(t, app, db, BASEURL)
+	viewerReactions(t, app, db, BASEURL)
 	getComments(t, app, db, BASEURL)
 	createComment(t, app, db, BASEURL)
 	getCommentWithReplies(t, app, db, BASEURL)
 	createReply(t, app, db, BASEURL)
+	getCommentThread(t, app, db, BASEURL)
 	updateComment(t, app, db, BASEURL)
 	deleteComment(t, app, db, BASEURL)
 	getReply(t, app, db, BASEURL)
 	updateReply(t, app, db, BASEURL)
 	deleteReply(t, app, db, BASEURL)
+	hashtagsAndMentions(t, app, db, BASEURL)
+	engagementCounters(t, app, db, BASEURL)
+	postVisibility(t, app, db, BASEURL)
 
 	// Drop Tables and Close Connectiom
 	database.DropTables(db)
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/database"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/models/choices"
+	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func createReport(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	post := CreatePost(db)
+	token := AccessToken(db)
+	otherToken := AnotherAccessToken(db)
+	t.Run("Create Report", func(t *testing.T) {
+		url := fmt.Sprintf("%s/reports/POST/%s", baseUrl, post.Slug)
+		data := schemas.ReportInputSchema{Reason: choices.RRSPAM}
+
+		// Test for valid response for invalid target
+		res := ProcessTestBody(t, app, fmt.Sprintf("%s/reports/INVALID/%s", baseUrl, post.Slug), "POST", data, otherToken)
+		assert.Equal(t, 404, res.StatusCode)
+
+		// Test for valid response for invalid reason
+		res = ProcessTestBody(t, app, url, "POST", schemas.ReportInputSchema{Reason: "INVALID"}, otherToken)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Test for valid response for reporting one's own post
+		res = ProcessTestBody(t, app, url, "POST", data, token)
+		assert.Equal(t, 400, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "You can't report your own content", body["message"])
+
+		// Test for valid response for valid entry
+		res = ProcessTestBody(t, app, url, "POST", data, otherToken)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Report submitted", body["message"])
+
+		// Test for valid response for reporting again while the report is open
+		res = ProcessTestBody(t, app, url, "POST", data, otherToken)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "You have already reported this", body["message"])
+	})
+}
+
+func moderateReports(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	user := CreateTestVerifiedUser(db)
+	staff := CreateAnotherTestVerifiedUser(db)
+	token := AccessToken(db)
+	staffToken := AnotherAccessToken(db)
+	report := models.Report{}
+	db.Take(&report, models.Report{Target: choices.RTPOST})
+	t.Run("Moderate Reports", func(t *testing.T) {
+		url := fmt.Sprintf("%s/admin/reports", baseUrl)
+
+		// Test for valid response for non-staff
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", staffToken))
+		res, _ := app.Test(req)
+		assert.Equal(t, 403, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_NOT_ALLOWED, body["code"])
+
+		// Test for valid response for staff
+		db.Model(&staff).Update("is_staff", true)
+		req = httptest.NewRequest("GET", url+"?status=PENDING", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", staffToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		reports := body["data"].(map[string]interface{})["reports"].([]interface{})
+		assert.Equal(t, 1, len(reports))
+		assert.Equal(t, GetUserMap(user), reports[0].(map[string]interface{})["offender"])
+
+		// Test for valid response for triaging
+		reportUrl := fmt.Sprintf("%s/%s", url, report.ID)
+		res = ProcessTestBody(t, app, reportUrl+"/triage", "POST", nil, staffToken)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "REVIEWING", body["data"].(map[string]interface{})["status"])
+
+		// Test for valid response for hiding the content. It's then seen by no one
+		res = ProcessTestBody(t, app, reportUrl+"/resolve", "POST", schemas.ReportActionSchema{Action: choices.RAHIDE}, staffToken)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "RESOLVED", body["data"].(map[string]interface{})["status"])
+		post := models.Post{}
+		db.Take(&post, report.PostID)
+		req = httptest.NewRequest("GET", fmt.Sprintf("%s/feed/posts/%s", baseUrl, post.Slug), nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 404, res.StatusCode)
+
+		// Test for valid response for closing a closed report
+		res = ProcessTestBody(t, app, reportUrl+"/resolve", "POST", schemas.ReportActionSchema{Action: choices.RADISMISS}, staffToken)
+		assert.Equal(t, 400, res.StatusCode)
+
+		// Test for valid response for suspending. The user is logged out
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/reports/PROFILE/%s", baseUrl, user.Username), "POST", schemas.ReportInputSchema{Reason: choices.RRIMPERSONATION}, staffToken)
+		assert.Equal(t, 201, res.StatusCode)
+		profileReport := models.Report{}
+		db.Take(&profileReport, models.Report{Target: choices.RTPROFILE})
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/%s/resolve", url, profileReport.ID), "POST", schemas.ReportActionSchema{Action: choices.RAHIDE}, staffToken)
+		assert.Equal(t, 422, res.StatusCode)
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/%s/resolve", url, profileReport.ID), "POST", schemas.ReportActionSchema{Action: choices.RASUSPEND}, staffToken)
+		assert.Equal(t, 200, res.StatusCode)
+		req = httptest.NewRequest("GET", baseUrl+"/profiles/friends", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Test for valid response for retrieving audit logs
+		req = httptest.NewRequest("GET", baseUrl+"/admin/audit-logs", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", staffToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		auditLogs := body["data"].(map[string]interface{})["audit_logs"].([]interface{})
+		assert.Equal(t, 3, len(auditLogs))
+		assert.Equal(t, string(choices.AAUSERSUSPENDED), auditLogs[0].(map[string]interface{})["action"])
+
+		// Test for valid response for acting on a report against oneself
+		selfReport := models.Report{ReporterID: user.ID, OffenderID: staff.ID, Target: choices.RTPROFILE, Reason: choices.RRSPAM}
+		db.Create(&selfReport)
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/%s/resolve", url, selfReport.ID), "POST", schemas.ReportActionSchema{Action: choices.RADISMISS}, staffToken)
+		assert.Equal(t, 403, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "You can't act on a report against yourself", body["message"])
+
+		// Test for valid response for suspending a superuser, even as one
+		db.Model(&staff).Update("is_superuser", true)
+		db.Model(&user).Update("is_superuser", true)
+		superuserReport := models.Report{ReporterID: staff.ID, OffenderID: user.ID, Target: choices.RTPROFILE, Reason: choices.RRSPAM}
+		db.Create(&superuserReport)
+		res = ProcessTestBody(t, app, fmt.Sprintf("%s/%s/resolve", url, superuserReport.ID), "POST", schemas.ReportActionSchema{Action: choices.RASUSPEND}, staffToken)
+		assert.Equal(t, 403, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Superusers can't be suspended", body["message"])
+	})
+}
+
+func TestModeration(t *testing.T) {
+	os.Setenv("ENVIRONMENT", "TESTING")
+	app := fiber.New()
+	db := Setup(t, app)
+	BASEURL := "/api/v6"
+
+	// Run Moderation Endpoint Tests
+	createReport(t, app, db, BASEURL)
+	moderateReports(t, app, db, BASEURL)
+
+	// Drop Tables and Close Connectiom
+	database.DropTables(db)
+	CloseTestDatabase(db)
+}
@@ -1,9 +1,11 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http/httptest"
+	neturl "net/url"
 	"os"
 	"testing"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/kayprogrammer/socialnet-v6/models"
 	"github.com/kayprogrammer/socialnet-v6/models/choices"
 	"github.com/kayprogrammer/socialnet-v6/schemas"
+	"github.com/kayprogrammer/socialnet-v6/storage"
 	"github.com/kayprogrammer/socialnet-v6/utils"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/assert"
@@ -104,6 +107,30 @@ func updateProfile(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		body := ParseResponseBody(t, res.Body).(map[string]interface{})
 		assert.Equal(t, "success", body["status"])
 		assert.Equal(t, "User updated", body["message"])
+
+		// Test for replacing the avatar. The replaced upload is deleted from storage
+		fileType := "image/png"
+		updateProfileData.FileType = &fileType
+		res = ProcessTestBody(t, app, url, "PATCH", updateProfileData, AccessToken(db))
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		uploadData := body["data"].(map[string]interface{})["file_upload_data"].(map[string]interface{})
+		uploadUrl, _ := neturl.Parse(uploadData["url"].(string))
+		req := httptest.NewRequest("PUT", uploadUrl.RequestURI(), bytes.NewReader([]byte("avatar")))
+		req.Header.Set("Content-Type", fileType)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		oldAvatar := models.File{}
+		db.Take(&oldAvatar, "id = ?", uploadData["file_id"])
+		content, err := storage.Get(oldAvatar.Backend).Open(oldAvatar.Key)
+		if assert.Nil(t, err) {
+			content.Close()
+		}
+
+		res = ProcessTestBody(t, app, url, "PATCH", updateProfileData, AccessToken(db))
+		assert.Equal(t, 200, res.StatusCode)
+		_, err = storage.Get(oldAvatar.Backend).Open(oldAvatar.Key)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
 	})
 }
 
@@ -135,6 +162,28 @@ func deleteProfile(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 		body = ParseResponseBody(t, res.Body).(map[string]interface{})
 		assert.Equal(t, "success", body["status"])
 		assert.Equal(t, "User deleted", body["message"])
+
+		// The account is only deactivated, and its sessions are gone
+		user := CreateTestVerifiedUser(db)
+		assert.NotNil(t, user.DeactivatedAt)
+		res = ProcessTestBody(t, app, url, "POST", userData, token)
+		assert.Equal(t, 401, res.StatusCode)
+
+		// Test for valid response for logging in within the grace period. The account is restored
+		loginData := schemas.LoginSchema{Email: user.Email, Password: "testpassword"}
+		res = ProcessTestBody(t, app, "/api/v6/auth/login", "POST", loginData)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Login successful. Your account has been restored", body["message"])
+		db.Take(&user, user.ID)
+		assert.Nil(t, user.DeactivatedAt)
+
+		// The account is purged once the grace period is over
+		accountManager.Deactivate(db, &user)
+		assert.Equal(t, 1, accountManager.PurgeDeactivated(db, 0))
+		var count int64
+		db.Model(&models.User{}).Where("id = ?", user.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
 	})
 }
 
@@ -164,6 +213,8 @@ func getFriends(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
 			"per_page":     20,
 			"current_page": 1,
 			"last_page":    1,
+			"next_cursor":  nil,
+			"prev_cursor":  nil,
 			"users": []map[string]interface{}{
 				{
 					"first_name": requestee.FirstName,
@@ -269,6 +320,8 @@ func getNotifications(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 				"per_page":     50,
 				"current_page": 1,
 				"last_page":    1,
+				"next_cursor":  nil,
+				"prev_cursor":  nil,
 				"notifications": []map[string]interface{}{
 					{
 						"id":           notification.ID,
@@ -278,6 +331,7 @@ func getNotifications(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 						"post_slug":    nil,
 						"comment_slug": nil,
 						"reply_slug":   nil,
+						"chat_id":      nil,
 						"is_read":      false,
 					},
 				},
@@ -319,6 +373,78 @@ func readNotification(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string)
 		assert.Equal(t, "Notification read", body["message"])
 	})
 }
+func blockUser(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	friend := CreateFriend(db, choices.FACCEPTED)
+	user, otherUser := friend.Requester, friend.Requestee
+	token := AccessToken(db)
+	otherToken := AnotherAccessToken(db)
+	t.Run("Block And Mute User", func(t *testing.T) {
+		url := fmt.Sprintf("%s/blocks", baseUrl)
+
+		// Test for valid response for blocking oneself
+		res := ProcessTestBody(t, app, url, "POST", schemas.BlockUserSchema{Username: user.Username}, token)
+		assert.Equal(t, 422, res.StatusCode)
+
+		// Test for valid response for valid entry. Blocking ends the friendship
+		res = ProcessTestBody(t, app, url, "POST", schemas.BlockUserSchema{Username: otherUser.Username}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "User blocked", body["message"])
+		var count int64
+		db.Model(&models.Friend{}).Count(&count)
+		assert.Equal(t, int64(0), count)
+
+		// The blocked user can't find the user's profile or send them a friend request
+		req := httptest.NewRequest("GET", fmt.Sprintf("%s/profile/%s", baseUrl, user.Username), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", otherToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 404, res.StatusCode)
+		res = ProcessTestBody(t, app, baseUrl+"/friends/requests", "POST", schemas.SendFriendRequestSchema{Username: user.Username}, otherToken)
+		assert.Equal(t, 403, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_NOT_ALLOWED, body["code"])
+		assert.Equal(t, "You can't interact with this user", body["message"])
+
+		// Test for valid response for retrieving blocked users
+		req = httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		users := body["data"].(map[string]interface{})["users"].([]interface{})
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, otherUser.Username, users[0].(map[string]interface{})["username"])
+
+		// Test for valid response for unblocking
+		unblockUrl := fmt.Sprintf("%s/%s", url, otherUser.Username)
+		req = httptest.NewRequest("DELETE", unblockUrl, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		req = httptest.NewRequest("DELETE", unblockUrl, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 404, res.StatusCode)
+
+		// Test for valid response for muting and unmuting
+		res = ProcessTestBody(t, app, url, "POST", schemas.BlockUserSchema{Username: otherUser.Username, Mute: true}, token)
+		assert.Equal(t, 201, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "User muted", body["message"])
+		req = httptest.NewRequest("GET", url+"?muted=true", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, 1, len(body["data"].(map[string]interface{})["users"].([]interface{})))
+		req = httptest.NewRequest("DELETE", unblockUrl+"?muted=true", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "User unmuted", body["message"])
+	})
+}
+
 func TestProfiles(t *testing.T) {
 	os.Setenv("ENVIRONMENT", "TESTING")
 	app := fiber.New()
@@ -333,6 +459,7 @@ func TestProfiles(t *testing.T) {
 	getFriends(t, app, db, BASEURL)
 	sendFriendRequest(t, app, db, BASEURL)
 	acceptOrRejectFriendRequest(t, app, db, BASEURL)
+	blockUser(t, app, db, BASEURL)
 	getNotifications(t, app, db, BASEURL)
 	readNotification(t, app, db, BASEURL)
 
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/kayprogrammer/socialnet-v6/database"
+	"github.com/kayprogrammer/socialnet-v6/models"
+	"github.com/kayprogrammer/socialnet-v6/utils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func search(t *testing.T, app *fiber.App, db *gorm.DB, baseUrl string) {
+	post := CreatePost(db)
+	message := CreateMessage(db)
+	token := AccessToken(db)
+	anotherUser := CreateAnotherTestVerifiedUser(db)
+	anotherToken := AnotherAccessToken(db)
+	t.Run("Search", func(t *testing.T) {
+		// Test for missing search terms
+		req := httptest.NewRequest("GET", baseUrl+"?q=", nil)
+		res, _ := app.Test(req)
+		assert.Equal(t, 400, res.StatusCode)
+		body := ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "failure", body["status"])
+		assert.Equal(t, utils.ERR_INVALID_VALUE, body["code"])
+		assert.Equal(t, "Search query is required", body["message"])
+
+		// Test for invalid search type
+		req = httptest.NewRequest("GET", baseUrl+"?q=platform&type=invalid", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 400, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "Invalid 'type' value", body["message"])
+
+		// Test for posts search (the term matches its stemmed form)
+		req = httptest.NewRequest("GET", baseUrl+"?q=platforms", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, "success", body["status"])
+		assert.Equal(t, "Search results fetched", body["message"])
+		posts := body["data"].(map[string]interface{})["posts"].([]interface{})
+		assert.Equal(t, 1, len(posts))
+		postRep := posts[0].(map[string]interface{})
+		assert.Equal(t, post.Slug, postRep["slug"])
+		assert.Equal(t, "This is a nice new <b>platform</b>.", postRep["highlight"])
+
+		// Test for users search
+		req = httptest.NewRequest("GET", baseUrl+"?type=users&q="+url.QueryEscape(post.AuthorObj.FirstName), nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		users := body["data"].(map[string]interface{})["users"].([]interface{})
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, post.AuthorObj.Username, users[0].(map[string]interface{})["username"])
+
+		// Test for users search by someone the user blocked
+		block := models.Block{BlockerID: post.AuthorID, BlockedID: anotherUser.ID}
+		db.Create(&block)
+		req = httptest.NewRequest("GET", baseUrl+"?type=users&q="+url.QueryEscape(post.AuthorObj.FirstName), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", anotherToken))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, 0, len(body["data"].(map[string]interface{})["users"].([]interface{})))
+		db.Delete(&block)
+
+		// Test for messages search by a guest
+		req = httptest.NewRequest("GET", baseUrl+"?type=messages&q=boss", nil)
+		res, _ = app.Test(req)
+		assert.Equal(t, 401, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		assert.Equal(t, utils.ERR_UNAUTHORIZED_USER, body["code"])
+		assert.Equal(t, "Login to search your messages", body["message"])
+
+		// Test for messages search by a chat member
+		req = httptest.NewRequest("GET", baseUrl+"?type=messages&q=boss", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		res, _ = app.Test(req)
+		assert.Equal(t, 200, res.StatusCode)
+		body = ParseResponseBody(t, res.Body).(map[string]interface{})
+		messages := body["data"].(map[string]interface{})["messages"].([]interface{})
+		assert.Equal(t, 1, len(messages))
+		assert.Equal(t, message.ID.String(), messages[0].(map[string]interface{})["id"])
+		assert.Equal(t, "Hello <b>Boss</b>", messages[0].(map[string]interface{})["highlight"])
+	})
+}
+
+func TestSearch(t *testing.T) {
+	os.Setenv("ENVIRONMENT", "TESTING")
+	app := fiber.New()
+	db := Setup(t, app)
+	BASEURL := "/api/v6/search"
+
+	// Run Search Endpoint Tests
+	search(t, app, db, BASEURL)
+
+	// Drop Tables and Close Connectiom
+	database.DropTables(db)
+	CloseTestDatabase(db)
+}
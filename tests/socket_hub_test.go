@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/kayprogrammer/socialnet-v6/events"
+	"github.com/kayprogrammer/socialnet-v6/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+// Connection that records what's written to it. Writes of events wait while it's blocked, like a client that stopped reading
+type fakeSocketConn struct {
+	messages  chan []byte
+	writing   chan struct{} // Signalled each time an event write starts
+	unblock   chan struct{}
+	closeCode int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeSocketConn(blocked bool) *fakeSocketConn {
+	conn := &fakeSocketConn{messages: make(chan []byte, 1024), writing: make(chan struct{}, 1024), closed: make(chan struct{})}
+	if blocked {
+		conn.unblock = make(chan struct{})
+	}
+	return conn
+}
+
+func (conn *fakeSocketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *fakeSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.CloseMessage {
+		conn.closeCode = int(binary.BigEndian.Uint16(data))
+		return nil
+	}
+	conn.writing <- struct{}{}
+	if conn.unblock != nil {
+		<-conn.unblock
+	}
+	conn.messages <- data
+	return nil
+}
+
+func (conn *fakeSocketConn) Close() error {
+	conn.closeOnce.Do(func() { close(conn.closed) })
+	return nil
+}
+
+// Next event written to the connection, or nil if none comes in time
+func (conn *fakeSocketConn) next(wait time.Duration) []byte {
+	select {
+	case data := <-conn.messages:
+		return data
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Broker that records the topics unsubscribed from
+type recordingBroker struct {
+	*events.MemoryBroker
+	mutex        sync.Mutex
+	unsubscribed []string
+}
+
+func (broker *recordingBroker) Unsubscribe(sub *events.Subscription) {
+	broker.mutex.Lock()
+	broker.unsubscribed = append(broker.unsubscribed, sub.Topic)
+	broker.mutex.Unlock()
+	broker.MemoryBroker.Unsubscribe(sub)
+}
+
+func (broker *recordingBroker) Unsubscribed() []string {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	return append([]string{}, broker.unsubscribed...)
+}
+
+func fanOutEvents(t *testing.T) {
+	broker := events.NewMemoryBroker()
+	hub := routes.NewSocketHub(broker)
+	t.Run("Fan Out Events", func(t *testing.T) {
+		firstConn, secondConn, otherConn := newFakeSocketConn(false), newFakeSocketConn(false), newFakeSocketConn(false)
+		firstClient, secondClient, otherClient := routes.NewSocketClient(firstConn), routes.NewSocketClient(secondConn), routes.NewSocketClient(otherConn)
+		defer firstClient.Close()
+		defer secondClient.Close()
+		defer otherClient.Close()
+		hub.Join("chat_1", firstClient)
+		hub.Join("chat_1", secondClient)
+		hub.Join("chat_2", otherClient)
+
+		// Verify that every client of the topic gets the event, and only them
+		broker.Publish("chat_1", []byte("hello"))
+		assert.Equal(t, []byte("hello"), firstConn.next(time.Second))
+		assert.Equal(t, []byte("hello"), secondConn.next(time.Second))
+		assert.Nil(t, otherConn.next(100*time.Millisecond))
+
+		// Verify that a client that left gets nothing more
+		hub.Leave("chat_1", secondClient)
+		broker.Publish("chat_1", []byte("again"))
+		assert.Equal(t, []byte("again"), firstConn.next(time.Second))
+		assert.Nil(t, secondConn.next(100*time.Millisecond))
+	})
+}
+
+func evictSlowClient(t *testing.T) {
+	broker := &recordingBroker{MemoryBroker: events.NewMemoryBroker()}
+	hub := routes.NewSocketHub(broker)
+	t.Run("Evict Slow Client", func(t *testing.T) {
+		slowConn, fastConn := newFakeSocketConn(true), newFakeSocketConn(false)
+		slowClient, fastClient := routes.NewSocketClient(slowConn), routes.NewSocketClient(fastConn)
+		hub.Join("notifications_1", slowClient)
+		hub.Join("notifications_1", fastClient)
+
+		// Fill the slow client's queue while its first write hangs. One more event gets it evicted
+		slowClient.Send([]byte("first"))
+		<-slowConn.writing
+		for i := 0; i < 256; i++ {
+			slowClient.Send([]byte("queued"))
+		}
+		slowClient.Send([]byte("overflow"))
+
+		// Verify that the others in the group still get events
+		broker.Publish("notifications_1", []byte("hello"))
+		assert.Equal(t, []byte("hello"), fastConn.next(time.Second))
+
+		// Once its write goes through, the slow client is told why and disconnected
+		close(slowConn.unblock)
+		select {
+		case <-slowConn.closed:
+		case <-time.After(time.Second):
+			t.Fatal("slow client wasn't disconnected")
+		}
+		assert.Equal(t, websocket.ClosePolicyViolation, slowConn.closeCode)
+
+		t.Run("Clean Up After Eviction", func(t *testing.T) {
+			// The handler leaves the group when its connection closes
+			slowClient.Close()
+			hub.Leave("notifications_1", slowClient)
+			assert.Empty(t, broker.Unsubscribed())
+			broker.Publish("notifications_1", []byte("after"))
+			assert.Equal(t, []byte("after"), fastConn.next(time.Second))
+
+			// Verify that the group's subscription goes with its last client
+			fastClient.Close()
+			hub.Leave("notifications_1", fastClient)
+			assert.Equal(t, []string{"notifications_1"}, broker.Unsubscribed())
+
+			// Verify that joining again starts a new group
+			conn := newFakeSocketConn(false)
+			client := routes.NewSocketClient(conn)
+			defer client.Close()
+			hub.Join("notifications_1", client)
+			broker.Publish("notifications_1", []byte("welcome back"))
+			assert.Equal(t, []byte("welcome back"), conn.next(time.Second))
+		})
+	})
+}
+
+func TestSocketHub(t *testing.T) {
+	// Run Socket Hub Tests
+	fanOutEvents(t)
+	evictSlowClient(t)
+}
@@ -1,98 +1,53 @@
 package utils
 
-import (
-	"context"
-	"fmt"
-	"log"
-	"net/url"
-	"os"
-	"time"
-
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
-
-	"github.com/kayprogrammer/socialnet-v6/config"
-
-)
-
-var cloudName string
-var apiKey string
-var apiSecret string 
-var cld *cloudinary.Cloudinary
-var baseFolder = "socialnet-v6/"
-
-func init() {
-	cfg := config.GetConfig()
-	// Load environment variables here
-	cloudName = cfg.CloudinaryCloudName
-	apiKey = cfg.CloudinaryAPIKey
-	apiSecret = cfg.CloudinaryAPISecret
-
-	// Initialize the Cloudinary client
-	cld, _ = cloudinary.NewFromParams(cloudName, apiKey, apiSecret)
-}
-
-type SignatureFormat struct {
-	PublicId  string `json:"public_id" example:"images/f47ac10b-58cc-4372-a567-0e02b2c3d479"`
-	Signature string `json:"signature" example:"e1ba4683fbbf90b75ca22e9f8e545b18c6b24eae"`
-	Timestamp int64  `json:"timestamp" example:"1678828200"`
-}
-
-var ImageExtensions = map[string]string{
-	"image/jpeg": "jpg",
-	"image/png":  "png",
-	"image/gif":  "gif",
-	"image/bmp":  "bmp",
-	"image/webp": "webp",
-	"image/tiff": "tiff",
-	"image/svg+xml": "svg",
+import "github.com/kayprogrammer/socialnet-v6/models/choices"
+
+// An accepted file type
+type MediaType struct {
+	Kind      choices.MediaKindChoice
+	Extension string
+	// Other types content sniffing can take the files for (e.g "application/zip" for docx)
+	SniffedAs []string
+	// Whether sniffing always recognises the files. Generic results are only taken for types it doesn't
+	Sniffable bool
 }
 
-func GenerateFileSignature(key string, folder string) SignatureFormat {
-	key = fmt.Sprintf("%s%s/%s", baseFolder, folder, key)
-	timestamp := time.Now().Unix()
-	params := map[string]interface{}{
-		"public_id": key,
-		"timestamp": timestamp,
-	}
-
-	// Convert the params to url.Values
-	values := url.Values{}
-	for k, v := range params {
-		values.Add(k, fmt.Sprintf("%v", v))
-	}
-	resp, err := api.SignParameters(values, apiSecret)
-	if err != nil {
-		log.Fatal("Error signing params: ", err)
-	}
-	signatureResp := SignatureFormat{PublicId: key, Signature: resp, Timestamp: timestamp}
-	return signatureResp
+var MediaTypes = map[string]MediaType{
+	"image/jpeg":         {Kind: choices.MKIMAGE, Extension: "jpg", Sniffable: true},
+	"image/png":          {Kind: choices.MKIMAGE, Extension: "png", Sniffable: true},
+	"image/gif":          {Kind: choices.MKIMAGE, Extension: "gif", Sniffable: true},
+	"image/bmp":          {Kind: choices.MKIMAGE, Extension: "bmp", Sniffable: true},
+	"image/webp":         {Kind: choices.MKIMAGE, Extension: "webp", Sniffable: true},
+	"image/tiff":         {Kind: choices.MKIMAGE, Extension: "tiff"},
+	"image/svg+xml":      {Kind: choices.MKIMAGE, Extension: "svg"},
+	"video/mp4":          {Kind: choices.MKVIDEO, Extension: "mp4"},
+	"video/quicktime":    {Kind: choices.MKVIDEO, Extension: "mov", SniffedAs: []string{"video/mp4"}},
+	"video/webm":         {Kind: choices.MKVIDEO, Extension: "webm", Sniffable: true},
+	"audio/mpeg":         {Kind: choices.MKAUDIO, Extension: "mp3"},
+	"audio/mp4":          {Kind: choices.MKAUDIO, Extension: "m4a", SniffedAs: []string{"video/mp4"}},
+	"audio/aac":          {Kind: choices.MKAUDIO, Extension: "aac"},
+	"audio/ogg":          {Kind: choices.MKAUDIO, Extension: "ogg", SniffedAs: []string{"application/ogg"}, Sniffable: true},
+	"audio/wav":          {Kind: choices.MKAUDIO, Extension: "wav", SniffedAs: []string{"audio/wave"}, Sniffable: true},
+	"audio/webm":         {Kind: choices.MKAUDIO, Extension: "weba", SniffedAs: []string{"video/webm"}, Sniffable: true},
+	"application/pdf":    {Kind: choices.MKDOCUMENT, Extension: "pdf", Sniffable: true},
+	"text/plain":         {Kind: choices.MKDOCUMENT, Extension: "txt", Sniffable: true},
+	"application/msword": {Kind: choices.MKDOCUMENT, Extension: "doc"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {Kind: choices.MKDOCUMENT, Extension: "docx", SniffedAs: []string{"application/zip"}, Sniffable: true},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {Kind: choices.MKDOCUMENT, Extension: "xlsx", SniffedAs: []string{"application/zip"}, Sniffable: true},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {Kind: choices.MKDOCUMENT, Extension: "pptx", SniffedAs: []string{"application/zip"}, Sniffable: true},
 }
 
-func GenerateFileUrl(key string, folder string, contentType string) string {
-	key = fmt.Sprintf("%s%s/%s.%s", baseFolder, folder, key, ImageExtensions[contentType])
-
-	// Generate the Cloudinary URL for the existing resource
-	urls, err := cld.Media(key)
-	if err != nil {
-		log.Println("Error generating Cloudinary URL:", err)
-	}
-	url, err := urls.String()
-	if err != nil {
-		log.Println("Error converting to string:", err)
+// Type of the file with the extension, if it's one of ours
+func MediaTypeByExtension(extension string) (string, bool) {
+	for contentType, mediaType := range MediaTypes {
+		if mediaType.Extension == extension {
+			return contentType, true
+		}
 	}
-	return url
+	return "", false
 }
 
 func BoolAddr(b bool) *bool {
 	boolVar := b
 	return &boolVar
 }
-
-func UploadImage(file *os.File, key string, folder string) {
-	key = fmt.Sprintf("%s%s/%s", baseFolder, folder, key)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	cld.Upload.Upload(ctx, file, uploader.UploadParams{PublicID: key, Overwrite: BoolAddr(true), Faces: BoolAddr(true)})
-}
@@ -33,6 +33,10 @@ var ERR_INVALID_PAGE =	"invalid_page"
 var ERR_INVALID_VALUE =	"invalid_value"
 var ERR_NOT_ALLOWED =	"not_allowed"
 var ERR_INVALID_DATA_TYPE =	"invalid_data_type"
+var ERR_TOO_MANY_REQUESTS =	"too_many_requests"
+var ERR_LOCKED_OTP =	"locked_otp"
+var ERR_LOCKED_ACCOUNT =	"locked_account"
+var ERR_SUSPENDED_ACCOUNT =	"suspended_account"
 
 func RequestErr(code string, message string, opts ...map[string]string) ErrorResponse {
 	var data *map[string]string
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Mentions and hashtags have to start a word, so emails (john@doe.com) and links
+// to page sections (page#top) aren't taken for them
+var (
+	mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([A-Za-z0-9_-]+)`)
+	hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&])#([\p{L}\p{N}_]+)`)
+	numberRegex  = regexp.MustCompile(`^[0-9]+$`)
+)
+
+const MaxHashtagLength = 100
+
+// Usernames mentioned in the text with @username, lowercased and without repeats
+func ExtractMentions(text string) []string {
+	usernames := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		username := strings.ToLower(strings.TrimRight(match[1], "-"))
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Hashtags in the text, normalized and without repeats. Numbers alone (#1) aren't hashtags
+func ExtractHashtags(text string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range hashtagRegex.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeHashtag(match[1])
+		if len(tag) > MaxHashtagLength || numberRegex.MatchString(tag) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Hashtags are stored lowercased and without the #
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"math/rand"
@@ -70,6 +72,13 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// TOKEN HASHING
+// Tokens are long and random, so a fast digest (unlike passwords) is enough to store them safely
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
 // UUID PARSER
 func ParseUUID(input string) (*uuid.UUID, *ErrorResponse) {
 	uuidVal := uuid.Parse(input)
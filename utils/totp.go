@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP (RFC 6238) settings understood by every common authenticator app
+const (
+	totpPeriod = 30 // Seconds each code lasts
+	totpDigits = 6
+	totpSkew   = 1 // Steps of clock drift tolerated either way
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTotpSecret() string {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return totpEncoding.EncodeToString(secret)
+}
+
+// URI that authenticator apps read (usually from a QR code) to add the account
+func TotpUri(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func TotpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// Code of the secret for the given time step
+func TotpCode(secret string, step int64) string {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return ""
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// Returns the time step the code belongs to, if it's valid around the given time
+func MatchTotpCode(secret string, code string, t time.Time) (int64, bool) {
+	current := TotpStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(TotpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// RECOVERY CODES
+// Random codes like "k3x7q-7m2fd". They're shown once and only their hashes are kept
+func GenerateRecoveryCode() string {
+	const charset = "abcdefghijklmnopqrstuvwxyz234567" // 32 characters, so every byte maps without bias
+	random := make([]byte, 10)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	code := make([]byte, len(random))
+	for i, b := range random {
+		code[i] = charset[int(b)%len(charset)]
+	}
+	return string(code[:5]) + "-" + string(code[5:])
+}
+
+// Hash to store and look up a recovery code by, ignoring case and separators
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(normalized)
+}
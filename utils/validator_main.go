@@ -29,7 +29,12 @@ func init() {
 	// Register Custom Validators
 	customValidator.RegisterValidation("date", DateValidator)
 	customValidator.RegisterValidation("reaction_type_validator", ReactionTypeValidator)
+	customValidator.RegisterValidation("post_visibility_validator", PostVisibilityValidator)
+	customValidator.RegisterValidation("report_reason_validator", ReportReasonValidator)
+	customValidator.RegisterValidation("report_action_validator", ReportActionValidator)
+	customValidator.RegisterValidation("notification_audience_validator", NotificationAudienceValidator)
 	customValidator.RegisterValidation("file_type_validator", FileTypeValidator)
+	customValidator.RegisterValidation("media_type_validator", MediaTypeValidator)
 	customValidator.RegisterValidation("usernames_to_update_validator", DistinctField)
 
 	customValidator.RegisterTagNameFunc(func(fld reflect.StructField) string {
@@ -59,8 +64,13 @@ func registerTranslations(param string) {
 	registerTranslation("required_if", "This field is required.", translator)
 	registerTranslation("required_without", "This field is required.", translator)
 	registerTranslation("reaction_type_validator", "Invalid reaction type", translator)
+	registerTranslation("post_visibility_validator", "Invalid visibility", translator)
+	registerTranslation("report_reason_validator", "Invalid report reason", translator)
+	registerTranslation("report_action_validator", "Invalid action", translator)
+	registerTranslation("notification_audience_validator", "Invalid audience", translator)
 	registerTranslation("usernames_to_update_validator", "Must not have any matching items with usernames to add", translator)
 	registerTranslation("file_type_validator", "Invalid file type", translator)
+	registerTranslation("media_type_validator", "Invalid file type", translator)
 
 	minErrMsg := fmt.Sprintf("%s characters min", param)
 	registerTranslation("min", minErrMsg, translator)
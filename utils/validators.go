@@ -25,17 +25,58 @@ func ReactionTypeValidator(fl validator.FieldLevel) bool {
 	return false // Error. Value doesn't match the required
 }
 
-// Validates if a file type is accepted
+// Validates if a post visibility value is the correct one
+func PostVisibilityValidator(fl validator.FieldLevel) bool {
+	visibility := fl.Field().Interface().(choices.PostVisibilityChoice)
+	switch visibility {
+	case choices.PVPUBLIC, choices.PVFRIENDS, choices.PVONLYME, choices.PVCUSTOM:
+		return true
+	}
+	return false // Error. Value doesn't match the required
+}
+
+// Validates if a report reason value is the correct one
+func ReportReasonValidator(fl validator.FieldLevel) bool {
+	reason := fl.Field().Interface().(choices.ReportReasonChoice)
+	switch reason {
+	case choices.RRSPAM, choices.RRHARASSMENT, choices.RRHATESPEECH, choices.RRVIOLENCE, choices.RRNUDITY, choices.RRMISINFORMATION, choices.RRIMPERSONATION, choices.RROTHER:
+		return true
+	}
+	return false // Error. Value doesn't match the required
+}
+
+// Validates if a report action value is the correct one
+func ReportActionValidator(fl validator.FieldLevel) bool {
+	action := fl.Field().Interface().(choices.ReportActionChoice)
+	switch action {
+	case choices.RADISMISS, choices.RARESOLVE, choices.RAHIDE, choices.RASUSPEND:
+		return true
+	}
+	return false // Error. Value doesn't match the required
+}
+
+// Validates if a notification audience value is the correct one
+func NotificationAudienceValidator(fl validator.FieldLevel) bool {
+	audience := fl.Field().Interface().(choices.NotificationAudienceChoice)
+	switch audience {
+	case choices.NAALL, choices.NACITY, choices.NACOUNTRY, choices.NAUSERS:
+		return true
+	}
+	return false // Error. Value doesn't match the required
+}
+
+// Validates if a file type is accepted where only images are (avatars, group images)
 func FileTypeValidator(fl validator.FieldLevel) bool {
 	fileType := fl.Field().Interface().(string)
-	fileTypeFound := false
-	for key := range ImageExtensions {
-		if key == fileType {
-			fileTypeFound = true
-			break
-		}
-	}
-	return fileTypeFound
+	mediaType, ok := MediaTypes[fileType]
+	return ok && mediaType.Kind == choices.MKIMAGE
+}
+
+// Validates if a file type is accepted as an attachment (any image, video, audio or document type)
+func MediaTypeValidator(fl validator.FieldLevel) bool {
+	fileType := fl.Field().Interface().(string)
+	_, ok := MediaTypes[fileType]
+	return ok
 }
 
 func ValidateUUID(fl validator.FieldLevel) bool {